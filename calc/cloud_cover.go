@@ -0,0 +1,52 @@
+package calc
+
+import "time"
+
+type CloudCoverSample struct {
+	Production float64 // Actual production in kWh
+	ClearSky   float64 // Expected production in kWh for a clear sky
+	CloudCover float64 // Forecasted cloud cover in octas
+}
+
+const (
+	SeasonWinter = "winter"
+	SeasonSpring = "spring"
+	SeasonSummer = "summer"
+	SeasonAutumn = "autumn"
+)
+
+var Seasons = []string{SeasonWinter, SeasonSpring, SeasonSummer, SeasonAutumn}
+
+func Season(month time.Month) string {
+	switch month {
+	case time.December, time.January, time.February:
+		return SeasonWinter
+	case time.March, time.April, time.May:
+		return SeasonSpring
+	case time.June, time.July, time.August:
+		return SeasonSummer
+	default:
+		return SeasonAutumn
+	}
+}
+
+// Fits the cloud cover impact k in production = clearSky * (1 - k * cloudCover/8)
+// by least squares. The result is clamped to the range 0-1.
+func FitCloudCoverImpact(samples []CloudCoverSample) float64 {
+	num, den := 0.0, 0.0
+	for _, s := range samples {
+		if s.ClearSky <= 0 {
+			continue
+		}
+		x := s.CloudCover / 8.0
+		ratio := s.Production / s.ClearSky
+		num += x * (1 - ratio)
+		den += x * x
+	}
+
+	if den == 0 {
+		return 0
+	}
+
+	return min(max(num/den, 0), 1)
+}
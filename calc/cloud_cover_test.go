@@ -0,0 +1,46 @@
+package calc
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFitCloudCoverImpact(t *testing.T) {
+	var samples []CloudCoverSample
+	for octas := range 9 {
+		samples = append(samples, CloudCoverSample{
+			Production: 4.0 * (1 - 0.7*float64(octas)/8.0),
+			ClearSky:   4.0,
+			CloudCover: float64(octas),
+		})
+	}
+
+	if k := FitCloudCoverImpact(samples); math.Abs(k-0.7) > 1e-9 {
+		t.Errorf("got impact %f, wanted 0.7", k)
+	}
+}
+
+func TestFitCloudCoverImpactClamped(t *testing.T) {
+	samples := []CloudCoverSample{
+		{Production: 5.0, ClearSky: 4.0, CloudCover: 8},
+		{Production: 0.0, ClearSky: 0.0, CloudCover: 8}, // Night, ignored
+	}
+
+	if k := FitCloudCoverImpact(samples); k != 0 {
+		t.Errorf("got impact %f, wanted 0", k)
+	}
+
+	if k := FitCloudCoverImpact(nil); k != 0 {
+		t.Errorf("got impact %f for no samples, wanted 0", k)
+	}
+}
+
+func TestSeason(t *testing.T) {
+	if s := Season(time.January); s != SeasonWinter {
+		t.Errorf("got %s, wanted %s", s, SeasonWinter)
+	}
+	if s := Season(time.July); s != SeasonSummer {
+		t.Errorf("got %s, wanted %s", s, SeasonSummer)
+	}
+}
@@ -18,6 +18,10 @@ func OctasToPercentage(octas float64) float64 {
 	return math.Round((octas / 8) * 100)
 }
 
+func PercentageToOctas(percentage float64) uint8 {
+	return uint8(math.Round(min(max(percentage, 0), 100) / 100 * 8))
+}
+
 func DegToRad(deg float64) float64 {
 	return deg * math.Pi / 180.0
 }
@@ -0,0 +1,40 @@
+package calc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestQuantile(t *testing.T) {
+	values := []float64{5, 1, 4, 2, 3}
+	tests := []struct {
+		q        float64
+		expected float64
+	}{
+		{0.0, 1.0},
+		{0.1, 1.4},
+		{0.5, 3.0},
+		{0.9, 4.6},
+		{1.0, 5.0},
+	}
+
+	for _, tt := range tests {
+		if v := Quantile(values, tt.q); math.Abs(v-tt.expected) > 1e-9 {
+			t.Errorf("Quantile(%.1f) expected %f, got %f", tt.q, tt.expected, v)
+		}
+	}
+
+	if v := Quantile(nil, 0.5); v != 0 {
+		t.Errorf("Quantile() of no values expected 0, got %f", v)
+	}
+}
+
+func TestMean(t *testing.T) {
+	if v := Mean([]float64{1, 2, 6}); v != 3 {
+		t.Errorf("Mean() expected 3, got %f", v)
+	}
+
+	if v := Mean(nil); v != 0 {
+		t.Errorf("Mean() of no values expected 0, got %f", v)
+	}
+}
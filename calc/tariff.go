@@ -0,0 +1,31 @@
+package calc
+
+// What it costs to buy and what you get for selling energy, on top of the spot price
+type Tariff struct {
+	VAT                float64 // VAT as a fraction, e.g. 0.25, applied to everything that is bought
+	EnergyTax          float64 // Energy tax per kWh bought, excluding VAT
+	ImportFee          float64 // Grid transfer fee per kWh bought, excluding VAT
+	ExportCompensation float64 // Compensation per kWh sold on top of the spot price, e.g. tax reduction and grid benefit
+}
+
+// Total price of buying kWh at the given spot price (excluding VAT)
+func (t Tariff) BuyPrice(kWh, price float64) float64 {
+	return kWh * (price + t.EnergyTax + t.ImportFee) * (1 + t.VAT)
+}
+
+// Total compensation for selling kWh at the given spot price
+func (t Tariff) SellPrice(kWh, price float64) float64 {
+	return kWh * (price + t.ExportCompensation)
+}
+
+// Positive when more was sold than bought, negative otherwise. At negative spot prices selling
+// can cost money and buying can pay.
+func (t Tariff) CashFlow(gridImportKWh, gridExportKWh, price float64) float64 {
+	netExp := gridExportKWh - gridImportKWh
+	if netExp > 0 {
+		return t.SellPrice(netExp, price)
+	} else if netExp < 0 {
+		return t.BuyPrice(-netExp, price) * -1
+	}
+	return 0
+}
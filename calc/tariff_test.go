@@ -0,0 +1,41 @@
+package calc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTariffBuyPrice(t *testing.T) {
+	tariff := Tariff{VAT: 0.25, EnergyTax: 0.4, ImportFee: 0.2}
+	if p := tariff.BuyPrice(2, 1.0); math.Abs(p-4.0) > 1e-9 {
+		t.Errorf("got %f, wanted 4.0", p)
+	}
+}
+
+func TestTariffSellPrice(t *testing.T) {
+	tariff := Tariff{VAT: 0.25, ExportCompensation: 0.6}
+	if p := tariff.SellPrice(2, 1.0); math.Abs(p-3.2) > 1e-9 {
+		t.Errorf("got %f, wanted 3.2", p)
+	}
+}
+
+func TestTariffCashFlow(t *testing.T) {
+	tariff := Tariff{VAT: 0.25, EnergyTax: 0.4, ExportCompensation: 0.6}
+
+	tests := []struct {
+		imp, exp, price, want float64
+	}{
+		{imp: 0, exp: 0, price: 1, want: 0},
+		{imp: 3, exp: 1, price: 1, want: -3.5},
+		{imp: 1, exp: 3, price: 1, want: 3.2},
+		{imp: 0, exp: 2, price: -1, want: -0.8}, // Selling costs money
+		{imp: 2, exp: 0, price: -1, want: 1.5},  // Buying pays
+		{imp: 0, exp: 2, price: -0.5, want: 0.2},
+	}
+
+	for _, tt := range tests {
+		if got := tariff.CashFlow(tt.imp, tt.exp, tt.price); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("CashFlow(%f, %f, %f) = %f, wanted %f", tt.imp, tt.exp, tt.price, got, tt.want)
+		}
+	}
+}
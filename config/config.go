@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"log/slog"
 	"strings"
+	"time"
 
+	"github.com/icodeforyou/solarplant-go/calc"
 	"github.com/icodeforyou/solarplant-go/logging"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
 	"github.com/spf13/viper"
 )
 
@@ -46,20 +49,143 @@ type AppConfigFerroamp struct {
 	Port     int16
 	Username string
 	Password string // Handed over by Ferroamp on request
+	// Seconds between the keep alive pings to the broker, the broker gives up on solarplant after 1.5 times that, default: 30
+	KeepAlive *int `mapstructure:"keep_alive"`
+	// Have the broker set the battery to auto when solarplant disconnects without shutting down, e.g. when it crashes
+	AutoOnConnectionLoss bool `mapstructure:"auto_on_connection_loss"`
+}
+
+func (f AppConfigFerroamp) GetKeepAlive() time.Duration {
+	if f.KeepAlive == nil {
+		return 30 * time.Second
+	}
+	return time.Duration(*f.KeepAlive) * time.Second
 }
 
 type AppConfigWeatherForecast struct {
 	Latitude  float64 // Your approx latitude position (WGS84)
 	Longitude float64 // Your approx longitude position (WGS84)
 	RunAt     string  `mapstructure:"run_at"`
+	// Weather forecast providers in order of preference: "smhi", "open_meteo", "met_norway", default: ["smhi"]
+	Providers []string `mapstructure:"providers"`
+}
+
+func (w AppConfigWeatherForecast) GetProviders() []string {
+	if len(w.Providers) == 0 {
+		return []string{"smhi"}
+	}
+	return w.Providers
+}
+
+// Defaults for the countries with a supported bidding zone
+var countries = map[string]struct {
+	currency string
+	vat      float64
+}{
+	"SE": {currency: "SEK", vat: 0.25},
+	"NO": {currency: "NOK", vat: 0.25},
+	"DK": {currency: "DKK", vat: 0.25},
+	"FI": {currency: "EUR", vat: 0.255},
 }
 
 type AppConfigEnergyPrice struct {
+	Area  string `mapstructure:"area"` // "SE1"-"SE4", "NO1"-"NO5", "DK1", "DK2" or "FI"
+	RunAt string `mapstructure:"run_at"`
+	// Currency for all prices, default depends on the area: SEK, NOK, DKK or EUR
+	Currency *string `mapstructure:"currency"`
+	// Taxes and fees added to the spot price, if not set the deprecated Swedish fields below are used
+	Tariff *AppConfigTariff `mapstructure:"tariff"`
+	// Energy price providers in order of preference, hours missing from one provider are filled from the next: "elprisetjustnu", "nordpool", "entsoe",
+	// default: ["elprisetjustnu", "nordpool"] in Sweden and ["nordpool"] elsewhere
+	Providers []string        `mapstructure:"providers"`
+	Entsoe    AppConfigEntsoe `mapstructure:"entsoe"`
+	// Maximum difference per kWh before a warning is logged that providers disagree on a price, default: 0.01
+	DisagreementTolerance *float64 `mapstructure:"disagreement_tolerance"`
+	// How many hours ahead to estimate prices that are not yet published, based on the price history, 0 disables, default: 24
+	EstimateHoursAhead *int `mapstructure:"estimate_hours_ahead"`
+
+	// Deprecated: use tariff instead
 	Tax          float64 `mapstructure:"tax_including_vat"` // Energy tax in SEK/kWh including VAT (energiskatt inkl. moms)
 	TaxReduction float64 `mapstructure:"tax_reduction"`     // Energy tax reduction in SEK/kWh when selling energy back to the grid (skattereduktion)
 	GridBenefit  float64 `mapstructure:"grid_benefit"`      // Grid benefit in SEK/kWh (nätnytta)
-	Area         string  `mapstructure:"area"`              // "SE1", "SE2", "SE3", "SE4"
-	RunAt        string  `mapstructure:"run_at"`
+}
+
+type AppConfigTariff struct {
+	VAT                *float64 `mapstructure:"vat"`                 // VAT as a fraction, default depends on the area, e.g. 0.25 in Sweden
+	EnergyTax          float64  `mapstructure:"energy_tax"`          // Energy tax per kWh bought, excluding VAT
+	ImportFee          float64  `mapstructure:"import_fee"`          // Grid transfer fee per kWh bought, excluding VAT
+	ExportCompensation float64  `mapstructure:"export_compensation"` // Compensation per kWh sold on top of the spot price, e.g. tax reduction and grid benefit
+}
+
+// Country code of the area, e.g. "SE" for "SE3"
+func (e AppConfigEnergyPrice) GetCountry() string {
+	area := strings.ToUpper(e.Area)
+	if len(area) < 2 {
+		return area
+	}
+	return area[:2]
+}
+
+func (e AppConfigEnergyPrice) GetCurrency() string {
+	if e.Currency != nil {
+		return strings.ToUpper(*e.Currency)
+	}
+	if c, ok := countries[e.GetCountry()]; ok {
+		return c.currency
+	}
+	return "EUR"
+}
+
+func (e AppConfigEnergyPrice) GetTariff() calc.Tariff {
+	if e.Tariff == nil {
+		// The old fields had the VAT included in the tax and grid benefit lowered the buy price
+		return calc.Tariff{
+			EnergyTax:          e.Tax,
+			ImportFee:          -e.GridBenefit,
+			ExportCompensation: e.TaxReduction,
+		}
+	}
+
+	vat := countries[e.GetCountry()].vat
+	if e.Tariff.VAT != nil {
+		vat = *e.Tariff.VAT
+	}
+	return calc.Tariff{
+		VAT:                vat,
+		EnergyTax:          e.Tariff.EnergyTax,
+		ImportFee:          e.Tariff.ImportFee,
+		ExportCompensation: e.Tariff.ExportCompensation,
+	}
+}
+
+func (e AppConfigEnergyPrice) GetDisagreementTolerance() float64 {
+	if e.DisagreementTolerance == nil {
+		return 0.01
+	}
+	return *e.DisagreementTolerance
+}
+
+func (e AppConfigEnergyPrice) GetEstimateHoursAhead() int {
+	if e.EstimateHoursAhead == nil {
+		return 24
+	}
+	return *e.EstimateHoursAhead
+}
+
+func (e AppConfigEnergyPrice) GetProviders() []string {
+	if len(e.Providers) == 0 {
+		if e.GetCountry() == "SE" {
+			return []string{"elprisetjustnu", "nordpool"}
+		}
+		return []string{"nordpool"}
+	}
+	return e.Providers
+}
+
+type AppConfigEntsoe struct {
+	Token string `mapstructure:"token"` // Security token for the ENTSO-E Transparency Platform API
+	// Units of the configured currency per EUR used to convert the prices, fetched daily from the European Central Bank when not set
+	ExchangeRate *float64 `mapstructure:"exchange_rate"`
 }
 
 type AppConfigEnergyForecast struct {
@@ -69,16 +195,78 @@ type AppConfigEnergyForecast struct {
 	HistoricalDays int `mapstructure:"historical_days"`
 	// A value between 0 and 1 where 0 means no impact and 1 means full impact, i.e. no EV production when cloudiness is 8 octas
 	CloudCoverImpact float64 `mapstructure:"cloud_cover_impact"`
-	RunAt            string  `mapstructure:"run_at"`
+	// How many days back should be considered when learning the cloud cover impact, default: 365
+	CalibrationDays *int `mapstructure:"calibration_days"`
+	// Minimum number of daylight hours in a season before the learned cloud cover impact is used instead of cloud_cover_impact, default: 100
+	CalibrationMinSamples *int `mapstructure:"calibration_min_samples"`
+	// When to learn the cloud cover impact, it's also learned at startup, default: "15 2 * * *"
+	CalibrationRunAt string `mapstructure:"calibration_run_at"`
+}
+
+func (e AppConfigEnergyForecast) GetCalibrationDays() int {
+	if e.CalibrationDays == nil {
+		return 365
+	}
+	return *e.CalibrationDays
+}
+
+func (e AppConfigEnergyForecast) GetCalibrationMinSamples() int {
+	if e.CalibrationMinSamples == nil {
+		return 100
+	}
+	return *e.CalibrationMinSamples
+}
+
+func (e AppConfigEnergyForecast) GetCalibrationRunAt() string {
+	if e.CalibrationRunAt == "" {
+		return "15 2 * * *"
+	}
+	return e.CalibrationRunAt
 }
 
 type AppConfigBatterySpec struct {
-	Capacity         float64 `mapstructure:"capacity"`           // Battery maximum capacity in kWh
-	MinLevel         float64 `mapstructure:"min_level"`          // Battery minimum level in percentage
-	MaxLevel         float64 `mapstructure:"max_level"`          // Battery maximum level in percentage
-	MaxChargeRate    float64 `mapstructure:"max_charge_rate"`    // Battery maximum charge power in kW
-	MaxDischargeRate float64 `mapstructure:"max_discharge_rate"` // Battery maximum discharge power in kW
-	DegradationCost  float64 `mapstructure:"degradation_cost"`   // Cost of charging/discharging the battery in SEK/kWh
+	Capacity         float64  `mapstructure:"capacity"`           // Battery maximum capacity in kWh
+	MinLevel         float64  `mapstructure:"min_level"`          // Battery minimum level in percentage
+	MaxLevel         float64  `mapstructure:"max_level"`          // Battery maximum level in percentage
+	MaxChargeRate    float64  `mapstructure:"max_charge_rate"`    // Battery maximum charge power in kW
+	MaxDischargeRate float64  `mapstructure:"max_discharge_rate"` // Battery maximum discharge power in kW
+	DegradationCost  float64  `mapstructure:"degradation_cost"`   // Cost of charging/discharging the battery per kWh in full cycles at 25 °C and 0.5 C in the configured currency
+	CycleLife        *float64 `mapstructure:"cycle_life"`         // Full cycles at 25 °C and 0.5 C until the battery is worn out
+	DepthExponent    *float64 `mapstructure:"depth_exponent"`     // How much harder deep cycles wear than shallow ones, 1 gives the same cost per kWh for any depth
+	// Plan with the usable capacity measured over the last 30 days instead of the configured capacity, once it's been measured
+	UseMeasuredCapacity bool `mapstructure:"use_measured_capacity"`
+	// Lower charge and discharge power by temperature, interpolated between the points
+	Derating []AppConfigDeratingPoint `mapstructure:"derating"`
+	// Lower charge power near full and discharge power near empty, interpolated between the points
+	Taper []AppConfigTaperPoint `mapstructure:"taper"`
+	// Plan with the taper learned from how much power the battery takes when forced to charge or discharge, where it's been learned
+	LearnTaper bool `mapstructure:"learn_taper"`
+}
+
+type AppConfigDeratingPoint struct {
+	Temperature      float64  `mapstructure:"temperature"`        // Cell temperature in °C
+	MaxChargeRate    *float64 `mapstructure:"max_charge_rate"`    // Maximum charge power in kW, the battery's maximum if left out
+	MaxDischargeRate *float64 `mapstructure:"max_discharge_rate"` // Maximum discharge power in kW, the battery's maximum if left out
+}
+
+type AppConfigTaperPoint struct {
+	Level            float64  `mapstructure:"level"`              // Battery level in percentage
+	MaxChargeRate    *float64 `mapstructure:"max_charge_rate"`    // Maximum charge power in kW, the battery's maximum if left out
+	MaxDischargeRate *float64 `mapstructure:"max_discharge_rate"` // Maximum discharge power in kW, the battery's maximum if left out
+}
+
+func (b AppConfigBatterySpec) GetCycleLife() float64 {
+	if b.CycleLife == nil {
+		return 6000
+	}
+	return *b.CycleLife
+}
+
+func (b AppConfigBatterySpec) GetDepthExponent() float64 {
+	if b.DepthExponent == nil {
+		return 1.5
+	}
+	return *b.DepthExponent
 }
 
 func (b AppConfigBatterySpec) MaxKWh() float64 {
@@ -89,15 +277,242 @@ func (b AppConfigBatterySpec) MinKWh() float64 {
 	return b.Capacity * b.MinLevel / 100.0
 }
 
+// Keeps the battery above a higher level than its minimum, e.g. for outages on winter evenings or in storms
+type AppConfigBatteryReserve struct {
+	// Battery levels to keep by time of day and season, the highest that applies is used
+	Schedule []AppConfigReserveLevel `mapstructure:"schedule"`
+	Weather  AppConfigReserveWeather `mapstructure:"weather"`
+}
+
+type AppConfigReserveLevel struct {
+	MinLevel float64 `mapstructure:"min_level"` // Battery minimum level in percentage
+	From     string  `mapstructure:"from"`      // "HH:MM" in the GUI timezone, the whole day if left out
+	To       string  `mapstructure:"to"`        // "HH:MM", before from if the window spans midnight
+	Months   []int   `mapstructure:"months"`    // 1-12, the whole year if left out
+}
+
+// Raises the reserve when the weather forecast is bad
+type AppConfigReserveWeather struct {
+	MinLevel      float64  `mapstructure:"min_level"`     // Battery minimum level in percentage in bad weather, 0 disables
+	WindGust      *float64 `mapstructure:"wind_gust"`     // Gusts in m/s from which the weather is bad
+	Precipitation *float64 `mapstructure:"precipitation"` // Precipitation in mm/h from which the weather is bad
+	HoursBefore   *int     `mapstructure:"hours_before"`  // Hours before bad weather the reserve is raised, default: 3
+}
+
+func (w AppConfigReserveWeather) GetHoursBefore() int {
+	if w.HoursBefore == nil {
+		return 3
+	}
+	return *w.HoursBefore
+}
+
 type AppConfigPlanner struct {
 	GridMaxPower float64 `mapstructure:"grid_max_power"` // Maximum power from/to the grid in kW
 	HoursAhead   int     `mapstructure:"hours_ahead"`    // Number of hours to plan ahead
 	RunAt        string  `mapstructure:"run_at"`         // How often to run the planner
+	RiskAversion float64 `mapstructure:"risk_aversion"`  // Between 0 (minimize expected cost) and 1 (minimize worst case cost) when forecasts are uncertain
+	// Seconds to wait for further updates before replanning when new prices or forecasts are saved, default: 60
+	ReplanDebounce *int `mapstructure:"replan_debounce"`
+	// Cost in the configured currency of changing strategy from one hour to the next, 0 disables
+	SwitchCost float64 `mapstructure:"switch_cost"`
+	// Cost in the configured currency of each stable hour planned differently than in the previous plan, 0 disables
+	DeviationCost float64 `mapstructure:"deviation_cost"`
+	// Number of upcoming hours the previous plan is kept stable for, default: 3
+	StableHours *int `mapstructure:"stable_hours"`
+	// Extra cost in the configured currency per kWh bought from the grid, weighs self-sufficiency against the cost of energy, 0 plans for the lowest cost
+	ImportPenalty float64 `mapstructure:"import_penalty"`
+	// Maximum power in kW that may be exported to the grid, e.g. 0 for a connection that isn't allowed to export, no limit if left out
+	GridMaxExport *float64 `mapstructure:"grid_max_export"`
+}
+
+func (p AppConfigPlanner) GetReplanDebounce() time.Duration {
+	if p.ReplanDebounce == nil {
+		return 60 * time.Second
+	}
+	return time.Duration(*p.ReplanDebounce) * time.Second
+}
+
+func (p AppConfigPlanner) GetGridMaxExport() maybe.Maybe[float64] {
+	if p.GridMaxExport == nil {
+		return maybe.None[float64]()
+	}
+	return maybe.Some(*p.GridMaxExport)
+}
+
+func (p AppConfigPlanner) GetStableHours() int {
+	if p.StableHours == nil {
+		return 3
+	}
+	return *p.StableHours
 }
 
 type BatteryRegulatorStrategy struct {
 	Interval        int     `mapstructure:"interval"`         // How often battery load status should be monitored in sec
 	UpdateThreshold float64 `mapstructure:"update_threshold"` // Threshold in watts for when to update battery state, helps avoid frequent updates for small power changes.
+	// Difference in percentage points between the actual and the planned battery level that triggers a replan, 0 disables, default: 10
+	ReplanSocDeviation *float64 `mapstructure:"replan_soc_deviation"`
+	// Difference in kWh between the actual and the forecasted consumption this hour that triggers a replan, 0 disables, default: 1.5
+	ReplanConsumptionDeviation *float64 `mapstructure:"replan_consumption_deviation"`
+	// Minimum minutes between replans triggered by deviations, default: 15
+	ReplanMinInterval *int `mapstructure:"replan_min_interval"`
+	// Minutes since the planning for the current hour was saved after which it's stale and the battery is left in auto, 0 disables, default: 180
+	MaxPlanAge *int `mapstructure:"max_plan_age"`
+}
+
+func (b BatteryRegulatorStrategy) GetReplanSocDeviation() float64 {
+	if b.ReplanSocDeviation == nil {
+		return 10
+	}
+	return *b.ReplanSocDeviation
+}
+
+func (b BatteryRegulatorStrategy) GetReplanConsumptionDeviation() float64 {
+	if b.ReplanConsumptionDeviation == nil {
+		return 1.5
+	}
+	return *b.ReplanConsumptionDeviation
+}
+
+func (b BatteryRegulatorStrategy) GetReplanMinInterval() time.Duration {
+	if b.ReplanMinInterval == nil {
+		return 15 * time.Minute
+	}
+	return time.Duration(*b.ReplanMinInterval) * time.Minute
+}
+
+func (b BatteryRegulatorStrategy) GetMaxPlanAge() time.Duration {
+	if b.MaxPlanAge == nil {
+		return 180 * time.Minute
+	}
+	return time.Duration(*b.MaxPlanAge) * time.Minute
+}
+
+type AppConfigEvCharger struct {
+	// How the charger is controlled: "ocpp", "http" or "mqtt", leave empty if there's no charger
+	Driver   string          `mapstructure:"driver"`
+	MaxPower float64         `mapstructure:"max_power"` // Maximum charging power in kW
+	Ocpp     AppConfigOcpp   `mapstructure:"ocpp"`
+	Http     AppConfigEvHttp `mapstructure:"http"`
+	Mqtt     AppConfigEvMqtt `mapstructure:"mqtt"`
+	// How often the charger is controlled in sec, default: 30
+	Interval *int `mapstructure:"interval"`
+}
+
+func (e AppConfigEvCharger) Enabled() bool {
+	return e.Driver != ""
+}
+
+func (e AppConfigEvCharger) GetInterval() time.Duration {
+	if e.Interval == nil {
+		return 30 * time.Second
+	}
+	return time.Duration(*e.Interval) * time.Second
+}
+
+type AppConfigOcpp struct {
+	// Port the charger connects to, as ws://<host>:<port>/ocpp/<charge point id>, default: 9000
+	Port *int `mapstructure:"port"`
+	// Only this charge point may connect, any charge point if empty
+	ChargePointId string `mapstructure:"charge_point_id"`
+}
+
+func (o AppConfigOcpp) GetPort() int {
+	if o.Port == nil {
+		return 9000
+	}
+	return *o.Port
+}
+
+type AppConfigEvHttp struct {
+	// Base URL of the charger bridge that serves GET <url>/status and POST <url>/charging
+	Url string `mapstructure:"url"`
+	// How often the status is polled in sec, default: 10
+	PollInterval *int `mapstructure:"poll_interval"`
+}
+
+func (h AppConfigEvHttp) GetPollInterval() time.Duration {
+	if h.PollInterval == nil {
+		return 10 * time.Second
+	}
+	return time.Duration(*h.PollInterval) * time.Second
+}
+
+type AppConfigEvMqtt struct {
+	Host         string
+	Port         int16
+	Username     string
+	Password     string
+	StatusTopic  string `mapstructure:"status_topic"`  // JSON status published by the charger bridge
+	CommandTopic string `mapstructure:"command_topic"` // JSON commands to the charger bridge
+}
+
+type AppConfigFlexibleLoad struct {
+	Name         string  `mapstructure:"name"`
+	Power        float64 `mapstructure:"power"`          // Power in kW when the load is on
+	DailyRunTime float64 `mapstructure:"daily_run_time"` // Hours the load has to run every day
+	// When the load may run in the GUI timezone, the whole day if empty
+	Windows []AppConfigTimeWindow `mapstructure:"windows"`
+	// How the load is switched on and off: "mqtt", "http" or "shelly"
+	Backend string              `mapstructure:"backend"`
+	Mqtt    AppConfigLoadMqtt   `mapstructure:"mqtt"`
+	Http    AppConfigLoadHttp   `mapstructure:"http"`
+	Shelly  AppConfigLoadShelly `mapstructure:"shelly"`
+}
+
+type AppConfigTimeWindow struct {
+	From string `mapstructure:"from"` // "HH:MM"
+	To   string `mapstructure:"to"`   // "HH:MM", before from if the window spans midnight
+}
+
+type AppConfigLoadMqtt struct {
+	Host       string
+	Port       int16
+	Username   string
+	Password   string
+	Topic      string  `mapstructure:"topic"`
+	PayloadOn  *string `mapstructure:"payload_on"`  // Default: "on"
+	PayloadOff *string `mapstructure:"payload_off"` // Default: "off"
+}
+
+func (m AppConfigLoadMqtt) GetPayloadOn() string {
+	if m.PayloadOn == nil {
+		return "on"
+	}
+	return *m.PayloadOn
+}
+
+func (m AppConfigLoadMqtt) GetPayloadOff() string {
+	if m.PayloadOff == nil {
+		return "off"
+	}
+	return *m.PayloadOff
+}
+
+type AppConfigLoadHttp struct {
+	OnUrl  string  `mapstructure:"on_url"`
+	OffUrl string  `mapstructure:"off_url"`
+	Method *string `mapstructure:"method"` // Default: "POST"
+}
+
+func (h AppConfigLoadHttp) GetMethod() string {
+	if h.Method == nil {
+		return "POST"
+	}
+	return strings.ToUpper(*h.Method)
+}
+
+type AppConfigLoadShelly struct {
+	Host  string `mapstructure:"host"`
+	Relay int    `mapstructure:"relay"` // Relay or switch id, default: 0
+	// 1 for the /relay API of the first generation devices, 2 for the RPC API of later ones, default: 1
+	Generation *int `mapstructure:"generation"`
+}
+
+func (s AppConfigLoadShelly) GetGeneration() int {
+	if s.Generation == nil {
+		return 1
+	}
+	return *s.Generation
 }
 
 type AppConfigGui struct {
@@ -156,8 +571,11 @@ type AppConfig struct {
 	EnergyForecast           AppConfigEnergyForecast  `mapstructure:"energy_forecast"`
 	EnergyPrice              AppConfigEnergyPrice     `mapstructure:"energy_price"`
 	BatterySpec              AppConfigBatterySpec     `mapstructure:"battery_spec"`
+	BatteryReserve           AppConfigBatteryReserve  `mapstructure:"battery_reserve"`
 	Planner                  AppConfigPlanner         `mapstructure:"planner"`
 	BatteryRegulatorStrategy BatteryRegulatorStrategy `mapstructure:"battery_regulator_strategy"`
+	EvCharger                AppConfigEvCharger       `mapstructure:"ev_charger"`
+	FlexibleLoads            []AppConfigFlexibleLoad  `mapstructure:"flexible_loads"`
 	Gui                      AppConfigGui             `mapstructure:"gui"`
 	Logging                  AppConfigLogging         `mapstructure:"logging"`
 }
@@ -183,5 +601,9 @@ func Load(path string) (*AppConfig, error) {
 		return nil, fmt.Errorf("unable to unmarshal config file: %w", err)
 	}
 
+	if c.Planner.RiskAversion < 0 || c.Planner.RiskAversion > 1 {
+		return nil, fmt.Errorf("planner risk_aversion must be between 0 and 1, got %v", c.Planner.RiskAversion)
+	}
+
 	return &c, nil
 }
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type BatteryModuleHealthRow struct {
+	Module        string
+	Soh           float64 // State of health in percentage
+	RatedCapacity float64 // kWh
+}
+
+// Energy charged or discharged over a change in battery level
+type BatteryCapacityEstimateRow struct {
+	When     time.Time // When the change ended
+	Charging bool
+	Depth    float64 // Change in battery level in percentage
+	Energy   float64 // kWh
+}
+
+type DailyBatteryHealth struct {
+	Date              string
+	Soh               sql.NullFloat64 // Average state of health of the modules in percentage
+	RatedCapacity     sql.NullFloat64 // Sum of the modules' rated capacity in kWh
+	EstimatedCapacity sql.NullFloat64 // Usable capacity in kWh estimated from the energy charged and discharged
+}
+
+func (d *Database) SaveBatteryModuleHealth(ctx context.Context, date string, row BatteryModuleHealthRow) error {
+	d.logger.Debug("saving battery module health", "date", date, "module", row.Module, "soh", row.Soh, "ratedCapacity", row.RatedCapacity)
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO battery_module_health (date, module, soh, rated_capacity) VALUES (?, ?, ?, ?)
+		ON CONFLICT(date, module) DO UPDATE SET
+			soh = excluded.soh,
+			rated_capacity = excluded.rated_capacity`,
+		date, row.Module, row.Soh, row.RatedCapacity)
+	if err != nil {
+		return fmt.Errorf("saving battery module health: %w", err)
+	}
+	return nil
+}
+
+/** Returns the modules as last reported, ordered by module */
+func (d *Database) GetLatestBatteryModuleHealth(ctx context.Context) ([]BatteryModuleHealthRow, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT module, soh, rated_capacity
+		FROM battery_module_health
+		WHERE date = (SELECT max(date) FROM battery_module_health)
+		ORDER BY module`)
+	if err != nil {
+		return nil, fmt.Errorf("fetching battery module health: %w", err)
+	}
+	defer rows.Close()
+
+	var res []BatteryModuleHealthRow
+	for rows.Next() {
+		var r BatteryModuleHealthRow
+		if err := rows.Scan(&r.Module, &r.Soh, &r.RatedCapacity); err != nil {
+			return nil, fmt.Errorf("scanning battery module health: %w", err)
+		}
+		res = append(res, r)
+	}
+
+	return res, nil
+}
+
+func (d *Database) AddBatteryCapacityEstimate(ctx context.Context, row BatteryCapacityEstimateRow) error {
+	d.logger.Debug("adding battery capacity estimate", "charging", row.Charging, "depth", row.Depth, "energy", row.Energy)
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO battery_capacity_estimate (time, charging, depth, energy) VALUES (?, ?, ?, ?)`,
+		row.When.Unix(), row.Charging, row.Depth, row.Energy)
+	if err != nil {
+		return fmt.Errorf("adding battery capacity estimate: %w", err)
+	}
+	return nil
+}
+
+/** Returns the usable capacity in kWh estimated since a point in time, or sql.ErrNoRows if there are no estimates.
+ * Charging and discharging are estimated separately and averaged, so the conversion losses roughly cancel out. */
+func (d *Database) GetMeasuredBatteryCapacity(ctx context.Context, since time.Time) (float64, error) {
+	row := d.read.QueryRowContext(ctx, `
+		SELECT avg(capacity) FROM (
+			SELECT sum(energy) / sum(depth) * 100 AS capacity
+			FROM battery_capacity_estimate
+			WHERE time >= ?
+			GROUP BY charging
+		)`,
+		since.Unix())
+
+	var capacity sql.NullFloat64
+	if err := row.Scan(&capacity); err != nil {
+		return 0, fmt.Errorf("estimating battery capacity: %w", err)
+	}
+	if !capacity.Valid {
+		return 0, sql.ErrNoRows
+	}
+	return capacity.Float64, nil
+}
+
+/** Returns the reported health and estimated capacity per day, oldest first */
+func (d *Database) GetDailyBatteryHealth(ctx context.Context) ([]DailyBatteryHealth, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		WITH modules AS (
+			SELECT date, avg(soh) AS soh, sum(rated_capacity) AS rated_capacity
+			FROM battery_module_health
+			GROUP BY date
+		),
+		estimates AS (
+			SELECT date(time, 'unixepoch') AS date, sum(energy) / sum(depth) * 100 AS capacity
+			FROM battery_capacity_estimate
+			GROUP BY 1, charging
+		),
+		capacity AS (
+			SELECT date, avg(capacity) AS capacity
+			FROM estimates
+			GROUP BY date
+		),
+		dates AS (
+			SELECT date FROM modules UNION SELECT date FROM capacity
+		)
+		SELECT dates.date, modules.soh, modules.rated_capacity, capacity.capacity
+		FROM dates
+		LEFT JOIN modules ON modules.date = dates.date
+		LEFT JOIN capacity ON capacity.date = dates.date
+		ORDER BY dates.date`)
+	if err != nil {
+		return nil, fmt.Errorf("fetching daily battery health: %w", err)
+	}
+	defer rows.Close()
+
+	var res []DailyBatteryHealth
+	for rows.Next() {
+		var r DailyBatteryHealth
+		if err := rows.Scan(&r.Date, &r.Soh, &r.RatedCapacity, &r.EstimatedCapacity); err != nil {
+			return nil, fmt.Errorf("scanning daily battery health: %w", err)
+		}
+		res = append(res, r)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// Battery power commanded and delivered at a battery level
+type BatteryPowerSampleRow struct {
+	Level     float64 // Lowest battery level in percentage of the range the sample is summed in
+	Charging  bool
+	Commanded float64 // kW
+	Delivered float64 // kW
+}
+
+// Battery power delivered within a range of battery levels
+type BatteryPowerByLevel struct {
+	Level    float64 // Lowest battery level in percentage of the range
+	Charging bool
+	Ratio    float64 // Delivered power divided by commanded power
+	Samples  int
+}
+
+func (d *Database) AddBatteryPowerSample(ctx context.Context, row BatteryPowerSampleRow) error {
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO battery_power_by_level (level, charging, commanded, delivered, samples) VALUES (?, ?, ?, ?, 1)
+		ON CONFLICT(level, charging) DO UPDATE SET
+			commanded = commanded + excluded.commanded,
+			delivered = delivered + excluded.delivered,
+			samples = samples + 1`,
+		row.Level, row.Charging, row.Commanded, row.Delivered)
+	if err != nil {
+		return fmt.Errorf("adding battery power sample: %w", err)
+	}
+	return nil
+}
+
+/** Returns the share of the commanded power delivered by range of battery levels, ordered by level */
+func (d *Database) GetBatteryPowerByLevel(ctx context.Context) ([]BatteryPowerByLevel, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT level, charging, delivered / commanded, samples
+		FROM battery_power_by_level
+		WHERE commanded > 0
+		ORDER BY level, charging`)
+	if err != nil {
+		return nil, fmt.Errorf("fetching battery power by level: %w", err)
+	}
+	defer rows.Close()
+
+	var res []BatteryPowerByLevel
+	for rows.Next() {
+		var r BatteryPowerByLevel
+		if err := rows.Scan(&r.Level, &r.Charging, &r.Ratio, &r.Samples); err != nil {
+			return nil, fmt.Errorf("scanning battery power by level: %w", err)
+		}
+		res = append(res, r)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+// Battery usage during (a part of) an hour
+type BatteryWearRow struct {
+	When          hours.DateHour
+	Charged       float64         // Energy charged in kWh
+	Discharged    float64         // Energy discharged in kWh
+	Wear          float64         // Estimated wear in equivalent full cycles at reference conditions
+	Temperature   sql.NullFloat64 // Average cell temperature in °C, not valid if not reported
+	Cycles        float64         // Equivalent full cycles over the battery's lifetime at the end of the hour
+	Level         float64         // Battery level in percentage at the end of the hour
+	CycleStart    float64         // Battery level in percentage where the half cycle at the end of the hour began
+	CycleCharging bool            // The half cycle at the end of the hour is charging
+}
+
+type DailyBatteryWear struct {
+	Date           string
+	Charged        float64
+	Discharged     float64
+	Wear           float64
+	AvgTemperature sql.NullFloat64
+	Cycles         float64 // Equivalent full cycles over the battery's lifetime at the end of the day
+}
+
+/** Adds usage to the hour, the cycles and current half cycle are replaced */
+func (d *Database) AddBatteryWear(ctx context.Context, row BatteryWearRow) error {
+	samples := 0
+	if row.Temperature.Valid {
+		samples = 1
+	}
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO battery_wear (date, hour, charged, discharged, wear, temperature, samples, cycles, level, cycle_start, cycle_charging)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(date, hour) DO UPDATE SET
+			charged = charged + excluded.charged,
+			discharged = discharged + excluded.discharged,
+			wear = wear + excluded.wear,
+			temperature = CASE
+				WHEN excluded.temperature IS NULL THEN temperature
+				ELSE (coalesce(temperature, 0) * samples + excluded.temperature) / (samples + 1)
+			END,
+			samples = samples + excluded.samples,
+			cycles = excluded.cycles,
+			level = excluded.level,
+			cycle_start = excluded.cycle_start,
+			cycle_charging = excluded.cycle_charging`,
+		row.When.Date, row.When.Hour, row.Charged, row.Discharged, row.Wear, row.Temperature, samples,
+		row.Cycles, row.Level, row.CycleStart, row.CycleCharging)
+	if err != nil {
+		return fmt.Errorf("adding battery wear: %w", err)
+	}
+	return nil
+}
+
+/** Returns the most recent hour, or sql.ErrNoRows if the battery hasn't been tracked yet */
+func (d *Database) GetLatestBatteryWear(ctx context.Context) (BatteryWearRow, error) {
+	row := d.read.QueryRowContext(ctx, `
+		SELECT date, hour, charged, discharged, wear, temperature, cycles, level, cycle_start, cycle_charging
+		FROM battery_wear
+		ORDER BY date DESC, hour DESC
+		LIMIT 1`)
+
+	var r BatteryWearRow
+	err := row.Scan(&r.When.Date, &r.When.Hour, &r.Charged, &r.Discharged, &r.Wear, &r.Temperature,
+		&r.Cycles, &r.Level, &r.CycleStart, &r.CycleCharging)
+	if err == sql.ErrNoRows {
+		return BatteryWearRow{}, sql.ErrNoRows
+	}
+	if err != nil {
+		return BatteryWearRow{}, fmt.Errorf("scanning battery wear row: %w", err)
+	}
+	return r, nil
+}
+
+/** Returns the usage and wear per day since the battery was first tracked, oldest first */
+func (d *Database) GetDailyBatteryWear(ctx context.Context) ([]DailyBatteryWear, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT
+			date,
+			sum(charged),
+			sum(discharged),
+			sum(wear),
+			sum(temperature * samples) / nullif(sum(samples), 0),
+			max(cycles)
+		FROM battery_wear
+		GROUP BY date
+		ORDER BY date`)
+	if err != nil {
+		return nil, fmt.Errorf("fetching daily battery wear: %w", err)
+	}
+	defer rows.Close()
+
+	var res []DailyBatteryWear
+	for rows.Next() {
+		var r DailyBatteryWear
+		if err := rows.Scan(&r.Date, &r.Charged, &r.Discharged, &r.Wear, &r.AvgTemperature, &r.Cycles); err != nil {
+			return nil, fmt.Errorf("scanning daily battery wear: %w", err)
+		}
+		res = append(res, r)
+	}
+
+	return res, nil
+}
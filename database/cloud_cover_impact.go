@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+)
+
+type CloudCoverImpactRow struct {
+	Season  string
+	Impact  float64 // Learned cloud cover impact between 0 and 1
+	Samples int     // Number of daylight hours the impact was fitted from
+	Updated time.Time
+}
+
+func (d *Database) SaveCloudCoverImpact(ctx context.Context, row CloudCoverImpactRow) error {
+	d.logger.Debug("saving cloud cover impact",
+		"season", row.Season,
+		"impact", row.Impact,
+		"samples", row.Samples)
+
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO cloud_cover_impact (season, impact, samples)
+		VALUES (?, ?, ?)
+		ON CONFLICT(season) DO UPDATE SET
+			impact = excluded.impact,
+			samples = excluded.samples`,
+		row.Season,
+		calc.RoundFloat64(row.Impact, 4),
+		row.Samples)
+	if err != nil {
+		return fmt.Errorf("saving cloud cover impact: %w", err)
+	}
+
+	return nil
+}
+
+func (d *Database) GetCloudCoverImpacts(ctx context.Context) ([]CloudCoverImpactRow, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT season, impact, samples, updated
+		FROM cloud_cover_impact`)
+	if err != nil {
+		return nil, fmt.Errorf("fetching cloud cover impacts: %w", err)
+	}
+	defer rows.Close()
+
+	var res []CloudCoverImpactRow
+	for rows.Next() {
+		var row CloudCoverImpactRow
+		var updated int64
+		if err := rows.Scan(&row.Season, &row.Impact, &row.Samples, &updated); err != nil {
+			return nil, fmt.Errorf("scanning cloud cover impact row: %w", err)
+		}
+		row.Updated = time.Unix(updated, 0)
+		res = append(res, row)
+	}
+
+	return res, nil
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+// Status of an instruction that couldn't be sent to the ESO
+const ControlStatusFailed = "failed"
+
+// An instruction sent to the battery
+type ControlLogRow struct {
+	Timestamp time.Time
+	Action    string
+	Power     float64         // kW
+	Strategy  string          // Planned strategy for the hour, empty if there's no plan
+	Reason    string          // Why the instruction was sent, e.g. following the plan or holding the reserve
+	Limit     string          // What lowered the power below what the strategy asked for, empty if nothing did
+	TransId   string          // Transaction id of the control request
+	Status    string          // "ack" or "nak" as answered by the ESO, "timeout" or "failed"
+	Message   string          // Message from the ESO, or the error when the request failed
+	Latency   sql.NullFloat64 // Seconds until the ESO answered, not valid if it didn't
+}
+
+func (r ControlLogRow) LocalizedTimestamp() string {
+	return hours.FormatTimeInGuiTimezone(r.Timestamp)
+}
+
+func (d *Database) AddControlLog(ctx context.Context, r ControlLogRow) error {
+	when := hours.FromTime(r.Timestamp)
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO control_log (timestamp, date, hour, action, power, strategy, reason, limited, trans_id, status, message, latency)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.Timestamp.UTC().Format(time.RFC3339),
+		when.Date,
+		when.Hour,
+		r.Action,
+		r.Power,
+		r.Strategy,
+		r.Reason,
+		r.Limit,
+		r.TransId,
+		r.Status,
+		r.Message,
+		r.Latency)
+	if err != nil {
+		return fmt.Errorf("adding control log: %w", err)
+	}
+	return nil
+}
+
+/** Returns the most recent instructions first */
+func (d *Database) GetControlLog(ctx context.Context, page, pageSize int) ([]ControlLogRow, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT timestamp, action, power, strategy, reason, limited, trans_id, status, message, latency
+		FROM control_log
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?`,
+		pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("fetching control log: %w", err)
+	}
+	defer rows.Close()
+
+	return scanControlLog(rows)
+}
+
+/** Returns the instructions sent during the hour and the one in effect when it began, oldest first */
+func (d *Database) GetControlLogForHour(ctx context.Context, dh hours.DateHour) ([]ControlLogRow, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT timestamp, action, power, strategy, reason, limited, trans_id, status, message, latency
+		FROM control_log
+		WHERE id >= (
+			SELECT coalesce(max(id), 0)
+			FROM control_log
+			WHERE (date = ? AND hour < ?) OR date < ?)
+		AND ((date = ? AND hour <= ?) OR date < ?)
+		ORDER BY id ASC`,
+		dh.Date, dh.Hour, dh.Date, dh.Date, dh.Hour, dh.Date)
+	if err != nil {
+		return nil, fmt.Errorf("fetching control log for %s: %w", dh, err)
+	}
+	defer rows.Close()
+
+	return scanControlLog(rows)
+}
+
+func scanControlLog(rows *sql.Rows) ([]ControlLogRow, error) {
+	var ts string
+	var res []ControlLogRow
+	for rows.Next() {
+		var r ControlLogRow
+		err := rows.Scan(&ts, &r.Action, &r.Power, &r.Strategy, &r.Reason, &r.Limit, &r.TransId, &r.Status, &r.Message, &r.Latency)
+		if err != nil {
+			return nil, fmt.Errorf("scanning control log: %w", err)
+		}
+		r.Timestamp, err = time.Parse(time.RFC3339, ts)
+		if err != nil {
+			return nil, fmt.Errorf("parsing timestamp: %w", err)
+		}
+		res = append(res, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading control log rows: %w", err)
+	}
+
+	return res, nil
+}
+
+func (d *Database) PurgeControlLog(ctx context.Context, retentionDays int) error {
+	return d.purgeTable(ctx, "control_log", retentionDays)
+}
@@ -11,39 +11,91 @@ import (
 
 type EnergyForecastRow struct {
 	When hours.DateHour
-	/** Estimated production in kWh normalized to a situation without clouds */
+	/** Estimated production in kWh (median) */
 	Production float64
-	/** Estimated consumption in kWh */
+	/** Estimated consumption in kWh (median) */
 	Consumption float64
+	/** 10th and 90th percentile of estimated production in kWh */
+	ProductionP10 float64
+	ProductionP90 float64
+	/** 10th and 90th percentile of estimated consumption in kWh */
+	ConsumptionP10 float64
+	ConsumptionP90 float64
 }
 
-func (d *Database) SaveEnergyForecast(ctx context.Context, rows []EnergyForecastRow) error {
+/** True if the forecast holds a spread between the 10th and 90th percentile */
+func (r EnergyForecastRow) HasQuantiles() bool {
+	return r.ProductionP90 > r.ProductionP10 || r.ConsumptionP90 > r.ConsumptionP10
+}
+
+type EnergyForecastErrorRow struct {
+	Horizon     int
+	Production  float64 // Actual minus forecasted production in kWh
+	Consumption float64 // Actual minus forecasted consumption in kWh
+}
+
+/** Stores the forecast and returns how many hours were added or changed */
+func (d *Database) SaveEnergyForecast(ctx context.Context, rows []EnergyForecastRow) (int, error) {
+	changed := 0
 	for _, row := range rows {
 		d.logger.Debug("saving energy forecast",
 			"hour", row.When,
 			"production", row.Production,
-			"consumption", row.Consumption)
+			"consumption", row.Consumption,
+			"production_p10", row.ProductionP10,
+			"production_p90", row.ProductionP90,
+			"consumption_p10", row.ConsumptionP10,
+			"consumption_p90", row.ConsumptionP90)
 
-		_, err := d.write.ExecContext(ctx, `
+		res, err := d.write.ExecContext(ctx, `
 		INSERT INTO energy_forecast (
 			date,
 			hour,
 			production,
-			consumption
-		) VALUES (?, ?, ?, ?)
+			consumption,
+			production_p10,
+			production_p90,
+			consumption_p10,
+			consumption_p90
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(date, hour) DO UPDATE SET
 			production = excluded.production,
-			consumption = excluded.consumption;`,
+			consumption = excluded.consumption,
+			production_p10 = excluded.production_p10,
+			production_p90 = excluded.production_p90,
+			consumption_p10 = excluded.consumption_p10,
+			consumption_p90 = excluded.consumption_p90
+		WHERE energy_forecast.production != excluded.production
+			OR energy_forecast.consumption != excluded.consumption
+			OR energy_forecast.production_p10 != excluded.production_p10
+			OR energy_forecast.production_p90 != excluded.production_p90
+			OR energy_forecast.consumption_p10 != excluded.consumption_p10
+			OR energy_forecast.consumption_p90 != excluded.consumption_p90;`,
 			row.When.Date,
 			row.When.Hour,
 			calc.TwoDecimals(row.Production),
 			calc.TwoDecimals(row.Consumption),
+			calc.TwoDecimals(row.ProductionP10),
+			calc.TwoDecimals(row.ProductionP90),
+			calc.TwoDecimals(row.ConsumptionP10),
+			calc.TwoDecimals(row.ConsumptionP90),
 		)
 		if err != nil {
-			return fmt.Errorf("saving energy forecast: %w", err)
+			return changed, fmt.Errorf("saving energy forecast: %w", err)
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			changed += int(n)
+		}
+
+		err = d.saveVintage(ctx, "energy_forecast_vintage", row.When,
+			[]string{"production", "consumption"},
+			calc.TwoDecimals(row.Production),
+			calc.TwoDecimals(row.Consumption))
+		if err != nil {
+			return changed, err
 		}
 	}
-	return nil
+	return changed, nil
 }
 
 func (d *Database) GetEnergyForecast(ctx context.Context, dh hours.DateHour) (EnergyForecastRow, error) {
@@ -52,13 +104,25 @@ func (d *Database) GetEnergyForecast(ctx context.Context, dh hours.DateHour) (En
 			date,
 			hour,
 			production,
-			consumption
+			consumption,
+			production_p10,
+			production_p90,
+			consumption_p10,
+			consumption_p90
 		FROM energy_forecast
 		WHERE (date = ? AND hour = ?)`,
 		dh.Date, dh.Hour)
 
 	var ef EnergyForecastRow
-	err := row.Scan(&ef.When.Date, &ef.When.Hour, &ef.Production, &ef.Consumption)
+	err := row.Scan(
+		&ef.When.Date,
+		&ef.When.Hour,
+		&ef.Production,
+		&ef.Consumption,
+		&ef.ProductionP10,
+		&ef.ProductionP90,
+		&ef.ConsumptionP10,
+		&ef.ConsumptionP90)
 	if err == sql.ErrNoRows {
 		return EnergyForecastRow{}, sql.ErrNoRows
 	}
@@ -75,7 +139,11 @@ func (d *Database) GetEnergyForecastFrom(ctx context.Context, dh hours.DateHour)
 			date,
 			hour,
 			production,
-			consumption
+			consumption,
+			production_p10,
+			production_p90,
+			consumption_p10,
+			consumption_p90
 		FROM energy_forecast
 		WHERE (date = ? AND hour >= ?) OR date > ?`,
 		dh.Date, dh.Hour, dh.Date)
@@ -91,7 +159,11 @@ func (d *Database) GetEnergyForecastFrom(ctx context.Context, dh hours.DateHour)
 			&row.When.Date,
 			&row.When.Hour,
 			&row.Production,
-			&row.Consumption)
+			&row.Consumption,
+			&row.ProductionP10,
+			&row.ProductionP90,
+			&row.ConsumptionP10,
+			&row.ConsumptionP90)
 		if err != nil {
 			return nil, err
 		}
@@ -101,6 +173,34 @@ func (d *Database) GetEnergyForecastFrom(ctx context.Context, dh hours.DateHour)
 	return ef, nil
 }
 
+/** Returns the errors of previously issued energy forecasts for hours from the given date */
+func (d *Database) GetEnergyForecastErrors(ctx context.Context, fromDate string) ([]EnergyForecastErrorRow, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT
+			v.horizon,
+			a.production - v.production,
+			a.consumption - v.consumption
+		FROM energy_forecast_vintage v
+		JOIN time_series a ON a.date = v.date AND a.hour = v.hour
+		WHERE v.date >= ?`,
+		fromDate)
+	if err != nil {
+		return nil, fmt.Errorf("fetching energy forecast errors: %w", err)
+	}
+	defer rows.Close()
+
+	var res []EnergyForecastErrorRow
+	for rows.Next() {
+		var row EnergyForecastErrorRow
+		if err := rows.Scan(&row.Horizon, &row.Production, &row.Consumption); err != nil {
+			return nil, fmt.Errorf("scanning energy forecast error row: %w", err)
+		}
+		res = append(res, row)
+	}
+
+	return res, nil
+}
+
 func (d *Database) PurgeEnergyForecast(ctx context.Context, retentionDays int) error {
 	return d.purgeTable(ctx, "energy_forecast", retentionDays)
 }
@@ -10,24 +10,83 @@ import (
 )
 
 type EnergyPriceRow struct {
-	When  hours.DateHour
-	Price float64
+	When      hours.DateHour
+	Price     float64
+	Currency  string
+	Provider  string // Name of the provider that supplied the price
+	Estimated bool   // True until the real price has been published
 }
 
-func (d *Database) SaveEnergyPrices(ctx context.Context, rows []EnergyPriceRow) error {
+/** Stores real prices and returns how many hours were added or changed */
+func (d *Database) SaveEnergyPrices(ctx context.Context, rows []EnergyPriceRow) (int, error) {
+	changed := 0
 	for _, row := range rows {
 		d.logger.Debug("saving energy price",
 			"hour", row.When,
-			"price", row.Price)
+			"price", row.Price,
+			"currency", row.Currency,
+			"provider", row.Provider)
+
+		res, err := d.write.ExecContext(ctx, `
+			INSERT INTO energy_price (date, hour, price, currency, provider, estimated) VALUES (?, ?, ?, ?, ?, 0)
+			ON CONFLICT(date, hour) DO UPDATE SET
+				price = excluded.price,
+				currency = excluded.currency,
+				provider = excluded.provider,
+				estimated = 0
+			WHERE energy_price.price != excluded.price
+				OR energy_price.currency != excluded.currency
+				OR energy_price.provider != excluded.provider
+				OR energy_price.estimated = 1`,
+			row.When.Date,
+			row.When.Hour,
+			calc.RoundFloat64(row.Price, 4),
+			row.Currency,
+			row.Provider)
+		if err != nil {
+			return changed, fmt.Errorf("saving energy prices: %w", err)
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			changed += int(n)
+		}
+	}
+
+	return changed, nil
+}
+
+/**
+ * Stores estimated prices, hours that already have a real price are left untouched.
+ * Every estimate is kept as a vintage so the estimator can be measured against the published price.
+ */
+func (d *Database) SaveEstimatedEnergyPrices(ctx context.Context, rows []EnergyPriceRow) error {
+	for _, row := range rows {
+		d.logger.Debug("saving estimated energy price",
+			"hour", row.When,
+			"price", row.Price,
+			"currency", row.Currency)
 
 		_, err := d.write.ExecContext(ctx, `
-			INSERT INTO energy_price (date, hour, price) VALUES (?, ?, ?)
-			ON CONFLICT(date, hour) DO UPDATE SET price = excluded.price`,
+			INSERT INTO energy_price (date, hour, price, currency, provider, estimated) VALUES (?, ?, ?, ?, ?, 1)
+			ON CONFLICT(date, hour) DO UPDATE SET
+				price = excluded.price,
+				currency = excluded.currency,
+				provider = excluded.provider
+			WHERE energy_price.estimated = 1`,
 			row.When.Date,
 			row.When.Hour,
-			calc.RoundFloat64(row.Price, 4))
+			calc.RoundFloat64(row.Price, 4),
+			row.Currency,
+			row.Provider)
 		if err != nil {
-			return fmt.Errorf("saving energy prices: %w", err)
+			return fmt.Errorf("saving estimated energy prices: %w", err)
+		}
+
+		err = d.saveVintage(ctx, "energy_price_vintage", row.When,
+			[]string{"price", "provider"},
+			calc.RoundFloat64(row.Price, 4),
+			row.Provider)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -36,13 +95,13 @@ func (d *Database) SaveEnergyPrices(ctx context.Context, rows []EnergyPriceRow)
 
 func (d *Database) GetEnergyPrice(ctx context.Context, dh hours.DateHour) (EnergyPriceRow, error) {
 	row := d.read.QueryRowContext(ctx, `SELECT
-		date, hour, price
+		date, hour, price, currency, provider, estimated
 		FROM energy_price
 		WHERE date = ? AND hour = ?`,
 		dh.Date, dh.Hour)
 
 	var ep EnergyPriceRow
-	err := row.Scan(&ep.When.Date, &ep.When.Hour, &ep.Price)
+	err := row.Scan(&ep.When.Date, &ep.When.Hour, &ep.Price, &ep.Currency, &ep.Provider, &ep.Estimated)
 	if err == sql.ErrNoRows {
 		return EnergyPriceRow{}, sql.ErrNoRows
 	} else if err != nil {
@@ -54,7 +113,7 @@ func (d *Database) GetEnergyPrice(ctx context.Context, dh hours.DateHour) (Energ
 
 func (d *Database) GetEnergyPriceFrom(ctx context.Context, dh hours.DateHour) ([]EnergyPriceRow, error) {
 	rows, err := d.read.QueryContext(ctx, `SELECT
-		date, hour, price
+		date, hour, price, currency, provider, estimated
 		FROM energy_price
 		WHERE (date = ? AND hour >= ?) OR date > ?
 		ORDER BY date, hour ASC`,
@@ -68,7 +127,35 @@ func (d *Database) GetEnergyPriceFrom(ctx context.Context, dh hours.DateHour) ([
 	var energyPrices []EnergyPriceRow
 	for rows.Next() {
 		var ep EnergyPriceRow
-		err := rows.Scan(&ep.When.Date, &ep.When.Hour, &ep.Price)
+		err := rows.Scan(&ep.When.Date, &ep.When.Hour, &ep.Price, &ep.Currency, &ep.Provider, &ep.Estimated)
+		if err != nil {
+			return nil, fmt.Errorf("scanning energy price row: %w", err)
+		}
+
+		energyPrices = append(energyPrices, ep)
+	}
+
+	return energyPrices, nil
+}
+
+/** Returns real, i.e. not estimated, prices in the given currency from the given date */
+func (d *Database) GetEnergyPriceHistory(ctx context.Context, fromDate string, currency string) ([]EnergyPriceRow, error) {
+	rows, err := d.read.QueryContext(ctx, `SELECT
+		date, hour, price, currency, provider, estimated
+		FROM energy_price
+		WHERE date >= ? AND currency = ? AND estimated = 0
+		ORDER BY date, hour ASC`,
+		fromDate, currency)
+	if err != nil {
+		return nil, fmt.Errorf("fetching energy price history from %s: %w", fromDate, err)
+	}
+
+	defer rows.Close()
+
+	var energyPrices []EnergyPriceRow
+	for rows.Next() {
+		var ep EnergyPriceRow
+		err := rows.Scan(&ep.When.Date, &ep.When.Hour, &ep.Price, &ep.Currency, &ep.Provider, &ep.Estimated)
 		if err != nil {
 			return nil, fmt.Errorf("scanning energy price row: %w", err)
 		}
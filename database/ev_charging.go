@@ -0,0 +1,167 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+)
+
+type EvChargeRequestRow struct {
+	Id        int64
+	Energy    float64   // Energy in kWh the vehicle needs
+	Deadline  time.Time // When the energy is needed
+	Delivered float64   // Energy in kWh charged since the request was made
+	Created   time.Time
+}
+
+// Energy in kWh left to charge
+func (r EvChargeRequestRow) Remaining() float64 {
+	return max(r.Energy-r.Delivered, 0)
+}
+
+type EvSessionRow struct {
+	Started time.Time
+	Ended   sql.NullTime // Not valid while the vehicle is connected
+	Energy  float64      // Energy in kWh charged during the session
+}
+
+/** Saves a new request that replaces any earlier request */
+func (d *Database) SaveEvChargeRequest(ctx context.Context, energy float64, deadline time.Time) (int64, error) {
+	d.logger.Debug("saving ev charge request", "energy", energy, "deadline", deadline)
+
+	tx, err := d.write.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE ev_charge_request SET cancelled = 1 WHERE cancelled = 0`); err != nil {
+		return 0, fmt.Errorf("cancelling earlier ev charge requests: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO ev_charge_request (energy, deadline) VALUES (?, ?)`,
+		calc.RoundFloat64(energy, 2),
+		deadline.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("saving ev charge request: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("getting ev charge request id: %w", err)
+	}
+
+	return id, tx.Commit()
+}
+
+func (d *Database) CancelEvChargeRequests(ctx context.Context) error {
+	d.logger.Debug("cancelling ev charge requests")
+	_, err := d.write.ExecContext(ctx, `UPDATE ev_charge_request SET cancelled = 1 WHERE cancelled = 0`)
+	if err != nil {
+		return fmt.Errorf("cancelling ev charge requests: %w", err)
+	}
+	return nil
+}
+
+/** Returns the request with a deadline after now, or sql.ErrNoRows if there's none */
+func (d *Database) GetActiveEvChargeRequest(ctx context.Context, now time.Time) (EvChargeRequestRow, error) {
+	row := d.read.QueryRowContext(ctx, `
+		SELECT id, energy, deadline, delivered, created
+		FROM ev_charge_request
+		WHERE cancelled = 0 AND deadline > ?
+		ORDER BY id DESC
+		LIMIT 1`,
+		now.Unix())
+
+	var r EvChargeRequestRow
+	var deadline, created int64
+	err := row.Scan(&r.Id, &r.Energy, &deadline, &r.Delivered, &created)
+	if err == sql.ErrNoRows {
+		return EvChargeRequestRow{}, sql.ErrNoRows
+	}
+	if err != nil {
+		return EvChargeRequestRow{}, fmt.Errorf("scanning ev charge request row: %w", err)
+	}
+	r.Deadline = time.Unix(deadline, 0)
+	r.Created = time.Unix(created, 0)
+
+	return r, nil
+}
+
+func (d *Database) AddEvChargeDelivered(ctx context.Context, id int64, kWh float64) error {
+	_, err := d.write.ExecContext(ctx, `
+		UPDATE ev_charge_request SET delivered = round(delivered + ?, 3) WHERE id = ?`,
+		kWh, id)
+	if err != nil {
+		return fmt.Errorf("adding delivered energy to ev charge request: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) SaveEvSession(ctx context.Context, row EvSessionRow) error {
+	var ended sql.NullInt64
+	if row.Ended.Valid {
+		ended = sql.NullInt64{Int64: row.Ended.Time.Unix(), Valid: true}
+	}
+
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO ev_session (started, ended, energy) VALUES (?, ?, ?)
+		ON CONFLICT(started) DO UPDATE SET
+			ended = excluded.ended,
+			energy = excluded.energy`,
+		row.Started.Unix(),
+		ended,
+		calc.RoundFloat64(row.Energy, 3))
+	if err != nil {
+		return fmt.Errorf("saving ev session: %w", err)
+	}
+	return nil
+}
+
+/** Returns the latest sessions, newest first */
+func (d *Database) GetEvSessions(ctx context.Context, limit int) ([]EvSessionRow, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT started, ended, energy
+		FROM ev_session
+		ORDER BY started DESC
+		LIMIT ?`,
+		limit)
+	if err != nil {
+		return nil, fmt.Errorf("fetching ev sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var res []EvSessionRow
+	for rows.Next() {
+		var row EvSessionRow
+		var started int64
+		var ended sql.NullInt64
+		if err := rows.Scan(&started, &ended, &row.Energy); err != nil {
+			return nil, fmt.Errorf("scanning ev session row: %w", err)
+		}
+		row.Started = time.Unix(started, 0)
+		if ended.Valid {
+			row.Ended = sql.NullTime{Time: time.Unix(ended.Int64, 0), Valid: true}
+		}
+		res = append(res, row)
+	}
+
+	return res, nil
+}
+
+func (d *Database) PurgeEvCharging(ctx context.Context, retentionDays int) error {
+	d.logger.Debug("purging ev charging")
+	before := time.Now().Add(-24 * time.Hour * time.Duration(retentionDays)).Unix()
+
+	if _, err := d.write.ExecContext(ctx, `DELETE FROM ev_session WHERE started < ?`, before); err != nil {
+		return fmt.Errorf("purging ev sessions: %w", err)
+	}
+	if _, err := d.write.ExecContext(ctx, `DELETE FROM ev_charge_request WHERE deadline < ?`, before); err != nil {
+		return fmt.Errorf("purging ev charge requests: %w", err)
+	}
+	return nil
+}
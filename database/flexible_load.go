@@ -0,0 +1,172 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+type FlexibleLoadRow struct {
+	Name    string
+	When    hours.DateHour
+	Planned sql.NullFloat64 // Hours planned to run, not valid if never planned
+	Actual  float64         // Hours actually run
+}
+
+type FlexibleLoadOverrideRow struct {
+	Name  string
+	On    bool      // Forced on, otherwise forced off
+	Until time.Time // When the load goes back to following the plan
+}
+
+func (d *Database) SaveFlexibleLoadPlan(ctx context.Context, name string, when hours.DateHour, planned float64) error {
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO flexible_load (name, date, hour, planned) VALUES (?, ?, ?, ?)
+		ON CONFLICT(name, date, hour) DO UPDATE SET planned = excluded.planned`,
+		name, when.Date, when.Hour, calc.RoundFloat64(planned, 3))
+	if err != nil {
+		return fmt.Errorf("saving flexible load plan: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) AddFlexibleLoadRunTime(ctx context.Context, name string, when hours.DateHour, runTime float64) error {
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO flexible_load (name, date, hour, actual) VALUES (?, ?, ?, round(?, 4))
+		ON CONFLICT(name, date, hour) DO UPDATE SET actual = round(actual + excluded.actual, 4)`,
+		name, when.Date, when.Hour, runTime)
+	if err != nil {
+		return fmt.Errorf("adding flexible load run time: %w", err)
+	}
+	return nil
+}
+
+/** Returns the row for the hour, or sql.ErrNoRows if the load has neither been planned nor run */
+func (d *Database) GetFlexibleLoad(ctx context.Context, name string, when hours.DateHour) (FlexibleLoadRow, error) {
+	row := d.read.QueryRowContext(ctx, `
+		SELECT name, date, hour, planned, actual
+		FROM flexible_load
+		WHERE name = ? AND date = ? AND hour = ?`,
+		name, when.Date, when.Hour)
+
+	var r FlexibleLoadRow
+	err := row.Scan(&r.Name, &r.When.Date, &r.When.Hour, &r.Planned, &r.Actual)
+	if err == sql.ErrNoRows {
+		return FlexibleLoadRow{}, sql.ErrNoRows
+	}
+	if err != nil {
+		return FlexibleLoadRow{}, fmt.Errorf("scanning flexible load row: %w", err)
+	}
+	return r, nil
+}
+
+/** Returns the hours the load has run from the start of the first hour until the start of the last hour */
+func (d *Database) GetFlexibleLoadRunTime(ctx context.Context, name string, from hours.DateHour, to hours.DateHour) (float64, error) {
+	row := d.read.QueryRowContext(ctx, `
+		SELECT coalesce(sum(actual), 0)
+		FROM flexible_load
+		WHERE name = ?
+			AND (date > ? OR (date = ? AND hour >= ?))
+			AND (date < ? OR (date = ? AND hour < ?))`,
+		name, from.Date, from.Date, from.Hour, to.Date, to.Date, to.Hour)
+
+	var runTime float64
+	if err := row.Scan(&runTime); err != nil {
+		return 0, fmt.Errorf("summing flexible load run time: %w", err)
+	}
+	return runTime, nil
+}
+
+func (d *Database) GetFlexibleLoadsFrom(ctx context.Context, from hours.DateHour) ([]FlexibleLoadRow, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT name, date, hour, planned, actual
+		FROM flexible_load
+		WHERE date > ? OR (date = ? AND hour >= ?)
+		ORDER BY date, hour, name`,
+		from.Date, from.Date, from.Hour)
+	if err != nil {
+		return nil, fmt.Errorf("fetching flexible loads from %s: %w", from, err)
+	}
+	defer rows.Close()
+
+	var res []FlexibleLoadRow
+	for rows.Next() {
+		var r FlexibleLoadRow
+		if err := rows.Scan(&r.Name, &r.When.Date, &r.When.Hour, &r.Planned, &r.Actual); err != nil {
+			return nil, fmt.Errorf("scanning flexible load row: %w", err)
+		}
+		res = append(res, r)
+	}
+
+	return res, nil
+}
+
+func (d *Database) SaveFlexibleLoadOverride(ctx context.Context, name string, on bool, until time.Time) error {
+	d.logger.Debug("saving flexible load override", "name", name, "on", on, "until", until)
+	mode := "off"
+	if on {
+		mode = "on"
+	}
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO flexible_load_override (name, mode, until) VALUES (?, ?, ?)
+		ON CONFLICT(name) DO UPDATE SET
+			mode = excluded.mode,
+			until = excluded.until,
+			created = strftime('%s','now')`,
+		name, mode, until.Unix())
+	if err != nil {
+		return fmt.Errorf("saving flexible load override: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) DeleteFlexibleLoadOverride(ctx context.Context, name string) error {
+	d.logger.Debug("deleting flexible load override", "name", name)
+	_, err := d.write.ExecContext(ctx, `DELETE FROM flexible_load_override WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("deleting flexible load override: %w", err)
+	}
+	return nil
+}
+
+/** Returns the overrides that haven't expired, by load name */
+func (d *Database) GetActiveFlexibleLoadOverrides(ctx context.Context, now time.Time) (map[string]FlexibleLoadOverrideRow, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT name, mode, until
+		FROM flexible_load_override
+		WHERE until > ?`,
+		now.Unix())
+	if err != nil {
+		return nil, fmt.Errorf("fetching flexible load overrides: %w", err)
+	}
+	defer rows.Close()
+
+	res := make(map[string]FlexibleLoadOverrideRow)
+	for rows.Next() {
+		var r FlexibleLoadOverrideRow
+		var mode string
+		var until int64
+		if err := rows.Scan(&r.Name, &mode, &until); err != nil {
+			return nil, fmt.Errorf("scanning flexible load override row: %w", err)
+		}
+		r.On = mode == "on"
+		r.Until = time.Unix(until, 0)
+		res[r.Name] = r
+	}
+
+	return res, nil
+}
+
+func (d *Database) PurgeFlexibleLoad(ctx context.Context, retentionDays int) error {
+	if err := d.purgeTable(ctx, "flexible_load", retentionDays); err != nil {
+		return err
+	}
+	if _, err := d.write.ExecContext(ctx, `DELETE FROM flexible_load_override WHERE until < ?`, time.Now().Unix()); err != nil {
+		return fmt.Errorf("purging flexible load overrides: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+// Forecasts further ahead than this are not stored as vintages,
+// they are rarely used and would make the vintage tables grow fast.
+const maxVintageHorizon = 48
+
+type ForecastQuantity string
+
+const (
+	ForecastProduction  ForecastQuantity = "production"
+	ForecastConsumption ForecastQuantity = "consumption"
+	ForecastEnergyPrice ForecastQuantity = "energy_price"
+	ForecastTemperature ForecastQuantity = "temperature"
+	ForecastCloudCover  ForecastQuantity = "cloud_cover"
+)
+
+var ForecastQuantities = []ForecastQuantity{
+	ForecastProduction,
+	ForecastConsumption,
+	ForecastEnergyPrice,
+	ForecastTemperature,
+	ForecastCloudCover,
+}
+
+type accuracyQuery struct {
+	from     string // Vintage table joined with the table holding the actual values
+	forecast string // Forecasted value column
+	actual   string // Actual value column
+}
+
+// Production and consumption are compared with what was measured, and estimated prices
+// with the published price. Weather is never observed, temperature and cloud cover in
+// time_series are the latest forecast for the hour, so their accuracy only tells how
+// much the forecast changed as the hour came closer.
+var accuracyQueries = map[ForecastQuantity]accuracyQuery{
+	ForecastProduction: {
+		from:     "energy_forecast_vintage v JOIN time_series a ON a.date = v.date AND a.hour = v.hour",
+		forecast: "v.production",
+		actual:   "a.production",
+	},
+	ForecastConsumption: {
+		from:     "energy_forecast_vintage v JOIN time_series a ON a.date = v.date AND a.hour = v.hour",
+		forecast: "v.consumption",
+		actual:   "a.consumption",
+	},
+	ForecastEnergyPrice: {
+		from:     "energy_price_vintage v JOIN energy_price a ON a.date = v.date AND a.hour = v.hour AND a.estimated = 0",
+		forecast: "v.price",
+		actual:   "a.price",
+	},
+	ForecastTemperature: {
+		from:     "weather_forecast_vintage v JOIN time_series a ON a.date = v.date AND a.hour = v.hour",
+		forecast: "v.temperature",
+		actual:   "a.temperature",
+	},
+	ForecastCloudCover: {
+		from:     "weather_forecast_vintage v JOIN time_series a ON a.date = v.date AND a.hour = v.hour",
+		forecast: "v.cloud_cover",
+		actual:   "a.cloud_cover",
+	},
+}
+
+type ForecastAccuracyRow struct {
+	Month   string // Month of the forecasted hour, e.g. "2025-06"
+	Horizon int    // Number of hours between when the forecast was issued and the forecasted hour
+	Samples int
+	MAE     float64         // Mean absolute error
+	Bias    float64         // Mean error (forecast - actual), positive means overestimated
+	MAPE    sql.NullFloat64 // Mean absolute percentage error, null if all actual values are zero
+}
+
+func ParseForecastQuantity(s string) (ForecastQuantity, bool) {
+	for _, q := range ForecastQuantities {
+		if strings.EqualFold(string(q), s) {
+			return q, true
+		}
+	}
+	return "", false
+}
+
+/** Stores a forecasted value together with the hour it was issued */
+func (d *Database) saveVintage(ctx context.Context, table string, when hours.DateHour, columns []string, values ...any) error {
+	issued := hours.FromNow()
+	horizon := issued.HoursUntil(when)
+	if horizon < 0 || horizon > maxVintageHorizon {
+		return nil
+	}
+
+	updates := make([]string, len(columns))
+	for i, c := range columns {
+		updates[i] = fmt.Sprintf("%s = excluded.%s", c, c)
+	}
+
+	args := append([]any{when.Date, when.Hour, issued.Date, issued.Hour, horizon}, values...)
+	_, err := d.write.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO %s (date, hour, issued_date, issued_hour, horizon, %s)
+		VALUES (?, ?, ?, ?, ?%s)
+		ON CONFLICT(date, hour, issued_date, issued_hour) DO UPDATE SET %s`,
+		table,
+		strings.Join(columns, ", "),
+		strings.Repeat(", ?", len(columns)),
+		strings.Join(updates, ", ")),
+		args...)
+	if err != nil {
+		return fmt.Errorf("saving %s: %w", table, err)
+	}
+
+	return nil
+}
+
+/**
+ * Returns forecast errors grouped per month and horizon for forecasted hours from the given date.
+ * Temperature and cloud cover are compared with the last forecast for the hour, not with observations.
+ */
+func (d *Database) GetForecastAccuracy(ctx context.Context, quantity ForecastQuantity, fromDate string) ([]ForecastAccuracyRow, error) {
+	q, ok := accuracyQueries[quantity]
+	if !ok {
+		return nil, fmt.Errorf("unknown forecast quantity: %s", quantity)
+	}
+
+	rows, err := d.read.QueryContext(ctx, fmt.Sprintf(`
+		SELECT
+			substr(v.date, 1, 7) AS month,
+			v.horizon,
+			count(*),
+			avg(abs(%[1]s - %[2]s)),
+			avg(%[1]s - %[2]s),
+			avg(CASE WHEN %[2]s != 0 THEN abs((%[1]s - %[2]s) / %[2]s) END) * 100
+		FROM %[3]s
+		WHERE v.date >= ?
+		GROUP BY month, v.horizon
+		ORDER BY month DESC, v.horizon ASC`,
+		q.forecast, q.actual, q.from),
+		fromDate)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s forecast accuracy: %w", quantity, err)
+	}
+	defer rows.Close()
+
+	var res []ForecastAccuracyRow
+	for rows.Next() {
+		var row ForecastAccuracyRow
+		err := rows.Scan(&row.Month, &row.Horizon, &row.Samples, &row.MAE, &row.Bias, &row.MAPE)
+		if err != nil {
+			return nil, fmt.Errorf("scanning forecast accuracy row: %w", err)
+		}
+		res = append(res, row)
+	}
+
+	return res, nil
+}
+
+func (d *Database) PurgeForecastVintage(ctx context.Context, retentionDays int) error {
+	for _, table := range []string{"weather_forecast_vintage", "energy_forecast_vintage", "energy_price_vintage"} {
+		if err := d.purgeTable(ctx, table, retentionDays); err != nil {
+			return err
+		}
+	}
+	return nil
+}
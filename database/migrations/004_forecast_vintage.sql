@@ -0,0 +1,32 @@
+CREATE TABLE weather_forecast_vintage (
+  date CHAR(10) NOT NULL,
+  hour INTEGER NOT NULL,
+  issued_date CHAR(10) NOT NULL,
+  issued_hour INTEGER NOT NULL,
+  horizon INTEGER NOT NULL,
+  cloud_cover INTEGER NOT NULL,
+  temperature REAL NOT NULL,
+  precipitation REAL NOT NULL,
+  CONSTRAINT weather_forecast_vintage_pk PRIMARY KEY (date, hour, issued_date, issued_hour)
+);
+
+CREATE TABLE energy_forecast_vintage (
+  date CHAR(10) NOT NULL,
+  hour INTEGER NOT NULL,
+  issued_date CHAR(10) NOT NULL,
+  issued_hour INTEGER NOT NULL,
+  horizon INTEGER NOT NULL,
+  production REAL NOT NULL,
+  consumption REAL NOT NULL,
+  CONSTRAINT energy_forecast_vintage_pk PRIMARY KEY (date, hour, issued_date, issued_hour)
+);
+
+CREATE TABLE energy_price_vintage (
+  date CHAR(10) NOT NULL,
+  hour INTEGER NOT NULL,
+  issued_date CHAR(10) NOT NULL,
+  issued_hour INTEGER NOT NULL,
+  horizon INTEGER NOT NULL,
+  price REAL NOT NULL,
+  CONSTRAINT energy_price_vintage_pk PRIMARY KEY (date, hour, issued_date, issued_hour)
+);
@@ -0,0 +1,2 @@
+ALTER TABLE weather_forecast ADD COLUMN solar_radiation REAL;
+ALTER TABLE weather_forecast_vintage ADD COLUMN solar_radiation REAL;
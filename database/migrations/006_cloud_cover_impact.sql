@@ -0,0 +1,13 @@
+CREATE TABLE cloud_cover_impact (
+  season TEXT NOT NULL,
+  impact REAL NOT NULL,
+  samples INTEGER NOT NULL,
+  created INTEGER(4) NOT NULL DEFAULT (strftime('%s','now')),
+  updated INTEGER(4) NOT NULL DEFAULT (strftime('%s','now')),
+  CONSTRAINT cloud_cover_impact_pk PRIMARY KEY (season)
+);
+CREATE TRIGGER cloud_cover_impact_updated AFTER UPDATE ON cloud_cover_impact
+BEGIN
+  UPDATE cloud_cover_impact SET updated = (strftime('%s','now'))
+  WHERE rowid = NEW.rowid;
+END;
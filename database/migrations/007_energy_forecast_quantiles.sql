@@ -0,0 +1,4 @@
+ALTER TABLE energy_forecast ADD COLUMN production_p10 REAL NOT NULL DEFAULT 0;
+ALTER TABLE energy_forecast ADD COLUMN production_p90 REAL NOT NULL DEFAULT 0;
+ALTER TABLE energy_forecast ADD COLUMN consumption_p10 REAL NOT NULL DEFAULT 0;
+ALTER TABLE energy_forecast ADD COLUMN consumption_p90 REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+-- Prices stored before currencies were configurable are all in SEK
+ALTER TABLE energy_price ADD COLUMN currency TEXT NOT NULL DEFAULT 'SEK';
@@ -0,0 +1 @@
+ALTER TABLE energy_price ADD COLUMN provider TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+-- Estimated prices fill the hours before the day-ahead prices are published
+ALTER TABLE energy_price ADD COLUMN estimated INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- Expected battery level when the hour (or an intra-hour replan) starts and when it ends
+ALTER TABLE planning ADD COLUMN battery_level_from REAL;
+ALTER TABLE planning ADD COLUMN battery_level_to REAL;
@@ -0,0 +1,26 @@
+-- What the user needs charged, e.g. 30 kWh by 07:00, only the latest request is active
+CREATE TABLE ev_charge_request (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  energy REAL NOT NULL,
+  deadline INTEGER(4) NOT NULL,
+  delivered REAL NOT NULL DEFAULT 0,
+  cancelled INTEGER NOT NULL DEFAULT 0,
+  created INTEGER(4) NOT NULL DEFAULT (strftime('%s','now')),
+  updated INTEGER(4) NOT NULL DEFAULT (strftime('%s','now'))
+);
+CREATE TRIGGER ev_charge_request_updated AFTER UPDATE ON ev_charge_request
+BEGIN
+  UPDATE ev_charge_request SET updated = (strftime('%s','now'))
+  WHERE rowid = NEW.rowid;
+END;
+
+-- From when a vehicle is connected until it's disconnected
+CREATE TABLE ev_session (
+  started INTEGER(4) NOT NULL,
+  ended INTEGER(4),
+  energy REAL NOT NULL DEFAULT 0,
+  CONSTRAINT ev_session_pk PRIMARY KEY (started)
+);
+
+-- Energy in kWh planned for charging the EV
+ALTER TABLE planning ADD COLUMN ev_charge REAL;
@@ -0,0 +1,18 @@
+-- Run time in hours planned and actually run for each flexible load, e.g. a water heater
+CREATE TABLE flexible_load (
+  name TEXT NOT NULL,
+  date TEXT NOT NULL,
+  hour INTEGER NOT NULL,
+  planned REAL,
+  actual REAL NOT NULL DEFAULT 0,
+  CONSTRAINT flexible_load_pk PRIMARY KEY (name, date, hour)
+);
+
+-- A load forced on or off by hand until a point in time, instead of following the plan
+CREATE TABLE flexible_load_override (
+  name TEXT NOT NULL,
+  mode TEXT NOT NULL,
+  until INTEGER(4) NOT NULL,
+  created INTEGER(4) NOT NULL DEFAULT (strftime('%s','now')),
+  CONSTRAINT flexible_load_override_pk PRIMARY KEY (name)
+);
@@ -0,0 +1,5 @@
+ALTER TABLE weather_forecast ADD COLUMN wind_gust REAL;
+ALTER TABLE weather_forecast_vintage ADD COLUMN wind_gust REAL;
+
+-- Battery level in percentage kept for outages, not valid when only the minimum level applies
+ALTER TABLE planning ADD COLUMN reserve REAL;
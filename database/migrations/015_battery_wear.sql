@@ -0,0 +1,15 @@
+-- Battery usage and estimated wear per hour, kept for the lifetime of the battery
+CREATE TABLE battery_wear (
+  date TEXT NOT NULL,
+  hour INTEGER NOT NULL,
+  charged REAL NOT NULL DEFAULT 0,
+  discharged REAL NOT NULL DEFAULT 0,
+  wear REAL NOT NULL DEFAULT 0,
+  temperature REAL,
+  samples INTEGER NOT NULL DEFAULT 0,
+  cycles REAL NOT NULL DEFAULT 0,
+  level REAL NOT NULL DEFAULT 0,
+  cycle_start REAL NOT NULL DEFAULT 0,
+  cycle_charging INTEGER NOT NULL DEFAULT 0,
+  CONSTRAINT battery_wear_pk PRIMARY KEY (date, hour)
+);
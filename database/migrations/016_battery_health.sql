@@ -0,0 +1,17 @@
+-- State of health and rated capacity in kWh reported by each battery module per day
+CREATE TABLE battery_module_health (
+  date TEXT NOT NULL,
+  module TEXT NOT NULL,
+  soh REAL NOT NULL,
+  rated_capacity REAL NOT NULL,
+  CONSTRAINT battery_module_health_pk PRIMARY KEY (date, module)
+);
+
+-- Energy in kWh charged or discharged over a change in battery level in percentage, used to
+-- estimate the usable capacity
+CREATE TABLE battery_capacity_estimate (
+  time INTEGER(4) NOT NULL,
+  charging INTEGER NOT NULL,
+  depth REAL NOT NULL,
+  energy REAL NOT NULL
+);
@@ -0,0 +1,10 @@
+-- Battery power in kW commanded and delivered while forced to charge or discharge, summed by
+-- range of battery level in percentage, used to learn how the power tapers near full and empty
+CREATE TABLE battery_power_by_level (
+  level REAL NOT NULL,
+  charging INTEGER NOT NULL,
+  commanded REAL NOT NULL,
+  delivered REAL NOT NULL,
+  samples INTEGER NOT NULL,
+  CONSTRAINT battery_power_by_level_pk PRIMARY KEY (level, charging)
+);
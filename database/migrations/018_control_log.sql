@@ -0,0 +1,20 @@
+-- Every instruction sent to the battery, why it was sent and how the ESO answered
+CREATE TABLE control_log (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  timestamp TEXT NOT NULL,
+  date TEXT NOT NULL,
+  hour INTEGER NOT NULL,
+  action TEXT NOT NULL,
+  power REAL NOT NULL,
+  strategy TEXT NOT NULL,
+  reason TEXT NOT NULL,
+  trans_id TEXT NOT NULL,
+  status TEXT NOT NULL,
+  message TEXT NOT NULL,
+  latency REAL
+);
+CREATE INDEX control_log_date_hour ON control_log (date, hour);
+
+-- Commands sent to the battery during the hour and minutes it followed the plan
+ALTER TABLE time_series ADD COLUMN control_commands INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE time_series ADD COLUMN plan_followed REAL NOT NULL DEFAULT 0;
@@ -0,0 +1,19 @@
+-- What lowered the power of an instruction below what the strategy asked for, e.g. the grid fuse
+ALTER TABLE control_log ADD COLUMN limited TEXT NOT NULL DEFAULT '';
+
+-- How well the battery followed the plan for each hour. Energy is in kWh, positive when
+-- discharging like the battery net load, and time in minutes.
+CREATE TABLE plan_adherence (
+  date TEXT NOT NULL,
+  hour INTEGER NOT NULL,
+  strategy TEXT NOT NULL,
+  commanded REAL NOT NULL,
+  actual REAL NOT NULL,
+  auto_minutes REAL NOT NULL,
+  charge_minutes REAL NOT NULL,
+  discharge_minutes REAL NOT NULL,
+  level_target REAL,
+  level REAL NOT NULL,
+  causes TEXT NOT NULL,
+  CONSTRAINT plan_adherence_pk PRIMARY KEY (date, hour)
+);
@@ -0,0 +1,12 @@
+-- What the energy for each hour cost, and what it would have cost without the battery and with
+-- a battery only storing the own production, positive when paying. Kept beyond the time series
+-- so savings can be summed by month and year.
+CREATE TABLE savings (
+  date TEXT NOT NULL,
+  hour INTEGER NOT NULL,
+  actual REAL NOT NULL,
+  no_battery REAL NOT NULL,
+  self_consumption REAL NOT NULL,
+  self_consumption_level REAL NOT NULL,
+  CONSTRAINT savings_pk PRIMARY KEY (date, hour)
+);
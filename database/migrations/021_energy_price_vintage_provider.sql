@@ -0,0 +1,4 @@
+-- Only estimated prices are forecasts, vintages of published prices always matched themselves.
+-- The provider tells which estimator made the forecast.
+DELETE FROM energy_price_vintage;
+ALTER TABLE energy_price_vintage ADD COLUMN provider TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+// How well the battery followed the plan for an hour
+type PlanAdherenceRow struct {
+	When             hours.DateHour
+	Strategy         string          // Planned strategy for the hour, empty if there was no plan
+	Commanded        float64         // Energy in kWh the battery was commanded to discharge, negative when charging, auto isn't counted
+	Actual           float64         // Energy in kWh the battery discharged, negative when charging
+	AutoMinutes      float64         // Minutes the battery was left to the ESO
+	ChargeMinutes    float64         // Minutes the battery was commanded to charge
+	DischargeMinutes float64         // Minutes the battery was commanded to discharge
+	LevelTarget      sql.NullFloat64 // Planned battery level in percentage at the end of the hour, not valid without a plan
+	Level            float64         // Battery level in percentage at the end of the hour
+	Causes           string          // Why the battery didn't follow the plan, comma separated, empty if it did
+}
+
+func (r PlanAdherenceRow) Diverged() bool {
+	return r.Causes != ""
+}
+
+func (d *Database) SavePlanAdherence(ctx context.Context, r PlanAdherenceRow) error {
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO plan_adherence (date, hour, strategy, commanded, actual, auto_minutes, charge_minutes, discharge_minutes, level_target, level, causes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(date, hour) DO UPDATE SET
+			strategy = excluded.strategy,
+			commanded = excluded.commanded,
+			actual = excluded.actual,
+			auto_minutes = excluded.auto_minutes,
+			charge_minutes = excluded.charge_minutes,
+			discharge_minutes = excluded.discharge_minutes,
+			level_target = excluded.level_target,
+			level = excluded.level,
+			causes = excluded.causes`,
+		r.When.Date,
+		r.When.Hour,
+		r.Strategy,
+		calc.RoundFloat64(r.Commanded, 3),
+		calc.RoundFloat64(r.Actual, 3),
+		calc.RoundFloat64(r.AutoMinutes, 1),
+		calc.RoundFloat64(r.ChargeMinutes, 1),
+		calc.RoundFloat64(r.DischargeMinutes, 1),
+		r.LevelTarget,
+		r.Level,
+		r.Causes)
+	if err != nil {
+		return fmt.Errorf("saving plan adherence: %w", err)
+	}
+	return nil
+}
+
+/** Returns the most recent hours first, only the ones that diverged from the plan if asked to */
+func (d *Database) GetPlanAdherence(ctx context.Context, page, pageSize int, divergedOnly bool) ([]PlanAdherenceRow, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT date, hour, strategy, commanded, actual, auto_minutes, charge_minutes, discharge_minutes, level_target, level, causes
+		FROM plan_adherence
+		WHERE causes != '' OR NOT ?
+		ORDER BY date DESC, hour DESC
+		LIMIT ? OFFSET ?`,
+		divergedOnly, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("fetching plan adherence: %w", err)
+	}
+	defer rows.Close()
+
+	var res []PlanAdherenceRow
+	for rows.Next() {
+		var r PlanAdherenceRow
+		err := rows.Scan(&r.When.Date, &r.When.Hour, &r.Strategy, &r.Commanded, &r.Actual,
+			&r.AutoMinutes, &r.ChargeMinutes, &r.DischargeMinutes, &r.LevelTarget, &r.Level, &r.Causes)
+		if err != nil {
+			return nil, fmt.Errorf("scanning plan adherence: %w", err)
+		}
+		res = append(res, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading plan adherence rows: %w", err)
+	}
+
+	return res, nil
+}
+
+func (d *Database) PurgePlanAdherence(ctx context.Context, retentionDays int) error {
+	return d.purgeTable(ctx, "plan_adherence", retentionDays)
+}
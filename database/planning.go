@@ -4,18 +4,25 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"time"
 
 	"github.com/icodeforyou/solarplant-go/hours"
 )
 
 type PlanningRow struct {
-	When     hours.DateHour
-	Strategy string
+	When             hours.DateHour
+	Strategy         string
+	BatteryLevelFrom sql.NullFloat64 // Expected battery level in percentage when the plan for the hour starts
+	BatteryLevelTo   sql.NullFloat64 // Expected battery level in percentage at the end of the hour
+	EvCharge         sql.NullFloat64 // Energy in kWh planned for charging the EV, not valid without a charger
+	Reserve          sql.NullFloat64 // Battery level in percentage kept for outages, not valid if no reserve applies
+	Updated          time.Time       // When the plan for the hour was last saved
 }
 
 type DetailedPlanningRow struct {
 	PlanningRow
 	EnergyPrice          sql.NullFloat64
+	EnergyPriceEstimated sql.NullBool
 	ProductionEstimated  sql.NullFloat64
 	ConsumptionEstimated sql.NullFloat64
 	CloudCover           sql.NullInt16
@@ -26,15 +33,28 @@ type DetailedPlanningRow struct {
 func (d *Database) SavePanning(ctx context.Context, row PlanningRow) error {
 	d.logger.Debug("saving planning",
 		"hour", row.When,
-		"strategy", row.Strategy)
+		"strategy", row.Strategy,
+		"battLvlFrom", row.BatteryLevelFrom.Float64,
+		"battLvlTo", row.BatteryLevelTo.Float64,
+		"evCharge", row.EvCharge.Float64,
+		"reserve", row.Reserve.Float64)
 
 	_, err := d.write.ExecContext(ctx, `
-		INSERT INTO planning (date, hour, strategy)
-		VALUES (?, ?, ?) 
-		ON CONFLICT(date, hour) DO UPDATE SET strategy = excluded.strategy;`,
+		INSERT INTO planning (date, hour, strategy, battery_level_from, battery_level_to, ev_charge, reserve)
+		VALUES (?, ?, ?, ?, ?, ?, ?) 
+		ON CONFLICT(date, hour) DO UPDATE SET 
+			strategy = excluded.strategy,
+			battery_level_from = excluded.battery_level_from,
+			battery_level_to = excluded.battery_level_to,
+			ev_charge = excluded.ev_charge,
+			reserve = excluded.reserve;`,
 		row.When.Date,
 		row.When.Hour,
 		row.Strategy,
+		row.BatteryLevelFrom,
+		row.BatteryLevelTo,
+		row.EvCharge,
+		row.Reserve,
 	)
 	if err != nil {
 		return fmt.Errorf("saving planning row: %w", err)
@@ -44,19 +64,21 @@ func (d *Database) SavePanning(ctx context.Context, row PlanningRow) error {
 
 func (d *Database) GetPlanning(ctx context.Context, dh hours.DateHour) (PlanningRow, error) {
 	row := d.read.QueryRowContext(ctx, `
-		SELECT date, hour, strategy
+		SELECT date, hour, strategy, battery_level_from, battery_level_to, ev_charge, reserve, updated
 		FROM planning
 		WHERE date = ? AND hour = ?`,
 		dh.Date, dh.Hour)
 
 	var pl PlanningRow
-	err := row.Scan(&pl.When.Date, &pl.When.Hour, &pl.Strategy)
+	var updated int64
+	err := row.Scan(&pl.When.Date, &pl.When.Hour, &pl.Strategy, &pl.BatteryLevelFrom, &pl.BatteryLevelTo, &pl.EvCharge, &pl.Reserve, &updated)
 	if err == sql.ErrNoRows {
 		return PlanningRow{}, sql.ErrNoRows
 	}
 	if err != nil {
 		return PlanningRow{}, fmt.Errorf("scanning planning row: %w", err)
 	}
+	pl.Updated = time.Unix(updated, 0)
 
 	return pl, nil
 }
@@ -92,7 +114,10 @@ func (d *Database) GetDetailedPlanningFrom(ctx context.Context, dh hours.DateHou
 			pl.date, 
 			pl.hour, 
 			pl.strategy, 
+			pl.ev_charge,
+			pl.reserve,
 			ep.price as energy_price, 
+			ep.estimated as energy_price_estimated,
 			ef.production as production_estimated,
 			ef.consumption as consumption_estimated,	
 			wf.cloud_cover,		
@@ -117,7 +142,10 @@ func (d *Database) GetDetailedPlanningFrom(ctx context.Context, dh hours.DateHou
 			&row.When.Date,
 			&row.When.Hour,
 			&row.Strategy,
+			&row.EvCharge,
+			&row.Reserve,
 			&row.EnergyPrice,
+			&row.EnergyPriceEstimated,
 			&row.ProductionEstimated,
 			&row.ConsumptionEstimated,
 			&row.CloudCover,
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+// What the energy for an hour cost and what it would have cost with the baselines,
+// positive when paying
+type SavingsRow struct {
+	When                 hours.DateHour
+	Actual               float64
+	NoBattery            float64 // Without a battery
+	SelfConsumption      float64 // With a battery only storing the own production
+	SelfConsumptionLevel float64 // Level of the self-consumption battery in percentage at the end of the hour
+}
+
+// Periods savings are summed by
+type SavingsPeriod string
+
+const (
+	SavingsByDay   SavingsPeriod = "day"
+	SavingsByMonth SavingsPeriod = "month"
+	SavingsByYear  SavingsPeriod = "year"
+)
+
+// Length of the date prefix, e.g. 2025-06, that groups the hours of a period
+var savingsPeriodLength = map[SavingsPeriod]int{
+	SavingsByDay:   10,
+	SavingsByMonth: 7,
+	SavingsByYear:  4,
+}
+
+var SavingsPeriods = []SavingsPeriod{SavingsByDay, SavingsByMonth, SavingsByYear}
+
+func ParseSavingsPeriod(s string) (SavingsPeriod, bool) {
+	for _, p := range SavingsPeriods {
+		if strings.EqualFold(string(p), s) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// Costs summed over a day, month or year
+type SavingsSummary struct {
+	Period          string // The date, e.g. 2025-06-01, the month, e.g. 2025-06, or the year
+	Actual          float64
+	NoBattery       float64
+	SelfConsumption float64
+	Hours           int
+}
+
+// What the battery saved compared to not having one
+func (s SavingsSummary) BatterySavings() float64 {
+	return s.NoBattery - s.Actual
+}
+
+// What planning the battery by price saved compared to only storing the own production
+func (s SavingsSummary) OptimizerSavings() float64 {
+	return s.SelfConsumption - s.Actual
+}
+
+func (d *Database) SaveSavings(ctx context.Context, r SavingsRow) error {
+	_, err := d.write.ExecContext(ctx, `
+		INSERT INTO savings (date, hour, actual, no_battery, self_consumption, self_consumption_level)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT(date, hour) DO UPDATE SET
+			actual = excluded.actual,
+			no_battery = excluded.no_battery,
+			self_consumption = excluded.self_consumption,
+			self_consumption_level = excluded.self_consumption_level`,
+		r.When.Date,
+		r.When.Hour,
+		r.Actual,
+		r.NoBattery,
+		r.SelfConsumption,
+		r.SelfConsumptionLevel)
+	if err != nil {
+		return fmt.Errorf("saving savings: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) GetLatestSavings(ctx context.Context) (SavingsRow, error) {
+	row := d.read.QueryRowContext(ctx, `
+		SELECT date, hour, actual, no_battery, self_consumption, self_consumption_level
+		FROM savings
+		ORDER BY date DESC, hour DESC
+		LIMIT 1`)
+
+	var r SavingsRow
+	err := row.Scan(&r.When.Date, &r.When.Hour, &r.Actual, &r.NoBattery, &r.SelfConsumption, &r.SelfConsumptionLevel)
+	if err == sql.ErrNoRows {
+		return SavingsRow{}, sql.ErrNoRows
+	}
+	if err != nil {
+		return SavingsRow{}, fmt.Errorf("scanning savings row: %w", err)
+	}
+	return r, nil
+}
+
+/** Returns the costs summed by period, most recent first */
+func (d *Database) GetSavingsSummary(ctx context.Context, period SavingsPeriod, limit int) ([]SavingsSummary, error) {
+	length, ok := savingsPeriodLength[period]
+	if !ok {
+		return nil, fmt.Errorf("unknown savings period %q", period)
+	}
+
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT substr(date, 1, ?) AS period, sum(actual), sum(no_battery), sum(self_consumption), count(*)
+		FROM savings
+		GROUP BY period
+		ORDER BY period DESC
+		LIMIT ?`,
+		length, limit)
+	if err != nil {
+		return nil, fmt.Errorf("fetching savings by %s: %w", period, err)
+	}
+	defer rows.Close()
+
+	var res []SavingsSummary
+	for rows.Next() {
+		var s SavingsSummary
+		if err := rows.Scan(&s.Period, &s.Actual, &s.NoBattery, &s.SelfConsumption, &s.Hours); err != nil {
+			return nil, fmt.Errorf("scanning savings summary: %w", err)
+		}
+		res = append(res, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading savings summary rows: %w", err)
+	}
+
+	return res, nil
+}
@@ -25,6 +25,8 @@ type TimeSeriesRow struct {
 	BatteryNetLoad       float64
 	CashFlow             float64
 	Strategy             string
+	ControlCommands      int     // Instructions sent to the battery during the hour
+	PlanFollowed         float64 // Minutes the battery was instructed as planned and the ESO acknowledged it
 }
 
 type DailyStats struct {
@@ -40,6 +42,7 @@ type DailyStats struct {
 	TotGridImport    float64
 	TotGridExport    float64
 	TotCashFlow      float64
+	SelfSufficiency  sql.NullFloat64 // Share of the consumption not bought from the grid in percentage
 }
 
 func (d *Database) SaveTimeSeries(ctx context.Context, row TimeSeriesRow) error {
@@ -59,7 +62,9 @@ func (d *Database) SaveTimeSeries(ctx context.Context, row TimeSeriesRow) error
 		"battery_level", row.BatteryLevel,
 		"battery_net_load", row.BatteryNetLoad,
 		"cash_flow", row.CashFlow,
-		"strategy", row.Strategy)
+		"strategy", row.Strategy,
+		"control_commands", row.ControlCommands,
+		"plan_followed", row.PlanFollowed)
 
 	_, err := d.write.ExecContext(ctx, `
 		INSERT INTO time_series (
@@ -79,9 +84,11 @@ func (d *Database) SaveTimeSeries(ctx context.Context, row TimeSeriesRow) error
 			battery_level,
 			battery_net_load,
 			cash_flow,
-			strategy
+			strategy,
+			control_commands,
+			plan_followed
 		)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		row.When.Date,
 		row.When.Hour,
 		row.CloudCover,
@@ -99,6 +106,8 @@ func (d *Database) SaveTimeSeries(ctx context.Context, row TimeSeriesRow) error
 		row.BatteryNetLoad,
 		row.CashFlow,
 		row.Strategy,
+		row.ControlCommands,
+		row.PlanFollowed,
 	)
 
 	if err != nil {
@@ -128,7 +137,9 @@ func (d *Database) GetTimeSeriesForHour(ctx context.Context, dh hours.DateHour)
 			battery_level, 
 			battery_net_load,
 			cash_flow,
-			strategy
+			strategy,
+			control_commands,
+			plan_followed
 		FROM time_series
 		WHERE date >= ? AND hour = ?
 		ORDER BY date, hour ASC`,
@@ -166,7 +177,9 @@ func (d *Database) GetTimeSeriesFrom(ctx context.Context, dh hours.DateHour) ([]
 			battery_level, 
 			battery_net_load,
 			cash_flow,
-			strategy
+			strategy,
+			control_commands,
+			plan_followed
 		FROM time_series
 		WHERE (date >= ? AND hour >= ?) OR (date > ?)
 		ORDER BY date DESC, hour DESC`,
@@ -206,7 +219,9 @@ func scanTimeSeriesHours(rows *sql.Rows) ([]TimeSeriesRow, error) {
 			&t.BatteryLevel,
 			&t.BatteryNetLoad,
 			&t.CashFlow,
-			&t.Strategy)
+			&t.Strategy,
+			&t.ControlCommands,
+			&t.PlanFollowed)
 		if err != nil {
 			return nil, err
 		}
@@ -231,7 +246,8 @@ func (d *Database) GetDailyStats(ctx context.Context, noOfDays int) ([]DailyStat
 			avg(consumption-consumption_estimated),
 			sum(grid_import),
 			sum(grid_export),
-			sum(cash_flow)
+			sum(cash_flow),
+			CASE WHEN sum(consumption) > 0 THEN max(1 - sum(grid_import) / sum(consumption), 0) * 100 END
 		FROM time_series
 		GROUP BY date
 		ORDER BY date DESC
@@ -258,7 +274,8 @@ func (d *Database) GetDailyStats(ctx context.Context, noOfDays int) ([]DailyStat
 			&ds.DiffConsumption,
 			&ds.TotGridImport,
 			&ds.TotGridExport,
-			&ds.TotCashFlow)
+			&ds.TotCashFlow,
+			&ds.SelfSufficiency)
 		if err != nil {
 			return []DailyStats{}, fmt.Errorf("scanning daily stats: %w", err)
 		}
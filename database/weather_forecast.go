@@ -14,6 +14,10 @@ type WeatherForecastRow struct {
 	CloudCover    uint8
 	Temperature   float64
 	Precipitation float64
+	// Global horizontal irradiance (W/m²), only available from some providers
+	SolarRadiation sql.NullFloat64
+	// Strongest wind gust (m/s), not valid if the provider doesn't forecast it
+	WindGust sql.NullFloat64
 }
 
 func (d *Database) SaveForecast(ctx context.Context, rows []WeatherForecastRow) error {
@@ -22,7 +26,9 @@ func (d *Database) SaveForecast(ctx context.Context, rows []WeatherForecastRow)
 			"hour", row.When,
 			"cloud_cover", row.CloudCover,
 			"temperature", row.Temperature,
-			"precipitation", row.Precipitation)
+			"precipitation", row.Precipitation,
+			"solar_radiation", row.SolarRadiation,
+			"wind_gust", row.WindGust)
 
 		_, err := d.write.ExecContext(ctx, `
 		INSERT INTO weather_forecast (
@@ -30,20 +36,37 @@ func (d *Database) SaveForecast(ctx context.Context, rows []WeatherForecastRow)
 			hour, 
 			cloud_cover, 
 			temperature,
-			precipitation
-		) VALUES (?, ?, ?, ?, ?)
+			precipitation,
+			solar_radiation,
+			wind_gust
+		) VALUES (?, ?, ?, ?, ?, ?, ?)
 		ON CONFLICT(date, hour) DO UPDATE SET
     	cloud_cover = excluded.cloud_cover,
     	temperature = excluded.temperature,
-			precipitation = excluded.precipitation`,
+			precipitation = excluded.precipitation,
+			solar_radiation = excluded.solar_radiation,
+			wind_gust = excluded.wind_gust`,
 			row.When.Date,
 			row.When.Hour,
 			row.CloudCover,
 			calc.TwoDecimals(row.Temperature),
-			calc.TwoDecimals(row.Precipitation))
+			calc.TwoDecimals(row.Precipitation),
+			row.SolarRadiation,
+			row.WindGust)
 		if err != nil {
 			return fmt.Errorf("saving weather forecast: %w", err)
 		}
+
+		err = d.saveVintage(ctx, "weather_forecast_vintage", row.When,
+			[]string{"cloud_cover", "temperature", "precipitation", "solar_radiation", "wind_gust"},
+			row.CloudCover,
+			calc.TwoDecimals(row.Temperature),
+			calc.TwoDecimals(row.Precipitation),
+			row.SolarRadiation,
+			row.WindGust)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -51,13 +74,13 @@ func (d *Database) SaveForecast(ctx context.Context, rows []WeatherForecastRow)
 
 func (d *Database) GetWeatherForecast(ctx context.Context, dh hours.DateHour) (WeatherForecastRow, error) {
 	row := d.read.QueryRowContext(ctx, `
-		SELECT date, hour, cloud_cover, temperature, precipitation
+		SELECT date, hour, cloud_cover, temperature, precipitation, solar_radiation, wind_gust
 		FROM weather_forecast 
 		WHERE date = ? AND hour = ?`,
 		dh.Date, dh.Hour)
 
 	var fc WeatherForecastRow
-	err := row.Scan(&fc.When.Date, &fc.When.Hour, &fc.CloudCover, &fc.Temperature, &fc.Precipitation)
+	err := row.Scan(&fc.When.Date, &fc.When.Hour, &fc.CloudCover, &fc.Temperature, &fc.Precipitation, &fc.SolarRadiation, &fc.WindGust)
 	if err == sql.ErrNoRows {
 		return WeatherForecastRow{}, sql.ErrNoRows
 	}
@@ -70,7 +93,7 @@ func (d *Database) GetWeatherForecast(ctx context.Context, dh hours.DateHour) (W
 
 func (d *Database) GetWeatherForecastFrom(ctx context.Context, dh hours.DateHour) ([]WeatherForecastRow, error) {
 	rows, err := d.read.QueryContext(ctx, `
-		SELECT date, hour, cloud_cover, temperature, precipitation
+		SELECT date, hour, cloud_cover, temperature, precipitation, solar_radiation, wind_gust
 		FROM weather_forecast 
 		WHERE (date = ? AND hour >= ?) OR date > ?`,
 		dh.Date, dh.Hour, dh.Date)
@@ -88,7 +111,9 @@ func (d *Database) GetWeatherForecastFrom(ctx context.Context, dh hours.DateHour
 			&row.When.Hour,
 			&row.CloudCover,
 			&row.Temperature,
-			&row.Precipitation)
+			&row.Precipitation,
+			&row.SolarRadiation,
+			&row.WindGust)
 		if err != nil {
 			return nil, fmt.Errorf("scanning weather forecast row: %w", err)
 		}
@@ -0,0 +1,42 @@
+package degradation
+
+import "math"
+
+// Follows the half cycle the battery is in, i.e. how far it has been charged or discharged
+// since it last changed direction
+type Cycle struct {
+	Start    float64 // Battery level in percentage where the half cycle began
+	Level    float64 // Current battery level in percentage
+	Charging bool
+	started  bool
+}
+
+func NewCycle(start, level float64, charging bool) Cycle {
+	return Cycle{Start: start, Level: level, Charging: charging, started: true}
+}
+
+func (c Cycle) Started() bool {
+	return c.started
+}
+
+// Moves to a new battery level and returns the depths, as fractions of the capacity, that the
+// half cycle is extended from and to. A change of direction begins a new half cycle.
+func (c *Cycle) Step(level float64) (float64, float64) {
+	if !c.started {
+		*c = NewCycle(level, level, false)
+		return 0, 0
+	}
+	if level == c.Level {
+		return 0, 0
+	}
+
+	charging := level > c.Level
+	if charging != c.Charging {
+		c.Start = c.Level
+		c.Charging = charging
+	}
+	from := math.Abs(c.Level-c.Start) / 100
+	to := math.Abs(level-c.Start) / 100
+	c.Level = level
+	return from, to
+}
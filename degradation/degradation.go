@@ -0,0 +1,103 @@
+package degradation
+
+import (
+	"math"
+
+	"github.com/icodeforyou/solarplant-go/config"
+)
+
+// Conditions the configured degradation cost and cycle life are given for
+const (
+	ReferenceTemperature = 25.0 // Cell temperature in °C
+	ReferenceCRate       = 0.5  // Charge or discharge power relative to the capacity
+)
+
+// Cell temperature below which charging plates lithium and wears the cells faster
+const coldChargeTemperature = 15.0
+
+// Estimates how much a battery wears from how deep, how fast and at what temperature it's cycled.
+// Wear is counted in equivalent full cycles at reference conditions, i.e. a full charge and
+// discharge at 25 °C and 0.5 C wears the battery by 1.
+type Model struct {
+	Capacity      float64 // Battery capacity in kWh
+	CostPerKWh    float64 // Cost per kWh charged or discharged in full cycles at reference conditions
+	CycleLife     float64 // Full cycles at reference conditions until the battery is worn out
+	DepthExponent float64 // How much harder deep cycles wear than shallow ones, 1 makes wear proportional to energy
+}
+
+func New(spec config.AppConfigBatterySpec) Model {
+	return Model{
+		Capacity:      spec.Capacity,
+		CostPerKWh:    spec.DegradationCost,
+		CycleLife:     spec.GetCycleLife(),
+		DepthExponent: spec.GetDepthExponent(),
+	}
+}
+
+// Wear of extending a half cycle from one depth to another, where depths are fractions of the
+// capacity since the half cycle began. The battery is charged or discharged with power kW at
+// a cell temperature in °C.
+func (m Model) Wear(fromDepth, toDepth, power, temperature float64, charging bool) float64 {
+	if toDepth <= fromDepth {
+		return 0
+	}
+	// A half cycle of depth d wears d^k/2, so shallow cycles wear less per kWh than deep ones
+	depthWear := (m.depthPower(toDepth) - m.depthPower(fromDepth)) / 2
+	return depthWear * TemperatureFactor(temperature, charging) * m.CRateFactor(power)
+}
+
+// The depth raised to the depth exponent, the optimizer calls this for every hour of every
+// permutation so common exponents avoid math.Pow
+func (m Model) depthPower(depth float64) float64 {
+	switch m.DepthExponent {
+	case 1:
+		return depth
+	case 1.5:
+		return depth * math.Sqrt(depth)
+	case 2:
+		return depth * depth
+	default:
+		return math.Pow(depth, m.DepthExponent)
+	}
+}
+
+// Cost of the wear in the configured currency
+func (m Model) Cost(wear float64) float64 {
+	return wear * 2 * m.Capacity * m.CostPerKWh
+}
+
+// Share of the cycle life in percentage that the wear uses up
+func (m Model) LifeUsed(wear float64) float64 {
+	if m.CycleLife <= 0 {
+		return 0
+	}
+	return wear / m.CycleLife * 100
+}
+
+// Equivalent full cycles for energy in kWh charged and discharged
+func (m Model) EquivalentCycles(charged, discharged float64) float64 {
+	if m.Capacity <= 0 {
+		return 0
+	}
+	return (charged + discharged) / 2 / m.Capacity
+}
+
+// How much faster the cells wear at a temperature than at the reference temperature. Heat
+// speeds up ageing, doubling it every 10 °C, and charging cold cells plates lithium.
+func TemperatureFactor(temperature float64, charging bool) float64 {
+	if temperature > ReferenceTemperature {
+		return math.Pow(2, (temperature-ReferenceTemperature)/10)
+	}
+	if charging && temperature < coldChargeTemperature {
+		return 1 + 0.1*(coldChargeTemperature-temperature)
+	}
+	return 1
+}
+
+// How much faster the cells wear at a power in kW than at the reference C-rate
+func (m Model) CRateFactor(power float64) float64 {
+	if m.Capacity <= 0 {
+		return 1
+	}
+	return 1 + max(0, math.Abs(power)/m.Capacity-ReferenceCRate)
+}
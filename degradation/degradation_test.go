@@ -0,0 +1,88 @@
+package degradation
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWear(t *testing.T) {
+	m := Model{Capacity: 10, CostPerKWh: 0.1, CycleLife: 5000, DepthExponent: 1.5}
+
+	// A full charge and discharge at reference conditions is one full cycle
+	full := m.Wear(0, 1, 5, ReferenceTemperature, true) + m.Wear(0, 1, 5, ReferenceTemperature, false)
+	if !almostEqual(full, 1) {
+		t.Errorf("got %f for a full cycle, wanted 1", full)
+	}
+	if cost := m.Cost(full); !almostEqual(cost, 2*10*0.1) {
+		t.Errorf("got cost %f for a full cycle, wanted %f", cost, 2*10*0.1)
+	}
+	if used := m.LifeUsed(full); !almostEqual(used, 0.02) {
+		t.Errorf("got %f%% of the life used, wanted 0.02%%", used)
+	}
+
+	// Ten 10% half cycles wear less than one 100% half cycle
+	shallow := 10 * m.Wear(0, 0.1, 5, ReferenceTemperature, true)
+	deep := m.Wear(0, 1, 5, ReferenceTemperature, true)
+	if shallow >= deep {
+		t.Errorf("got %f for shallow half cycles, wanted less than %f for a deep one", shallow, deep)
+	}
+
+	// Continuing a half cycle wears the same as doing it at once
+	split := m.Wear(0, 0.3, 5, ReferenceTemperature, true) + m.Wear(0.3, 0.6, 5, ReferenceTemperature, true)
+	if whole := m.Wear(0, 0.6, 5, ReferenceTemperature, true); !almostEqual(split, whole) {
+		t.Errorf("got %f for a split half cycle, wanted %f", split, whole)
+	}
+
+	// Twice the reference C-rate
+	if got, want := m.Wear(0, 1, 10, ReferenceTemperature, true), deep*1.5; !almostEqual(got, want) {
+		t.Errorf("got %f at 1 C, wanted %f", got, want)
+	}
+}
+
+func TestTemperatureFactor(t *testing.T) {
+	tests := []struct {
+		temperature float64
+		charging    bool
+		want        float64
+	}{
+		{25, true, 1},
+		{35, false, 2},
+		{20, true, 1},
+		{5, true, 2},
+		{5, false, 1},
+	}
+	for _, tt := range tests {
+		if got := TemperatureFactor(tt.temperature, tt.charging); !almostEqual(got, tt.want) {
+			t.Errorf("got %f at %.0f °C (charging %t), wanted %f", got, tt.temperature, tt.charging, tt.want)
+		}
+	}
+}
+
+func TestCycle(t *testing.T) {
+	var c Cycle
+	steps := []struct {
+		level    float64
+		from, to float64
+	}{
+		{50, 0, 0}, // Starts the cycle
+		{60, 0, 0.1},
+		{80, 0.1, 0.3},
+		{80, 0, 0},
+		{70, 0, 0.1}, // Changes direction
+		{40, 0.1, 0.4},
+		{45, 0, 0.05},
+	}
+	for i, s := range steps {
+		from, to := c.Step(s.level)
+		if !almostEqual(from, s.from) || !almostEqual(to, s.to) {
+			t.Errorf("step %d: got %f-%f, wanted %f-%f", i, from, to, s.from, s.to)
+		}
+	}
+	if c.Start != 40 || !c.Charging {
+		t.Errorf("got a half cycle charging %t from %f, wanted charging from 40", c.Charging, c.Start)
+	}
+}
+
+func almostEqual(f1 float64, f2 float64) bool {
+	return math.Abs(f1-f2) < 1e-9
+}
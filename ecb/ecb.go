@@ -0,0 +1,94 @@
+package ecb
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const BASE_URL = "https://data-api.ecb.europa.eu"
+
+// Reference rates are published once every working day around 16:00 CET
+const cacheDuration = 6 * time.Hour
+
+type Ecb struct {
+	baseUrl  string
+	currency string
+
+	mu        sync.Mutex
+	rate      float64
+	fetchedAt time.Time
+}
+
+func New(baseUrl string, currency string) *Ecb {
+	return &Ecb{baseUrl: baseUrl, currency: currency}
+}
+
+// Returns the latest euro foreign exchange reference rate for the currency
+func (e *Ecb) GetExchangeRate(ctx context.Context) (float64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.fetchedAt.IsZero() && time.Since(e.fetchedAt) < cacheDuration {
+		return e.rate, nil
+	}
+
+	rate, err := e.fetchExchangeRate(ctx)
+	if err != nil {
+		if e.fetchedAt.IsZero() {
+			return 0, err
+		}
+		// A rate from yesterday is still much better than no prices at all
+		return e.rate, nil
+	}
+
+	e.rate = rate
+	e.fetchedAt = time.Now()
+	return rate, nil
+}
+
+func (e *Ecb) fetchExchangeRate(ctx context.Context) (float64, error) {
+	url := fmt.Sprintf("%s/service/data/EXR/D.%s.EUR.SP00.A?lastNObservations=1&format=csvdata",
+		e.baseUrl, e.currency)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create ecb request: %w", err)
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch ecb exchange rate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code from ecb: %d", resp.StatusCode)
+	}
+
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode ecb response: %w", err)
+	}
+	if len(records) < 2 {
+		return 0, fmt.Errorf("no exchange rate from ecb for %s", e.currency)
+	}
+
+	col := slices.Index(records[0], "OBS_VALUE")
+	last := records[len(records)-1]
+	if col < 0 || col >= len(last) {
+		return 0, fmt.Errorf("no OBS_VALUE column in ecb response")
+	}
+
+	rate, err := strconv.ParseFloat(last[col], 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse ecb exchange rate %q: %w", last[col], err)
+	}
+
+	return rate, nil
+}
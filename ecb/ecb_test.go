@@ -0,0 +1,46 @@
+package ecb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetExchangeRate(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/service/data/EXR/D.SEK.EUR.SP00.A" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		http.ServeFile(w, r, "testdata/exr_sek.csv")
+	}))
+	defer srv.Close()
+
+	e := New(srv.URL, "SEK")
+	for range 2 {
+		rate, err := e.GetExchangeRate(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if rate != 10.8975 {
+			t.Errorf("got rate %f, wanted 10.8975", rate)
+		}
+	}
+
+	if calls != 1 {
+		t.Errorf("got %d requests, wanted the rate to be cached", calls)
+	}
+}
+
+func TestGetExchangeRateError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.URL, "XYZ").GetExchangeRate(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+}
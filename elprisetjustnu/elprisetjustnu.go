@@ -21,11 +21,23 @@ type rawPrice struct {
 }
 
 type ElPrisetJustNu struct {
-	area string
+	area     string
+	currency string
 }
 
-func New(area string) ElPrisetJustNu {
-	return ElPrisetJustNu{area: area}
+// Only Swedish areas, and prices in SEK or EUR, are available
+func New(area string, currency string) (ElPrisetJustNu, error) {
+	if !slices.Contains([]string{"SE1", "SE2", "SE3", "SE4"}, area) {
+		return ElPrisetJustNu{}, fmt.Errorf("elprisetjustnu does not support area %s", area)
+	}
+	if currency != "SEK" && currency != "EUR" {
+		return ElPrisetJustNu{}, fmt.Errorf("elprisetjustnu does not support currency %s", currency)
+	}
+	return ElPrisetJustNu{area: area, currency: currency}, nil
+}
+
+func (e ElPrisetJustNu) Name() string {
+	return "elprisetjustnu"
 }
 
 func (e ElPrisetJustNu) GetEnergyPrices(ctx context.Context) ([]types.EnergyPrice, error) {
@@ -82,9 +94,13 @@ func (e ElPrisetJustNu) getEnergyPrices(ctx context.Context, y, m, d int) ([]typ
 		if slices.ContainsFunc(prices, func(p types.EnergyPrice) bool { return p.Hour == hour }) {
 			continue
 		}
+		price := raw.SEKPerKWh
+		if e.currency == "EUR" {
+			price = raw.EURPerKWh
+		}
 		prices = append(prices, types.EnergyPrice{
 			Hour:  hours.FromTime(raw.TimeStart),
-			Price: raw.SEKPerKWh,
+			Price: price,
 		})
 	}
 
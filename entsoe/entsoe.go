@@ -0,0 +1,239 @@
+package entsoe
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+const BASE_URL = "https://web-api.tp.entsoe.eu"
+
+const periodLayout = "200601021504"
+
+// EIC codes of the bidding zones, see https://transparency.entsoe.eu/content/static_content/Static%20content/web%20api/Guide.html#_areas
+var biddingZones = map[string]string{
+	"SE1": "10Y1001A1001A44P",
+	"SE2": "10Y1001A1001A45N",
+	"SE3": "10Y1001A1001A46L",
+	"SE4": "10Y1001A1001A47J",
+	"NO1": "10YNO-1--------2",
+	"NO2": "10YNO-2--------T",
+	"NO3": "10YNO-3--------J",
+	"NO4": "10YNO-4--------9",
+	"NO5": "10Y1001A1001A48H",
+	"DK1": "10YDK-1--------W",
+	"DK2": "10YDK-2--------M",
+	"FI":  "10YFI-1--------U",
+}
+
+type point struct {
+	Position int     `xml:"position"`
+	Price    float64 `xml:"price.amount"`
+}
+
+type period struct {
+	TimeInterval struct {
+		Start string `xml:"start"`
+		End   string `xml:"end"`
+	} `xml:"timeInterval"`
+	Resolution string  `xml:"resolution"`
+	Points     []point `xml:"Point"`
+}
+
+type marketDocument struct {
+	XMLName    xml.Name
+	TimeSeries []struct {
+		Currency  string   `xml:"currency_Unit.name"`
+		PriceUnit string   `xml:"price_Measure_Unit.name"`
+		Periods   []period `xml:"Period"`
+	} `xml:"TimeSeries"`
+	Reason struct {
+		Code string `xml:"code"`
+		Text string `xml:"text"`
+	} `xml:"Reason"`
+}
+
+type Entsoe struct {
+	baseUrl      string
+	token        string
+	area         string
+	exchangeRate types.ExchangeRateProvider
+}
+
+// The area is either a Nordic bidding zone, e.g. "SE3" or "NO1", or an EIC code
+func New(baseUrl string, token string, area string, exchangeRate types.ExchangeRateProvider) Entsoe {
+	if eic, ok := biddingZones[strings.ToUpper(area)]; ok {
+		area = eic
+	}
+	return Entsoe{baseUrl: baseUrl, token: token, area: area, exchangeRate: exchangeRate}
+}
+
+func (e Entsoe) Name() string {
+	return "entsoe"
+}
+
+func (e Entsoe) GetEnergyPrices(ctx context.Context) ([]types.EnergyPrice, error) {
+	t := time.Now()
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	end := start.AddDate(0, 0, 2)
+
+	eurPerMWh, err := e.getEnergyPrices(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if len(eurPerMWh) == 0 {
+		return []types.EnergyPrice{}, nil
+	}
+
+	rate, err := e.exchangeRate.GetExchangeRate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exchange rate for entsoe prices: %w", err)
+	}
+
+	prices := make([]types.EnergyPrice, len(eurPerMWh))
+	for i, p := range eurPerMWh {
+		prices[i] = types.EnergyPrice{Hour: p.Hour, Price: normalizePrice(p.Price * rate)}
+	}
+
+	return prices, nil
+}
+
+// Returns hourly prices in EUR/MWh for the period
+func (e Entsoe) getEnergyPrices(ctx context.Context, start time.Time, end time.Time) ([]types.EnergyPrice, error) {
+	url := fmt.Sprintf("%s/api?securityToken=%s&documentType=A44&in_Domain=%s&out_Domain=%s&periodStart=%s&periodEnd=%s",
+		e.baseUrl,
+		e.token,
+		e.area,
+		e.area,
+		start.UTC().Format(periodLayout),
+		end.UTC().Format(periodLayout))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create entsoe request: %w", err)
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch entsoe prices: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, fmt.Errorf("entsoe rejected the security token")
+	}
+
+	var doc marketDocument
+	if err := xml.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode entsoe response (status %d): %w", resp.StatusCode, err)
+	}
+
+	// Errors, and the absence of data, are reported as an acknowledgement document
+	if doc.XMLName.Local == "Acknowledgement_MarketDocument" {
+		if doc.Reason.Code == "999" {
+			slog.Default().Debug("no prices from entsoe", "reason", doc.Reason.Text)
+			return []types.EnergyPrice{}, nil
+		}
+		return nil, fmt.Errorf("entsoe error %s: %s", doc.Reason.Code, doc.Reason.Text)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from entsoe: %d", resp.StatusCode)
+	}
+
+	prices := make([]types.EnergyPrice, 0)
+	seen := make(map[hours.DateHour]bool)
+	for _, ts := range doc.TimeSeries {
+		if ts.Currency != "EUR" || ts.PriceUnit != "MWH" {
+			return nil, fmt.Errorf("unexpected entsoe price unit %s/%s", ts.Currency, ts.PriceUnit)
+		}
+		for _, p := range ts.Periods {
+			hourly, err := hourlyPrices(p)
+			if err != nil {
+				return nil, err
+			}
+			for _, hp := range hourly {
+				if seen[hp.Hour] {
+					continue
+				}
+				seen[hp.Hour] = true
+				prices = append(prices, hp)
+			}
+		}
+	}
+
+	return prices, nil
+}
+
+// Expands a period into hourly prices. Positions left out of the period
+// (curve type A03) have the same price as the previous position, and
+// prices with a resolution below one hour are averaged.
+func hourlyPrices(p period) ([]types.EnergyPrice, error) {
+	start, err := time.Parse("2006-01-02T15:04Z", p.TimeInterval.Start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse entsoe period start %q: %w", p.TimeInterval.Start, err)
+	}
+	end, err := time.Parse("2006-01-02T15:04Z", p.TimeInterval.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse entsoe period end %q: %w", p.TimeInterval.End, err)
+	}
+
+	var resolution time.Duration
+	switch p.Resolution {
+	case "PT15M":
+		resolution = 15 * time.Minute
+	case "PT30M":
+		resolution = 30 * time.Minute
+	case "PT60M":
+		resolution = time.Hour
+	default:
+		return nil, fmt.Errorf("unsupported entsoe resolution: %s", p.Resolution)
+	}
+
+	if len(p.Points) == 0 {
+		return []types.EnergyPrice{}, nil
+	}
+
+	noOfPositions := int(end.Sub(start) / resolution)
+	byPosition := make(map[int]float64, len(p.Points))
+	for _, pt := range p.Points {
+		byPosition[pt.Position] = pt.Price
+	}
+
+	prices := make([]types.EnergyPrice, 0, noOfPositions*int(resolution)/int(time.Hour))
+	var sum float64
+	var count int
+	price := p.Points[0].Price
+	for pos := 1; pos <= noOfPositions; pos++ {
+		if v, ok := byPosition[pos]; ok {
+			price = v
+		}
+		sum += price
+		count++
+
+		at := start.Add(time.Duration(pos-1) * resolution)
+		if at.Add(resolution).Minute() == 0 {
+			prices = append(prices, types.EnergyPrice{
+				Hour:  hours.FromTime(at),
+				Price: sum / float64(count),
+			})
+			sum, count = 0, 0
+		}
+	}
+
+	return prices, nil
+}
+
+// Converts from local currency per MWh to local currency per kWh
+func normalizePrice(price float64) float64 {
+	precision := math.Pow(10, float64(4))
+	return math.Round(price*precision/1e3) / precision
+}
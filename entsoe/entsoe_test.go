@@ -0,0 +1,97 @@
+package entsoe
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+func serve(t *testing.T, file string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("securityToken") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if q.Get("in_Domain") != "10Y1001A1001A46L" || q.Get("out_Domain") != "10Y1001A1001A46L" {
+			t.Errorf("unexpected domains %s", r.URL.RawQuery)
+		}
+		if q.Get("documentType") != "A44" || len(q.Get("periodStart")) != 12 || len(q.Get("periodEnd")) != 12 {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		http.ServeFile(w, r, "testdata/"+file)
+	}))
+}
+
+func TestGetEnergyPricesHourly(t *testing.T) {
+	srv := serve(t, "day_ahead_pt60m.xml")
+	defer srv.Close()
+
+	prices, err := New(srv.URL, "token", "SE3", types.FixedExchangeRate(10)).GetEnergyPrices(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(prices) != 24 {
+		t.Fatalf("got %d prices, wanted 24", len(prices))
+	}
+	if prices[0].Hour != (hours.DateHour{Date: "2025-05-31", Hour: 22}) || prices[0].Price != 0.21 {
+		t.Errorf("unexpected first price %+v", prices[0])
+	}
+	// Positions 4 and 5 are left out and should repeat the price of position 3
+	for _, i := range []int{2, 3, 4} {
+		if prices[i].Price != 0.23 {
+			t.Errorf("got price %f at position %d, wanted 0.23", prices[i].Price, i+1)
+		}
+	}
+	if prices[23].Hour != (hours.DateHour{Date: "2025-06-01", Hour: 21}) || prices[23].Price != 0.44 {
+		t.Errorf("unexpected last price %+v", prices[23])
+	}
+}
+
+func TestGetEnergyPricesQuarterly(t *testing.T) {
+	srv := serve(t, "day_ahead_pt15m.xml")
+	defer srv.Close()
+
+	prices, err := New(srv.URL, "token", "10Y1001A1001A46L", types.FixedExchangeRate(10)).GetEnergyPrices(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(prices) != 2 {
+		t.Fatalf("got %d prices, wanted 2", len(prices))
+	}
+	if prices[0].Hour != (hours.DateHour{Date: "2025-10-01", Hour: 22}) || prices[0].Price != 0.25 {
+		t.Errorf("unexpected first price %+v", prices[0])
+	}
+	// -4, -4, 8, 8 averages to 2 EUR/MWh
+	if prices[1].Hour != (hours.DateHour{Date: "2025-10-01", Hour: 23}) || prices[1].Price != 0.02 {
+		t.Errorf("unexpected second price %+v", prices[1])
+	}
+}
+
+func TestGetEnergyPricesNoData(t *testing.T) {
+	srv := serve(t, "no_data.xml")
+	defer srv.Close()
+
+	prices, err := New(srv.URL, "token", "SE3", types.FixedExchangeRate(10)).GetEnergyPrices(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(prices) != 0 {
+		t.Errorf("got %d prices, wanted none", len(prices))
+	}
+}
+
+func TestGetEnergyPricesInvalidToken(t *testing.T) {
+	srv := serve(t, "no_data.xml")
+	defer srv.Close()
+
+	if _, err := New(srv.URL, "wrong", "SE3", types.FixedExchangeRate(10)).GetEnergyPrices(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+}
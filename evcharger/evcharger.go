@@ -0,0 +1,45 @@
+package evcharger
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+// Status as reported by a charger bridge, e.g. a home automation system
+// that exposes the charger as JSON over HTTP or MQTT
+type statusMessage struct {
+	State         string  `json:"state"`          // "available", "connected", "charging" or "faulted"
+	Power         float64 `json:"power"`          // Current charging power in kW
+	SessionEnergy float64 `json:"session_energy"` // Energy delivered in the current session in kWh
+	Meter         float64 `json:"meter"`          // Lifetime energy meter reading in kWh
+}
+
+// Command sent to the charger bridge
+type commandMessage struct {
+	Charging bool `json:"charging"`
+}
+
+func parseStatus(data []byte, now time.Time) (types.EvChargerStatus, error) {
+	var msg statusMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return types.EvChargerStatus{}, fmt.Errorf("decoding ev charger status: %w", err)
+	}
+
+	state := types.EvChargerState(msg.State)
+	switch state {
+	case types.EvChargerAvailable, types.EvChargerConnected, types.EvChargerCharging, types.EvChargerFaulted:
+	default:
+		return types.EvChargerStatus{}, fmt.Errorf("unknown ev charger state %q", msg.State)
+	}
+
+	return types.EvChargerStatus{
+		State:         state,
+		Power:         msg.Power,
+		SessionEnergy: msg.SessionEnergy,
+		Meter:         msg.Meter,
+		Updated:       now,
+	}, nil
+}
@@ -0,0 +1,139 @@
+package evcharger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+// Polls GET <baseUrl>/status and controls charging with POST <baseUrl>/charging
+type Http struct {
+	logger   *slog.Logger
+	baseUrl  string
+	interval time.Duration
+	client   *http.Client
+	mu       sync.RWMutex
+	status   types.EvChargerStatus
+}
+
+func NewHttp(baseUrl string, interval time.Duration) *Http {
+	return &Http{
+		logger:   slog.Default().With("module", "evcharger"),
+		baseUrl:  baseUrl,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		status:   types.EvChargerStatus{State: types.EvChargerUnavailable},
+	}
+}
+
+func (h *Http) Name() string {
+	return "http"
+}
+
+func (h *Http) Status() types.EvChargerStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.status
+}
+
+// Polls the status until the context is done
+func (h *Http) Run(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+		failing := false // Keeping state to avoid spamming logs
+		for {
+			err := h.poll(ctx)
+			if err != nil && !failing {
+				h.logger.Warn("failed to get ev charger status", slog.Any("error", err))
+			} else if err == nil && failing {
+				h.logger.Info("ev charger status recovered")
+			}
+			failing = err != nil
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (h *Http) poll(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", h.baseUrl+"/status", nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		h.setUnavailable()
+		return fmt.Errorf("making request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		h.setUnavailable()
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("reading response body: %w", err)
+	}
+
+	status, err := parseStatus(body, time.Now())
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status = status
+	return nil
+}
+
+func (h *Http) setUnavailable() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.status.State = types.EvChargerUnavailable
+	h.status.Power = 0
+}
+
+func (h *Http) SetCharging(ctx context.Context, enabled bool) error {
+	body, err := json.Marshal(commandMessage{Charging: enabled})
+	if err != nil {
+		return fmt.Errorf("encoding command: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", h.baseUrl+"/charging", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("making request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+
+	// Don't wait for the next poll to see the result
+	if err := h.poll(ctx); err != nil {
+		h.logger.Warn("failed to get ev charger status", slog.Any("error", err))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package evcharger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+func TestHttpCharger(t *testing.T) {
+	charging := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/status":
+			state, power := "connected", 0.0
+			if charging {
+				state, power = "charging", 7.4
+			}
+			json.NewEncoder(w).Encode(statusMessage{State: state, Power: power, SessionEnergy: 2.5, Meter: 1200})
+		case r.Method == "POST" && r.URL.Path == "/api/charging":
+			var cmd commandMessage
+			if err := json.NewDecoder(r.Body).Decode(&cmd); err != nil {
+				t.Errorf("unexpected command body: %v", err)
+			}
+			charging = cmd.Charging
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	h := NewHttp(srv.URL+"/api", time.Minute)
+	if h.Status().State != types.EvChargerUnavailable {
+		t.Errorf("got state %s before the first poll, wanted %s", h.Status().State, types.EvChargerUnavailable)
+	}
+
+	if err := h.poll(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	status := h.Status()
+	if status.State != types.EvChargerConnected || status.SessionEnergy != 2.5 || status.Meter != 1200 || !status.VehicleConnected() {
+		t.Errorf("unexpected status %+v", status)
+	}
+
+	if err := h.SetCharging(context.Background(), true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status := h.Status(); status.State != types.EvChargerCharging || status.Power != 7.4 {
+		t.Errorf("unexpected status after starting to charge %+v", status)
+	}
+}
+
+func TestHttpChargerUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	h := NewHttp(srv.URL, time.Minute)
+	if err := h.poll(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+	if h.Status().State != types.EvChargerUnavailable {
+		t.Errorf("got state %s, wanted %s", h.Status().State, types.EvChargerUnavailable)
+	}
+	if err := h.SetCharging(context.Background(), true); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	if _, err := parseStatus([]byte(`{"state":"sleeping"}`), time.Now()); err == nil {
+		t.Error("expected an error for an unknown state")
+	}
+	if _, err := parseStatus([]byte(`not json`), time.Now()); err == nil {
+		t.Error("expected an error for invalid json")
+	}
+}
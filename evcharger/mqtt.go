@@ -0,0 +1,111 @@
+package evcharger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+// A status older than this is considered gone, bridges are expected to publish at least every minute
+const mqttStatusMaxAge = 5 * time.Minute
+
+// Subscribes to JSON status messages and publishes JSON commands
+type Mqtt struct {
+	logger       *slog.Logger
+	client       mqtt.Client
+	statusTopic  string
+	commandTopic string
+	mu           sync.RWMutex
+	status       types.EvChargerStatus
+}
+
+func NewMqtt(broker string, port int16, username string, password string, statusTopic string, commandTopic string) *Mqtt {
+	m := &Mqtt{
+		logger:       slog.Default().With("module", "evcharger"),
+		statusTopic:  statusTopic,
+		commandTopic: commandTopic,
+		status:       types.EvChargerStatus{State: types.EvChargerUnavailable},
+	}
+
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(fmt.Sprintf("tcp://%s:%d", broker, port))
+	opts.SetClientID("solarplant-evcharger")
+	opts.SetUsername(username)
+	opts.SetPassword(password)
+	opts.SetAutoReconnect(true)
+	opts.OnConnect = func(client mqtt.Client) {
+		// Subscriptions are lost when reconnecting with a clean session
+		token := client.Subscribe(m.statusTopic, 0, m.onStatus)
+		if token.Wait() && token.Error() != nil {
+			m.logger.Error("failed to subscribe to ev charger status", slog.String("topic", m.statusTopic), slog.Any("error", token.Error()))
+			return
+		}
+		m.logger.Info("ev charger mqtt connected", slog.String("topic", m.statusTopic))
+	}
+	opts.OnConnectionLost = func(client mqtt.Client, err error) {
+		m.logger.Warn("ev charger mqtt connection lost", slog.Any("error", err))
+	}
+	m.client = mqtt.NewClient(opts)
+
+	return m
+}
+
+func (m *Mqtt) Name() string {
+	return "mqtt"
+}
+
+func (m *Mqtt) Status() types.EvChargerStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if time.Since(m.status.Updated) > mqttStatusMaxAge {
+		return types.EvChargerStatus{State: types.EvChargerUnavailable, Meter: m.status.Meter, Updated: m.status.Updated}
+	}
+	return m.status
+}
+
+func (m *Mqtt) Connect() error {
+	if token := m.client.Connect(); token.Wait() && token.Error() != nil {
+		return fmt.Errorf("connecting to ev charger mqtt broker: %w", token.Error())
+	}
+	return nil
+}
+
+func (m *Mqtt) Disconnect() {
+	m.client.Disconnect(250)
+}
+
+func (m *Mqtt) onStatus(client mqtt.Client, msg mqtt.Message) {
+	status, err := parseStatus(msg.Payload(), time.Now())
+	if err != nil {
+		m.logger.Warn("invalid ev charger status", slog.String("topic", msg.Topic()), slog.Any("error", err))
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.status = status
+}
+
+func (m *Mqtt) SetCharging(ctx context.Context, enabled bool) error {
+	payload, err := json.Marshal(commandMessage{Charging: enabled})
+	if err != nil {
+		return fmt.Errorf("encoding command: %w", err)
+	}
+
+	token := m.client.Publish(m.commandTopic, 1, false, payload)
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("publishing ev charger command: %w", ctx.Err())
+	case <-token.Done():
+		if token.Error() != nil {
+			return fmt.Errorf("publishing ev charger command: %w", token.Error())
+		}
+		return nil
+	}
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type Event string
+
+const (
+	WeatherForecastUpdated Event = "weather_forecast_updated"
+	EnergyForecastUpdated  Event = "energy_forecast_updated"
+	EnergyPriceUpdated     Event = "energy_price_updated"
+	PlanDeviated           Event = "plan_deviated" // The battery level or consumption is far from what the plan expected
+	EvChargeRequested      Event = "ev_charge_requested"
+	LoadOverridden         Event = "load_overridden" // A flexible load was forced on or off, or handed back to the plan
+)
+
+// A minimal in-process publish/subscribe bus, handlers are run in their own goroutine
+type Bus struct {
+	mu       sync.RWMutex
+	logger   *slog.Logger
+	handlers map[Event][]func(Event)
+}
+
+func NewBus(logger *slog.Logger) *Bus {
+	return &Bus{
+		logger:   logger,
+		handlers: make(map[Event][]func(Event)),
+	}
+}
+
+func (b *Bus) Subscribe(event Event, handler func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[event] = append(b.handlers[event], handler)
+}
+
+func (b *Bus) Publish(event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	b.logger.Debug("publishing event", slog.String("event", string(event)), slog.Int("noOfHandlers", len(b.handlers[event])))
+	for _, h := range b.handlers[event] {
+		go h(event)
+	}
+}
+
+// Calls a function once no more triggers have arrived during the delay
+type Debouncer struct {
+	mu    sync.Mutex
+	delay time.Duration
+	fn    func()
+	timer *time.Timer
+}
+
+func NewDebouncer(delay time.Duration, fn func()) *Debouncer {
+	return &Debouncer{delay: delay, fn: fn}
+}
+
+func (d *Debouncer) Trigger() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+	d.timer = time.AfterFunc(d.delay, d.fn)
+}
+
+// Stops a pending call, if any
+func (d *Debouncer) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.timer != nil {
+		d.timer.Stop()
+	}
+}
@@ -0,0 +1,51 @@
+package events
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus(slog.Default())
+
+	received := make(chan Event, 2)
+	bus.Subscribe(EnergyPriceUpdated, func(e Event) { received <- e })
+	bus.Subscribe(WeatherForecastUpdated, func(e Event) { t.Errorf("unexpected event %s", e) })
+
+	bus.Publish(EnergyPriceUpdated)
+	bus.Publish(EnergyForecastUpdated) // No subscribers
+
+	select {
+	case e := <-received:
+		if e != EnergyPriceUpdated {
+			t.Errorf("got event %s, wanted %s", e, EnergyPriceUpdated)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("event not received")
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	var calls atomic.Int32
+	d := NewDebouncer(50*time.Millisecond, func() { calls.Add(1) })
+
+	for range 5 {
+		d.Trigger()
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(150 * time.Millisecond)
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("got %d calls, wanted 1", n)
+	}
+
+	d.Trigger()
+	d.Stop()
+	time.Sleep(100 * time.Millisecond)
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("got %d calls after stop, wanted 1", n)
+	}
+}
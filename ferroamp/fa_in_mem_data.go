@@ -1,6 +1,8 @@
 package ferroamp
 
 import (
+	"slices"
+	"strings"
 	"sync"
 
 	"github.com/icodeforyou/solarplant-go/calc"
@@ -93,6 +95,61 @@ func (d *FaInMemData) BatteryStatuses() []int16 {
 	return statuses
 }
 
+/** Average cell temperature in °C of the battery modules, false if no module has reported */
+func (d *FaInMemData) BatteryTemperature() (float64, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if len(d.data.Eso) == 0 {
+		return 0.0, false
+	}
+
+	sum := 0.0
+	for _, eso := range d.data.Eso {
+		sum += eso.Temp.Value
+	}
+
+	return calc.TwoDecimals(sum / float64(len(d.data.Eso))), true
+}
+
+/** Energy charged into the battery over its lifetime in kWh */
+func (d *FaInMemData) BatteryChargedLifetime() float64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return calc.MJ2Kwh(d.data.Ehub.WbatCons.Value)
+}
+
+/** Energy discharged from the battery over its lifetime in kWh */
+func (d *FaInMemData) BatteryDischargedLifetime() float64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return calc.MJ2Kwh(d.data.Ehub.WbatProd.Value)
+}
+
+type BatteryModule struct {
+	ID            string
+	Soh           float64 // State of health in percentage
+	RatedCapacity float64 // kWh
+}
+
+/** State of health and rated capacity of each battery module, ordered by id */
+func (d *FaInMemData) BatteryModules() []BatteryModule {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	modules := make([]BatteryModule, 0, len(d.data.Esm))
+	for _, esm := range d.data.Esm {
+		modules = append(modules, BatteryModule{
+			ID:            esm.ID.Value,
+			Soh:           esm.Soh.Value,
+			RatedCapacity: esm.RatedCapacity.Value / 1e3,
+		})
+	}
+	slices.SortFunc(modules, func(a, b BatteryModule) int { return strings.Compare(a.ID, b.ID) })
+
+	return modules
+}
+
 /** Production lifetime in kWh */
 func (d *FaInMemData) ProductionLifetime() float64 {
 	d.mu.RLock()
@@ -19,12 +19,24 @@ type OnEsmMessage func(msg *EsmMessage)
 type OnControlResponse func(msg *ControlResponseMessage)
 type OnControlEvent func(msg *ControlEventMessage)
 type OnInactivity func()
+type OnConnect func()
 
 type pendingRequest struct {
 	TransId string
 	Payload string
 	SentAt  time.Time
-	DoneCh  chan struct{}
+	DoneCh  chan ControlResponseMessage
+}
+
+// Status of a control request that wasn't answered in time
+const StatusTimeout = "timeout"
+
+// How the ESO answered a control request
+type ControlResult struct {
+	TransId string
+	Status  string        // "ack" or "nak" as answered, or "timeout"
+	Message string        // Message from the ESO
+	Latency time.Duration // Time until the answer arrived, or until giving up waiting
 }
 
 var topics = map[string]byte{
@@ -53,9 +65,27 @@ type Ferroamp struct {
 	OnControlResponse OnControlResponse
 	OnControlEvent    OnControlEvent
 	OnInactivity      OnInactivity
+	OnConnect         OnConnect
 }
 
-func New(broker string, port int16, username string, password string) *Ferroamp {
+// Sent by the broker if the connection is lost without disconnecting, so the battery isn't
+// left charging or discharging when solarplant is gone
+const willTransId = "solarplant-will"
+const willPayload = `{"transId":"` + willTransId + `","cmd":{"name":"auto"}}`
+
+/**
+ * The broker considers the connection lost when no keep alive ping has arrived within 1.5 times
+ * keepAlive. If autoOnConnectionLoss, the battery is then set to auto by the broker.
+ */
+func New(
+	broker string,
+	port int16,
+	username string,
+	password string,
+	keepAlive time.Duration,
+	autoOnConnectionLoss bool) *Ferroamp {
+
+	fa := &Ferroamp{}
 	logger := slog.Default().With("module", "ferroamp")
 	opts := mqtt.NewClientOptions()
 	opts.AddBroker(fmt.Sprintf("tcp://%s:%d", broker, port))
@@ -63,8 +93,15 @@ func New(broker string, port int16, username string, password string) *Ferroamp
 	opts.SetUsername(username)
 	opts.SetPassword(password)
 	opts.SetAutoReconnect(true)
+	opts.SetKeepAlive(keepAlive)
+	if autoOnConnectionLoss {
+		opts.SetWill("extapi/control/request", willPayload, 0, false)
+	}
 	opts.OnConnect = func(client mqtt.Client) {
 		logger.Info("ferroamp mqtt connected", slog.Bool("isConnected", client.IsConnected()))
+		if fa.OnConnect != nil {
+			fa.OnConnect()
+		}
 	}
 	opts.OnConnectionLost = func(client mqtt.Client, err error) {
 		logger.Warn("ferroamp mqtt connection lost", slog.Any("error", err), slog.Bool("isConnected", client.IsConnected()))
@@ -75,7 +112,7 @@ func New(broker string, port int16, username string, password string) *Ferroamp
 	mqtt.ERROR = newMqttLogger(mqttLogger, slog.LevelError)
 	mqtt.WARN = newMqttLogger(mqttLogger, slog.LevelWarn)
 
-	return &Ferroamp{
+	*fa = Ferroamp{
 		mtqqClient:       mqtt.NewClient(opts),
 		logger:           logger,
 		pending:          make(map[string]pendingRequest),
@@ -83,6 +120,7 @@ func New(broker string, port int16, username string, password string) *Ferroamp
 		lastSsoFaultCode: 0,
 		lastMessageTime:  ConcurrentTimer{},
 	}
+	return fa
 }
 
 func (fa *Ferroamp) Connect() error {
@@ -155,7 +193,12 @@ func (fa *Ferroamp) Connect() error {
 					if e, exists := fa.pending[crm.TransId]; exists {
 						duration := time.Since(e.SentAt)
 						fa.logger.Debug("received response for known transaction", slog.String("transId", crm.TransId), slog.Duration("duration", duration))
-						e.DoneCh <- struct{}{}
+						select {
+						case e.DoneCh <- crm:
+						default: // Already answered or given up on
+						}
+					} else if crm.TransId == willTransId {
+						fa.logger.Info("received response for the last will, the broker set the battery to auto", slog.Any("message", crm.Message))
 					} else if strings.HasPrefix(crm.TransId, "solarplant-") {
 						fa.logger.Warn("received response for unknown transaction", slog.String("transId", crm.TransId))
 					} else {
@@ -231,37 +274,45 @@ func (fa *Ferroamp) formatPayload(power float64) (transId string, payload string
 	return transId, payload
 }
 
-func (fa *Ferroamp) sendControlRequest(transId string, payload string) error {
+func (fa *Ferroamp) sendControlRequest(transId string, payload string) (ControlResult, error) {
+	result := ControlResult{TransId: transId}
 	token := fa.mtqqClient.Publish("extapi/control/request", 0, false, payload)
 	ok := token.WaitTimeout(time.Second * 5)
 	if !ok {
-		return fmt.Errorf("timeout when sending battery control request to ferroamp")
+		return result, fmt.Errorf("timeout when sending battery control request to ferroamp")
 	} else if token.Error() != nil {
-		return fmt.Errorf("error when sending battery control request to ferroamp: %w", token.Error())
+		return result, fmt.Errorf("error when sending battery control request to ferroamp: %w", token.Error())
 	} else {
+		pending := pendingRequest{
+			TransId: transId,
+			Payload: payload,
+			SentAt:  time.Now(),
+			DoneCh:  make(chan ControlResponseMessage, 1),
+		}
 		func() {
 			fa.pendingMutex.Lock()
 			defer fa.pendingMutex.Unlock()
-			fa.pending[transId] = pendingRequest{
-				TransId: transId,
-				Payload: payload,
-				SentAt:  time.Now(),
-				DoneCh:  make(chan struct{}),
-			}
+			fa.pending[transId] = pending
 			fa.logger.Debug("successfully sent battery control request to ferroamp, waiting for ack/nak...")
 		}()
 
 		select {
-		case <-fa.pending[transId].DoneCh:
+		case crm, ok := <-pending.DoneCh:
+			result.Status, result.Message = crm.Status, crm.Message
+			if !ok {
+				result.Status = StatusTimeout // Purged
+			}
 		case <-time.After(30 * time.Second):
 			fa.logger.Warn("pending request timed out", slog.String("transId", transId))
+			result.Status = StatusTimeout
 		}
+		result.Latency = time.Since(pending.SentAt)
 
-		return nil
+		return result, nil
 	}
 }
 
-func (fa *Ferroamp) SetBatteryAuto() error {
+func (fa *Ferroamp) SetBatteryAuto() (ControlResult, error) {
 	transId := fmt.Sprintf("solarplant-%d", time.Now().Unix())
 	payload := fmt.Sprintf(`{"transId":"%s","cmd":{"name":"auto"}}`, transId)
 	fa.logger.Info("setting ferroamp battery in auto mode", "payload", payload)
@@ -269,7 +320,7 @@ func (fa *Ferroamp) SetBatteryAuto() error {
 }
 
 /** Positive values (kW) equals discharge, negative charge */
-func (fa *Ferroamp) SetBatteryLoad(power float64) error {
+func (fa *Ferroamp) SetBatteryLoad(power float64) (ControlResult, error) {
 	transId, payload := fa.formatPayload(power)
 	fa.logger.Info("sending new battery load to ferroamp", "power", power, "payload", payload)
 	return fa.sendControlRequest(transId, payload)
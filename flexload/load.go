@@ -0,0 +1,96 @@
+package flexload
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+// A load that has to run a number of hours every day, but it doesn't matter when
+type Load struct {
+	Name         string
+	Power        float64            // Power in kW when the load is on
+	DailyRunTime float64            // Hours the load has to run every day
+	Windows      []hours.TimeWindow // When the load may run in the GUI timezone, always if empty
+}
+
+func FromConfig(c config.AppConfigFlexibleLoad) (Load, error) {
+	if c.Name == "" {
+		return Load{}, fmt.Errorf("flexible load without a name")
+	}
+	if c.Power <= 0 {
+		return Load{}, fmt.Errorf("flexible load %s: power must be positive", c.Name)
+	}
+	if c.DailyRunTime < 0 || c.DailyRunTime > 24 {
+		return Load{}, fmt.Errorf("flexible load %s: daily run time must be between 0 and 24 hours", c.Name)
+	}
+
+	load := Load{Name: c.Name, Power: c.Power, DailyRunTime: c.DailyRunTime}
+	for _, w := range c.Windows {
+		window, err := hours.ParseTimeWindow(w.From, w.To)
+		if err != nil {
+			return Load{}, fmt.Errorf("flexible load %s: %w", c.Name, err)
+		}
+		load.Windows = append(load.Windows, window)
+	}
+
+	return load, nil
+}
+
+// Whether the load may run at the given time
+func (l Load) AllowedAt(t time.Time) bool {
+	if len(l.Windows) == 0 {
+		return true
+	}
+	for _, w := range l.Windows {
+		if w.ContainsTime(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hours the load may run between from and to, with a minute resolution
+func (l Load) AllowedHours(from, to time.Time) float64 {
+	if len(l.Windows) == 0 {
+		return max(to.Sub(from).Hours(), 0)
+	}
+	allowed := 0
+	for t := from.Truncate(time.Minute); t.Before(to); t = t.Add(time.Minute) {
+		if l.AllowedAt(t) {
+			allowed++
+		}
+	}
+	return float64(allowed) / 60
+}
+
+// Midnight at the start of the day in the GUI timezone
+func StartOfDay(t time.Time) time.Time {
+	local := hours.InGuiTimezone(t)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+}
+
+// Midnight at the end of the day in the GUI timezone
+func EndOfDay(t time.Time) time.Time {
+	local := hours.InGuiTimezone(t)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, local.Location())
+}
+
+func FromConfigs(cs []config.AppConfigFlexibleLoad) ([]Load, error) {
+	loads := make([]Load, 0, len(cs))
+	names := make(map[string]bool)
+	for _, c := range cs {
+		load, err := FromConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		if names[load.Name] {
+			return nil, fmt.Errorf("flexible load %s is configured more than once", load.Name)
+		}
+		names[load.Name] = true
+		loads = append(loads, load)
+	}
+	return loads, nil
+}
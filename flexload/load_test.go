@@ -0,0 +1,60 @@
+package flexload
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+func TestFromConfig(t *testing.T) {
+	load, err := FromConfig(config.AppConfigFlexibleLoad{
+		Name:         "pool",
+		Power:        1.2,
+		DailyRunTime: 6,
+		Windows:      []config.AppConfigTimeWindow{{From: "22:00", To: "06:00"}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(load.Windows) != 1 || load.Windows[0] != (hours.TimeWindow{From: 22 * 60, To: 6 * 60}) {
+		t.Errorf("unexpected windows %+v", load.Windows)
+	}
+
+	if _, err := FromConfig(config.AppConfigFlexibleLoad{Name: "pool", Power: 0, DailyRunTime: 6}); err == nil {
+		t.Error("expected an error without power")
+	}
+	if _, err := FromConfig(config.AppConfigFlexibleLoad{Name: "pool", Power: 1, DailyRunTime: 25}); err == nil {
+		t.Error("expected an error for a too long run time")
+	}
+}
+
+func TestAllowedHours(t *testing.T) {
+	load := Load{Name: "heater", Power: 3, DailyRunTime: 2, Windows: []hours.TimeWindow{{From: 1*60 + 30, To: 4 * 60}}}
+	day := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		expected float64
+	}{
+		{"whole day", day, day.Add(24 * time.Hour), 2.5},
+		{"first hour of the window", day.Add(time.Hour), day.Add(2 * time.Hour), 0.5},
+		{"outside the window", day.Add(5 * time.Hour), day.Add(6 * time.Hour), 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := load.AllowedHours(tt.from, tt.to); math.Abs(got-tt.expected) > 0.001 {
+				t.Errorf("AllowedHours() = %.3f, wanted %.3f", got, tt.expected)
+			}
+		})
+	}
+
+	always := Load{Name: "pump", Power: 1, DailyRunTime: 4}
+	if got := always.AllowedHours(day, day.Add(90*time.Minute)); got != 1.5 {
+		t.Errorf("AllowedHours() without windows = %.3f, wanted 1.5", got)
+	}
+}
@@ -0,0 +1,178 @@
+package flexload
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+func NewSwitch(c config.AppConfigFlexibleLoad) (types.LoadSwitch, error) {
+	switch c.Backend {
+	case "mqtt":
+		if c.Mqtt.Topic == "" {
+			return nil, fmt.Errorf("flexible load %s: mqtt topic is missing", c.Name)
+		}
+		return NewMqttSwitch(c.Mqtt.Host, c.Mqtt.Port, c.Mqtt.Username, c.Mqtt.Password,
+			c.Mqtt.Topic, c.Mqtt.GetPayloadOn(), c.Mqtt.GetPayloadOff()), nil
+	case "http":
+		if c.Http.OnUrl == "" || c.Http.OffUrl == "" {
+			return nil, fmt.Errorf("flexible load %s: http on_url and off_url are required", c.Name)
+		}
+		return NewHttpSwitch(c.Http.OnUrl, c.Http.OffUrl, c.Http.GetMethod()), nil
+	case "shelly":
+		if c.Shelly.Host == "" {
+			return nil, fmt.Errorf("flexible load %s: shelly host is missing", c.Name)
+		}
+		return NewShellySwitch(c.Shelly.Host, c.Shelly.Relay, c.Shelly.GetGeneration())
+	default:
+		return nil, fmt.Errorf("flexible load %s: unknown backend %q", c.Name, c.Backend)
+	}
+}
+
+// Publishes a payload to a topic, the broker is connected when first used
+type MqttSwitch struct {
+	client     mqtt.Client
+	topic      string
+	payloadOn  string
+	payloadOff string
+}
+
+func NewMqttSwitch(broker string, port int16, username string, password string, topic string, payloadOn string, payloadOff string) *MqttSwitch {
+	opts := mqtt.NewClientOptions()
+	opts.AddBroker(fmt.Sprintf("tcp://%s:%d", broker, port))
+	opts.SetClientID("solarplant-load-" + topic)
+	opts.SetUsername(username)
+	opts.SetPassword(password)
+	opts.SetAutoReconnect(true)
+
+	return &MqttSwitch{
+		client:     mqtt.NewClient(opts),
+		topic:      topic,
+		payloadOn:  payloadOn,
+		payloadOff: payloadOff,
+	}
+}
+
+func (m *MqttSwitch) Name() string {
+	return "mqtt"
+}
+
+func (m *MqttSwitch) SetOn(ctx context.Context, on bool) error {
+	if !m.client.IsConnected() {
+		if token := m.client.Connect(); token.Wait() && token.Error() != nil {
+			return fmt.Errorf("connecting to mqtt broker: %w", token.Error())
+		}
+	}
+
+	payload := m.payloadOff
+	if on {
+		payload = m.payloadOn
+	}
+	token := m.client.Publish(m.topic, 1, true, payload)
+	if !token.WaitTimeout(10 * time.Second) {
+		return fmt.Errorf("publishing to %s: timeout", m.topic)
+	}
+	if token.Error() != nil {
+		return fmt.Errorf("publishing to %s: %w", m.topic, token.Error())
+	}
+	return nil
+}
+
+// Calls one url to turn the load on and another to turn it off
+type HttpSwitch struct {
+	onUrl  string
+	offUrl string
+	method string
+	client *http.Client
+}
+
+func NewHttpSwitch(onUrl string, offUrl string, method string) *HttpSwitch {
+	return &HttpSwitch{
+		onUrl:  onUrl,
+		offUrl: offUrl,
+		method: method,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (h *HttpSwitch) Name() string {
+	return "http"
+}
+
+func (h *HttpSwitch) SetOn(ctx context.Context, on bool) error {
+	url := h.offUrl
+	if on {
+		url = h.onUrl
+	}
+	return call(ctx, h.client, h.method, url)
+}
+
+// Switches a relay of a Shelly device through its local API
+type ShellySwitch struct {
+	host       string
+	relay      int
+	generation int
+	client     *http.Client
+}
+
+func NewShellySwitch(host string, relay int, generation int) (*ShellySwitch, error) {
+	if generation != 1 && generation != 2 {
+		return nil, fmt.Errorf("unsupported shelly generation %d", generation)
+	}
+	return &ShellySwitch{
+		host:       host,
+		relay:      relay,
+		generation: generation,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (s *ShellySwitch) Name() string {
+	return "shelly"
+}
+
+func (s *ShellySwitch) SetOn(ctx context.Context, on bool) error {
+	var url string
+	if s.generation == 1 {
+		turn := "off"
+		if on {
+			turn = "on"
+		}
+		url = fmt.Sprintf("%s/relay/%d?turn=%s", baseUrl(s.host), s.relay, turn)
+	} else {
+		url = fmt.Sprintf("%s/rpc/Switch.Set?id=%d&on=%t", baseUrl(s.host), s.relay, on)
+	}
+	return call(ctx, s.client, "GET", url)
+}
+
+// The host may be configured with or without a scheme
+func baseUrl(host string) string {
+	if strings.HasPrefix(host, "http://") || strings.HasPrefix(host, "https://") {
+		return host
+	}
+	return "http://" + host
+}
+
+func call(ctx context.Context, client *http.Client, method string, url string) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("making request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", res.StatusCode)
+	}
+	return nil
+}
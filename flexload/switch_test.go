@@ -0,0 +1,74 @@
+package flexload
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpSwitch(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Method + " " + r.URL.Path
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	s := NewHttpSwitch(srv.URL+"/on", srv.URL+"/off", "PUT")
+	if err := s.SetOn(context.Background(), true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "PUT /on" {
+		t.Errorf("got request %q, wanted %q", got, "PUT /on")
+	}
+	if err := s.SetOn(context.Background(), false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "PUT /off" {
+		t.Errorf("got request %q, wanted %q", got, "PUT /off")
+	}
+
+	failing := NewHttpSwitch(srv.URL+"/fail", srv.URL+"/fail", "POST")
+	if err := failing.SetOn(context.Background(), true); err == nil {
+		t.Error("expected an error for a failing request")
+	}
+}
+
+func TestShellySwitch(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.URL.RequestURI()
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		generation int
+		on         bool
+		expected   string
+	}{
+		{1, true, "/relay/1?turn=on"},
+		{1, false, "/relay/1?turn=off"},
+		{2, true, "/rpc/Switch.Set?id=1&on=true"},
+		{2, false, "/rpc/Switch.Set?id=1&on=false"},
+	}
+
+	for _, tt := range tests {
+		s, err := NewShellySwitch(srv.URL, 1, tt.generation)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := s.SetOn(context.Background(), tt.on); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != tt.expected {
+			t.Errorf("generation %d: got request %q, wanted %q", tt.generation, got, tt.expected)
+		}
+	}
+
+	if _, err := NewShellySwitch("shelly.local", 0, 3); err == nil {
+		t.Error("expected an error for an unknown generation")
+	}
+}
@@ -71,6 +71,20 @@ func (dh DateHour) Sub(hours int) DateHour {
 	return dh.Add(-hours)
 }
 
+// Returns the number of hours from this hour until the other hour,
+// negative if the other hour is before this hour.
+func (dh DateHour) HoursUntil(other DateHour) int {
+	from, err := time.ParseInLocation(hourLayout, dh.String(), time.UTC)
+	if err != nil {
+		return 0
+	}
+	to, err := time.ParseInLocation(hourLayout, other.String(), time.UTC)
+	if err != nil {
+		return 0
+	}
+	return int(to.Sub(from).Hours())
+}
+
 func (dh DateHour) Compare(other DateHour) int {
 	if dh == other {
 		return 0
@@ -130,6 +144,20 @@ func LocationStockholm(t time.Time) time.Time {
 	return t.In(stockholmLoc)
 }
 
+func InGuiTimezone(t time.Time) time.Time {
+	return t.In(guiLocation)
+}
+
 func FormatTimeInGuiTimezone(t time.Time) string {
 	return t.In(guiLocation).Format("2006-01-02 15:04:05")
 }
+
+// The first time after the given time that the clock in the GUI timezone shows hour:minute
+func NextTimeOfDay(hour, minute int, after time.Time) time.Time {
+	t := after.In(guiLocation)
+	next := time.Date(t.Year(), t.Month(), t.Day(), hour, minute, 0, 0, guiLocation)
+	if !next.After(after) {
+		next = time.Date(t.Year(), t.Month(), t.Day()+1, hour, minute, 0, 0, guiLocation)
+	}
+	return next
+}
@@ -89,6 +89,16 @@ func TestDateHourSub(t *testing.T) {
 	}
 }
 
+func TestDateHourHoursUntil(t *testing.T) {
+	from := DateHour{Date: "2025-01-01", Hour: 22}
+	if h := from.HoursUntil(DateHour{Date: "2025-01-02", Hour: 3}); h != 5 {
+		t.Errorf("HoursUntil() expected 5, got %d", h)
+	}
+	if h := from.HoursUntil(DateHour{Date: "2025-01-01", Hour: 20}); h != -2 {
+		t.Errorf("HoursUntil() expected -2, got %d", h)
+	}
+}
+
 func TestDateHourIsZero(t *testing.T) {
 	// A zero value DateHour should be recognized as zero.
 	var dh DateHour
@@ -180,3 +190,25 @@ func TestLocationStockholm(t *testing.T) {
 		t.Errorf("LocationStockholm() on summer date expected offset 7200 seconds, got %d", offsetSummer)
 	}
 }
+
+func TestNextTimeOfDay(t *testing.T) {
+	if err := SetGuiTimezone("Europe/Stockholm"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetGuiTimezone("UTC")
+
+	// 22:30 in Stockholm (UTC+2), 07:00 is tomorrow morning
+	after := time.Date(2025, time.June, 1, 20, 30, 0, 0, time.UTC)
+	next := NextTimeOfDay(7, 0, after)
+	expected := time.Date(2025, time.June, 2, 5, 0, 0, 0, time.UTC)
+	if !next.Equal(expected) {
+		t.Errorf("NextTimeOfDay() expected %v, got %v", expected, next)
+	}
+
+	// 23:00 is later today
+	next = NextTimeOfDay(23, 0, after)
+	expected = time.Date(2025, time.June, 1, 21, 0, 0, 0, time.UTC)
+	if !next.Equal(expected) {
+		t.Errorf("NextTimeOfDay() expected %v, got %v", expected, next)
+	}
+}
@@ -0,0 +1,42 @@
+package hours
+
+import (
+	"fmt"
+	"time"
+)
+
+// A time of day window in minutes after midnight, spans midnight if To is before From
+type TimeWindow struct {
+	From int
+	To   int
+}
+
+// Parses a window given as "HH:MM" to "HH:MM"
+func ParseTimeWindow(from, to string) (TimeWindow, error) {
+	f, err := time.Parse("15:04", from)
+	if err != nil {
+		return TimeWindow{}, fmt.Errorf("invalid window start %q, expected HH:MM", from)
+	}
+	t, err := time.Parse("15:04", to)
+	if err != nil {
+		return TimeWindow{}, fmt.Errorf("invalid window end %q, expected HH:MM", to)
+	}
+	return TimeWindow{From: f.Hour()*60 + f.Minute(), To: t.Hour()*60 + t.Minute()}, nil
+}
+
+func (w TimeWindow) Contains(minuteOfDay int) bool {
+	if w.From <= w.To {
+		return minuteOfDay >= w.From && minuteOfDay < w.To
+	}
+	return minuteOfDay >= w.From || minuteOfDay < w.To
+}
+
+// Whether the time of day in the GUI timezone is within the window
+func (w TimeWindow) ContainsTime(t time.Time) bool {
+	local := t.In(guiLocation)
+	return w.Contains(local.Hour()*60 + local.Minute())
+}
+
+func (w TimeWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.From/60, w.From%60, w.To/60, w.To%60)
+}
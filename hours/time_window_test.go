@@ -0,0 +1,42 @@
+package hours
+
+import "testing"
+
+func TestTimeWindowContains(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		minute   int
+		expected bool
+	}{
+		{"inside", "08:00", "16:00", 10 * 60, true},
+		{"at start", "08:00", "16:00", 8 * 60, true},
+		{"at end", "08:00", "16:00", 16 * 60, false},
+		{"before", "08:00", "16:00", 7*60 + 59, false},
+		{"over midnight, evening", "22:00", "06:00", 23 * 60, true},
+		{"over midnight, morning", "22:00", "06:00", 5 * 60, true},
+		{"over midnight, day", "22:00", "06:00", 12 * 60, false},
+		{"whole day", "00:00", "00:00", 12 * 60, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := ParseTimeWindow(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := w.Contains(tt.minute); got != tt.expected {
+				t.Errorf("Contains(%d) = %v, wanted %v", tt.minute, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseTimeWindowInvalid(t *testing.T) {
+	if _, err := ParseTimeWindow("8", "16:00"); err == nil {
+		t.Error("expected an error for an invalid start")
+	}
+	if _, err := ParseTimeWindow("08:00", "25:00"); err == nil {
+		t.Error("expected an error for an invalid end")
+	}
+}
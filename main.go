@@ -13,11 +13,21 @@ import (
 
 	"github.com/icodeforyou/solarplant-go/config"
 	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/ecb"
 	"github.com/icodeforyou/solarplant-go/elprisetjustnu"
+	"github.com/icodeforyou/solarplant-go/entsoe"
+	"github.com/icodeforyou/solarplant-go/evcharger"
 	"github.com/icodeforyou/solarplant-go/ferroamp"
+	"github.com/icodeforyou/solarplant-go/flexload"
 	"github.com/icodeforyou/solarplant-go/hours"
 	"github.com/icodeforyou/solarplant-go/logging"
+	"github.com/icodeforyou/solarplant-go/metno"
 	"github.com/icodeforyou/solarplant-go/nordpool"
+	"github.com/icodeforyou/solarplant-go/ocpp"
+	"github.com/icodeforyou/solarplant-go/openmeteo"
+	"github.com/icodeforyou/solarplant-go/optimize"
+	"github.com/icodeforyou/solarplant-go/reserve"
+	"github.com/icodeforyou/solarplant-go/smhi"
 	"github.com/icodeforyou/solarplant-go/task"
 	"github.com/icodeforyou/solarplant-go/types"
 	"github.com/icodeforyou/solarplant-go/www"
@@ -79,7 +89,9 @@ func main() {
 		cnfg.Ferroamp.Host,
 		cnfg.Ferroamp.Port,
 		cnfg.Ferroamp.Username,
-		cnfg.Ferroamp.Password)
+		cnfg.Ferroamp.Password,
+		cnfg.Ferroamp.GetKeepAlive(),
+		cnfg.Ferroamp.AutoOnConnectionLoss)
 
 	faInMem := ferroamp.NewFaInMemData()
 	fa.OnEhubMessage = faInMem.SetEHub
@@ -97,6 +109,13 @@ func main() {
 		fa.Disconnect()
 		exitWithError(logger, fmt.Errorf("ferroamp mqtt traffic is dead, terminating..."))
 	}
+	faConnected := make(chan struct{}, 1)
+	fa.OnConnect = func() {
+		select {
+		case faConnected <- struct{}{}:
+		default:
+		}
+	}
 
 	if isDevMode() {
 		logger.Info("dev mode, skipping ferroamp connection")
@@ -105,14 +124,50 @@ func main() {
 			panic(fmt.Sprintf("ferroamp connection error: %v", err))
 		}
 		defer fa.Disconnect()
+		defer setBatteryAutoOnShutdown(logger, db, fa)
+	}
+
+	var energyPriceProviders []types.EnergyPriceProvider
+	ep := cnfg.EnergyPrice
+	for _, name := range ep.GetProviders() {
+		switch name {
+		case "elprisetjustnu":
+			provider, err := elprisetjustnu.New(ep.Area, ep.GetCurrency())
+			if err != nil {
+				panic(fmt.Sprintf("energy price provider error: %v", err))
+			}
+			energyPriceProviders = append(energyPriceProviders, provider)
+		case "nordpool":
+			energyPriceProviders = append(energyPriceProviders, nordpool.New(ep.Area, ep.GetCurrency()))
+		case "entsoe":
+			var exchangeRate types.ExchangeRateProvider = ecb.New(ecb.BASE_URL, ep.GetCurrency())
+			if ep.GetCurrency() == "EUR" {
+				exchangeRate = types.FixedExchangeRate(1)
+			} else if ep.Entsoe.ExchangeRate != nil {
+				exchangeRate = types.FixedExchangeRate(*ep.Entsoe.ExchangeRate)
+			}
+			energyPriceProviders = append(energyPriceProviders, entsoe.New(entsoe.BASE_URL, ep.Entsoe.Token, ep.Area, exchangeRate))
+		default:
+			panic(fmt.Sprintf("unknown energy price provider: %s", name))
+		}
 	}
 
-	energyPriceProviders := []types.EnergyPriceProvider{
-		elprisetjustnu.New(cnfg.EnergyPrice.Area), // Primary provider
-		nordpool.New(cnfg.EnergyPrice.Area),       // Secondary provider
+	var weatherForecastProviders []types.WeatherForecastProvider
+	wf := cnfg.WeatherForecast
+	for _, name := range wf.GetProviders() {
+		switch name {
+		case "smhi":
+			weatherForecastProviders = append(weatherForecastProviders, smhi.New(smhi.BASE_URL, wf.Latitude, wf.Longitude))
+		case "open_meteo":
+			weatherForecastProviders = append(weatherForecastProviders, openmeteo.New(openmeteo.BASE_URL, wf.Latitude, wf.Longitude))
+		case "met_norway":
+			weatherForecastProviders = append(weatherForecastProviders, metno.New(metno.BASE_URL, wf.Latitude, wf.Longitude))
+		default:
+			panic(fmt.Sprintf("unknown weather forecast provider: %s", name))
+		}
 	}
 
-	tasks := task.NewTasks(db, energyPriceProviders, faInMem, recentHours, cnfg)
+	tasks := task.NewTasks(db, weatherForecastProviders, energyPriceProviders, faInMem, recentHours, cnfg)
 	if isDevMode() {
 		logger.Info("dev mode, skipping task scheduling")
 	} else {
@@ -121,17 +176,92 @@ func main() {
 	}
 
 	regulatorStrategy := task.BatteryRegulatorStrategy{
-		Interval:        time.Second * 10,
-		UpdateThreshold: 0.1,
-		GridMaxPower:    cnfg.Planner.GridMaxPower,
+		Interval:             time.Second * 10,
+		UpdateThreshold:      0.1,
+		GridMaxPower:         cnfg.Planner.GridMaxPower,
+		ExportCap:            cnfg.Planner.GetGridMaxExport(),
+		SocDeviation:         cnfg.BatteryRegulatorStrategy.GetReplanSocDeviation(),
+		ConsumptionDeviation: cnfg.BatteryRegulatorStrategy.GetReplanConsumptionDeviation(),
+		ReplanMinInterval:    cnfg.BatteryRegulatorStrategy.GetReplanMinInterval(),
+		MaxPlanAge:           cnfg.BatteryRegulatorStrategy.GetMaxPlanAge(),
+	}
+	reservePolicy, err := reserve.New(cnfg.BatteryReserve)
+	if err != nil {
+		panic(fmt.Sprintf("battery reserve config error: %v", err))
 	}
-	batteryRegulator := task.NewBatteryRegulator(logger, db, cnfg.BatterySpec, faInMem, regulatorStrategy)
+	derating, err := optimize.NewDerating(cnfg.BatterySpec)
+	if err != nil {
+		panic(fmt.Sprintf("battery derating config error: %v", err))
+	}
+	batteryRegulator := task.NewBatteryRegulator(logger, db, cnfg.BatterySpec, reservePolicy, derating, faInMem, regulatorStrategy, tasks.Events)
 	if isDevMode() {
 		logger.Info("dev mode, skipping battery regulator")
 	} else {
 		batteryRegulator.Run(ctx)
 	}
 
+	wearTracker := task.NewBatteryWearTracker(logger.With("module", "battery_wear"), db, faInMem, cnfg.BatterySpec, time.Minute)
+	if isDevMode() {
+		logger.Info("dev mode, skipping battery wear tracker")
+	} else {
+		wearTracker.Run(ctx)
+	}
+
+	var evCharger types.EvCharger
+	ev := cnfg.EvCharger
+	switch ev.Driver {
+	case "":
+		// No charger
+	case "ocpp":
+		cs := ocpp.NewCentralSystem(ev.Ocpp.ChargePointId)
+		cs.Run(ctx, ev.Ocpp.GetPort())
+		evCharger = cs
+	case "http":
+		h := evcharger.NewHttp(ev.Http.Url, ev.Http.GetPollInterval())
+		h.Run(ctx)
+		evCharger = h
+	case "mqtt":
+		m := evcharger.NewMqtt(ev.Mqtt.Host, ev.Mqtt.Port, ev.Mqtt.Username, ev.Mqtt.Password, ev.Mqtt.StatusTopic, ev.Mqtt.CommandTopic)
+		if err := m.Connect(); err != nil {
+			panic(fmt.Sprintf("ev charger connection error: %v", err))
+		}
+		defer m.Disconnect()
+		evCharger = m
+	default:
+		panic(fmt.Sprintf("unknown ev charger driver: %s", ev.Driver))
+	}
+
+	if evCharger != nil {
+		evChargerController := task.NewEvChargerController(logger.With("module", "ev_charger"), db, evCharger, ev.GetInterval(), ev.MaxPower)
+		if isDevMode() {
+			logger.Info("dev mode, skipping ev charger controller")
+		} else {
+			evChargerController.Run(ctx)
+		}
+	}
+
+	loads, err := flexload.FromConfigs(cnfg.FlexibleLoads)
+	if err != nil {
+		panic(fmt.Sprintf("flexible load config error: %v", err))
+	}
+	var loadController *task.FlexibleLoadController
+	if len(loads) > 0 {
+		switches := make(map[string]types.LoadSwitch, len(loads))
+		for _, c := range cnfg.FlexibleLoads {
+			s, err := flexload.NewSwitch(c)
+			if err != nil {
+				panic(fmt.Sprintf("flexible load config error: %v", err))
+			}
+			switches[c.Name] = s
+		}
+		loadController = task.NewFlexibleLoadController(logger.With("module", "flexible_load"), db, loads, switches, 30*time.Second)
+		if isDevMode() {
+			logger.Info("dev mode, skipping flexible load controller")
+		} else {
+			loadController.Run(ctx)
+		}
+	}
+
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
 
@@ -144,29 +274,38 @@ func main() {
 			case sig := <-sigCh:
 				logger.Info("received signal", slog.Any("signal", sig))
 				cancel()
+			case <-faConnected:
+				// The broker may have set the battery to auto while the connection was lost
+				batteryRegulator.Resend()
 			case batt := <-batteryRegulator.C:
-				switch batt.Action {
-				case task.ActionAuto:
-					if err := fa.SetBatteryAuto(); err != nil {
-						logger.Error("failed to set battery to auto mode", slog.Any("error", err))
-					}
-				case task.ActionCharge:
-					if err := fa.SetBatteryLoad(-batt.Power); err != nil {
-						logger.Error("failed to set battery to charge mode", slog.Any("error", err))
-					}
-				case task.ActionDischarge:
-					if err := fa.SetBatteryLoad(batt.Power); err != nil {
-						logger.Error("failed to set battery to discharge mode", slog.Any("error", err))
-					}
-				}
+				task.SendBatteryInstruction(ctx, logger, db, fa, batt)
 			}
 		}
 	}()
 
-	server := www.StartServer(db, tasks, faInMem, recentHours, cnfg, Version)
+	server := www.StartServer(db, tasks, faInMem, recentHours, cnfg, evCharger, loadController, Version)
 	server.Run(ctx)
 }
 
+// Hands the battery back to the ESO, it otherwise stays in the last charge or discharge
+// mode after solarplant has stopped
+func setBatteryAutoOnShutdown(logger *slog.Logger, db *database.Database, fa *ferroamp.Ferroamp) {
+	// The database is closed once this returns, a late answer from the ESO isn't logged
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		bi := task.BatteryInstruction{Action: task.ActionAuto, Reason: task.ReasonShutdown}
+		task.SendBatteryInstruction(ctx, logger, db, fa, bi)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		logger.Warn("timed out waiting for the battery to be set to auto mode on shutdown")
+	}
+}
+
 func isDevMode() bool {
 	return strings.EqualFold(os.Getenv("APP_ENV"), "development")
 }
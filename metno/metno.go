@@ -0,0 +1,113 @@
+package metno
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/types"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
+)
+
+const BASE_URL = "https://api.met.no"
+
+// MET Norway requires an identifying user agent, see https://api.met.no/doc/TermsOfService
+const userAgent = "solarplant-go github.com/icodeforyou/solarplant-go"
+
+type details struct {
+	AirTemperature      *float64 `json:"air_temperature"`
+	CloudAreaFraction   *float64 `json:"cloud_area_fraction"`
+	PrecipitationAmount *float64 `json:"precipitation_amount"`
+	WindSpeedOfGust     *float64 `json:"wind_speed_of_gust"`
+}
+
+type locationForecast struct {
+	Properties struct {
+		Timeseries []struct {
+			Time time.Time `json:"time"`
+			Data struct {
+				Instant struct {
+					Details details `json:"details"`
+				} `json:"instant"`
+				Next1Hours *struct {
+					Details details `json:"details"`
+				} `json:"next_1_hours"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"properties"`
+}
+
+type MetNo struct {
+	baseUrl   string
+	latitude  float64
+	longitude float64
+}
+
+func New(baseUrl string, latitude float64, longitude float64) MetNo {
+	return MetNo{baseUrl: baseUrl, latitude: latitude, longitude: longitude}
+}
+
+func (m MetNo) GetWeatherForecast(ctx context.Context) ([]types.WeatherForecast, error) {
+	// Coordinates must not have more than 4 decimals, otherwise the request is rejected
+	url := fmt.Sprintf("%s/weatherapi/locationforecast/2.0/complete?lat=%0.4f&lon=%0.4f",
+		m.baseUrl, m.latitude, m.longitude)
+
+	slog.Default().Info("fetching forecast from MET Norway...", "url", url)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MET Norway request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	client := http.Client{Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting MET Norway forecast: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from MET Norway: %d", res.StatusCode)
+	}
+
+	var data locationForecast
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("error unmarshaling MET Norway json: %w", err)
+	}
+
+	result := make([]types.WeatherForecast, 0, len(data.Properties.Timeseries))
+	for _, entry := range data.Properties.Timeseries {
+		// Only the first days are given with hourly resolution
+		if entry.Data.Next1Hours == nil {
+			break
+		}
+		instant := entry.Data.Instant.Details
+		if instant.AirTemperature == nil || instant.CloudAreaFraction == nil {
+			continue
+		}
+		windGust := maybe.None[float64]()
+		if instant.WindSpeedOfGust != nil {
+			windGust = maybe.Some(*instant.WindSpeedOfGust)
+		}
+		precipitation := 0.0
+		if p := entry.Data.Next1Hours.Details.PrecipitationAmount; p != nil {
+			precipitation = *p
+		}
+
+		result = append(result, types.WeatherForecast{
+			Hour:           hours.FromTime(entry.Time),
+			CloudCover:     calc.PercentageToOctas(*instant.CloudAreaFraction),
+			Temperature:    *instant.AirTemperature,
+			Precipitation:  precipitation,
+			SolarRadiation: maybe.None[float64](), // Not provided by locationforecast
+			WindGust:       windGust,
+		})
+	}
+
+	return result, nil
+}
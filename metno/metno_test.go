@@ -0,0 +1,46 @@
+package metno
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+func TestGetWeatherForecast(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Query().Get("lat") != "56.8619" || r.URL.Query().Get("lon") != "12.6905" {
+			t.Errorf("unexpected coordinates %s", r.URL.RawQuery)
+		}
+		http.ServeFile(w, r, "testdata/complete.json")
+	}))
+	defer srv.Close()
+
+	fc, err := New(srv.URL, 56.861942539036484, 12.690466557283774).GetWeatherForecast(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The last entry only has a 6 hour summary and should be skipped
+	if len(fc) != 2 {
+		t.Fatalf("got %d hours, wanted 2", len(fc))
+	}
+	if fc[0].Hour != (hours.DateHour{Date: "2025-06-01", Hour: 10}) {
+		t.Errorf("got hour %s, wanted 2025-06-01 10", fc[0].Hour)
+	}
+	if fc[0].CloudCover != 1 || fc[0].Temperature != 17.1 {
+		t.Errorf("unexpected forecast %+v", fc[0])
+	}
+	if fc[1].CloudCover != 8 || fc[1].Precipitation != 0.7 {
+		t.Errorf("unexpected forecast %+v", fc[1])
+	}
+	if !fc[1].WindGust.IsValid() || fc[1].WindGust.Value() != 9.6 {
+		t.Errorf("got wind gust %v, wanted 9.6", fc[1].WindGust)
+	}
+}
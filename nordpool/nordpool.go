@@ -23,11 +23,18 @@ type nordpoolData struct {
 }
 
 type Nordpool struct {
-	area string
+	area     string
+	currency string
 }
 
-func New(area string) Nordpool {
-	return Nordpool{area: area}
+// The area is a Nord Pool delivery area, e.g. "SE3", "NO1", "DK2" or "FI"
+// and the currency one of "EUR", "SEK", "NOK" or "DKK"
+func New(area string, currency string) Nordpool {
+	return Nordpool{area: area, currency: currency}
+}
+
+func (n Nordpool) Name() string {
+	return "nordpool"
 }
 
 func (n Nordpool) GetEnergyPrices(ctx context.Context) ([]types.EnergyPrice, error) {
@@ -51,10 +58,11 @@ func (n Nordpool) GetEnergyPrices(ctx context.Context) ([]types.EnergyPrice, err
 }
 
 func (n Nordpool) getEnergyPrices(ctx context.Context, date time.Time) ([]types.EnergyPrice, error) {
-	url := fmt.Sprintf("%s/api/DayAheadPrices?date=%s&market=DayAhead&deliveryArea=%s&currency=SEK",
+	url := fmt.Sprintf("%s/api/DayAheadPrices?date=%s&market=DayAhead&deliveryArea=%s&currency=%s",
 		"https://dataportal-api.nordpoolgroup.com",
 		date.Format("2006-01-02"),
-		n.area)
+		n.area,
+		n.currency)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -0,0 +1,347 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+// Id tag used when the central system starts a transaction, any tag a charge point asks about is accepted
+const idTag = "solarplant"
+
+// A minimal OCPP 1.6J central system for a single charge point. The charge point connects
+// to ws://<host>:<port>/ocpp/<charge point id>, charging is paused by a zero power charging
+// profile so the session is kept.
+type CentralSystem struct {
+	logger        *slog.Logger
+	chargePointId string // Accepts any charge point if empty
+	upgrader      ws.Upgrader
+	mu            sync.RWMutex
+	conn          *conn
+	status        types.EvChargerStatus
+	connectorId   int
+	transactionId int     // Zero when there's no ongoing transaction
+	meterStart    float64 // Meter reading in kWh when the transaction started
+	lastTxId      int
+}
+
+func NewCentralSystem(chargePointId string) *CentralSystem {
+	return &CentralSystem{
+		logger:        slog.Default().With("module", "ocpp"),
+		chargePointId: chargePointId,
+		upgrader: ws.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			Subprotocols:    []string{subprotocol},
+		},
+		status:      types.EvChargerStatus{State: types.EvChargerUnavailable},
+		connectorId: 1,
+	}
+}
+
+func (cs *CentralSystem) Name() string {
+	return "ocpp"
+}
+
+func (cs *CentralSystem) Status() types.EvChargerStatus {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.status
+}
+
+// Listens for the charge point until the context is done
+func (cs *CentralSystem) Run(ctx context.Context, port int) {
+	mux := http.NewServeMux()
+	mux.Handle("/ocpp/", cs)
+	srv := &http.Server{Addr: fmt.Sprintf(":%d", port), Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	go func() {
+		cs.logger.Info("ocpp central system listening", slog.Int("port", port))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			cs.logger.Error("ocpp central system failed", slog.Any("error", err))
+		}
+	}()
+}
+
+func (cs *CentralSystem) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := path.Base(r.URL.Path)
+	if cs.chargePointId != "" && id != cs.chargePointId {
+		cs.logger.Warn("unknown charge point tried to connect", slog.String("chargePointId", id))
+		http.NotFound(w, r)
+		return
+	}
+
+	wsConn, err := cs.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		cs.logger.Error("ocpp websocket upgrade failed", slog.Any("error", err))
+		return
+	}
+
+	c := newConn(wsConn, cs.handle)
+	cs.mu.Lock()
+	if cs.conn != nil {
+		cs.conn.close() // The charge point reconnected
+	}
+	cs.conn = c
+	cs.mu.Unlock()
+	cs.logger.Info("charge point connected", slog.String("chargePointId", id), slog.String("remoteAddr", r.RemoteAddr))
+
+	err = c.run()
+
+	cs.mu.Lock()
+	if cs.conn == c {
+		cs.conn = nil
+		cs.status.State = types.EvChargerUnavailable
+		cs.status.Power = 0
+	}
+	cs.mu.Unlock()
+	cs.logger.Warn("charge point disconnected", slog.String("chargePointId", id), slog.Any("error", err))
+}
+
+// Pauses charging with a zero power charging profile, or removes it and
+// starts a transaction if the vehicle is connected but there's none
+func (cs *CentralSystem) SetCharging(ctx context.Context, enabled bool) error {
+	cs.mu.RLock()
+	c := cs.conn
+	connectorId := cs.connectorId
+	transactionId := cs.transactionId
+	vehicleConnected := cs.status.VehicleConnected()
+	cs.mu.RUnlock()
+
+	if c == nil {
+		return fmt.Errorf("charge point is not connected")
+	}
+
+	if !enabled {
+		var res statusConf
+		err := c.call(ctx, "SetChargingProfile", setChargingProfileReq{
+			ConnectorId: 0, // All connectors
+			CsChargingProfiles: chargingProfile{
+				ChargingProfileId:      pauseProfileId,
+				StackLevel:             0,
+				ChargingProfilePurpose: "TxDefaultProfile",
+				ChargingProfileKind:    "Relative",
+				ChargingSchedule: chargingSchedule{
+					ChargingRateUnit:       "W",
+					ChargingSchedulePeriod: []chargingSchedulePeriod{{StartPeriod: 0, Limit: 0}},
+				},
+			},
+		}, &res)
+		if err != nil {
+			return fmt.Errorf("pausing charging: %w", err)
+		}
+		if res.Status != "Accepted" {
+			return fmt.Errorf("pausing charging: charging profile %s", res.Status)
+		}
+		return nil
+	}
+
+	id := pauseProfileId
+	var res statusConf
+	if err := c.call(ctx, "ClearChargingProfile", clearChargingProfileReq{Id: &id}, &res); err != nil {
+		return fmt.Errorf("resuming charging: %w", err)
+	}
+	// Unknown means there was no profile to clear, which is fine
+	if res.Status != "Accepted" && res.Status != "Unknown" {
+		return fmt.Errorf("resuming charging: clearing charging profile %s", res.Status)
+	}
+
+	if vehicleConnected && transactionId == 0 {
+		if err := c.call(ctx, "RemoteStartTransaction", remoteStartTransactionReq{ConnectorId: &connectorId, IdTag: idTag}, &res); err != nil {
+			return fmt.Errorf("starting transaction: %w", err)
+		}
+		if res.Status != "Accepted" {
+			return fmt.Errorf("starting transaction: %s", res.Status)
+		}
+	}
+
+	return nil
+}
+
+func (cs *CentralSystem) handle(action string, payload json.RawMessage) (any, error) {
+	cs.logger.Debug("received ocpp call", slog.String("action", action))
+	now := time.Now()
+
+	switch action {
+	case "BootNotification":
+		var req bootNotificationReq
+		if err := decode(payload, &req); err != nil {
+			return nil, err
+		}
+		cs.logger.Info("charge point booted", slog.String("vendor", req.ChargePointVendor), slog.String("model", req.ChargePointModel))
+		cs.touch(now)
+		return bootNotificationConf{Status: "Accepted", CurrentTime: timestamp(now), Interval: 60}, nil
+
+	case "Heartbeat":
+		cs.touch(now)
+		return heartbeatConf{CurrentTime: timestamp(now)}, nil
+
+	case "Authorize":
+		var req authorizeReq
+		if err := decode(payload, &req); err != nil {
+			return nil, err
+		}
+		return authorizeConf{IdTagInfo: idTagInfo{Status: "Accepted"}}, nil
+
+	case "StatusNotification":
+		var req statusNotificationReq
+		if err := decode(payload, &req); err != nil {
+			return nil, err
+		}
+		cs.onStatusNotification(req, now)
+		return emptyConf{}, nil
+
+	case "StartTransaction":
+		var req startTransactionReq
+		if err := decode(payload, &req); err != nil {
+			return nil, err
+		}
+		return cs.onStartTransaction(req, now), nil
+
+	case "StopTransaction":
+		var req stopTransactionReq
+		if err := decode(payload, &req); err != nil {
+			return nil, err
+		}
+		cs.onStopTransaction(req, now)
+		return stopTransactionConf{IdTagInfo: &idTagInfo{Status: "Accepted"}}, nil
+
+	case "MeterValues":
+		var req meterValuesReq
+		if err := decode(payload, &req); err != nil {
+			return nil, err
+		}
+		cs.onMeterValues(req, now)
+		return emptyConf{}, nil
+
+	case "DataTransfer":
+		return statusConf{Status: "UnknownVendorId"}, nil
+
+	case "DiagnosticsStatusNotification", "FirmwareStatusNotification":
+		return emptyConf{}, nil
+
+	default:
+		return nil, notImplemented(action)
+	}
+}
+
+func (cs *CentralSystem) touch(now time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.status.Updated = now
+}
+
+func (cs *CentralSystem) onStatusNotification(req statusNotificationReq, now time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.status.Updated = now
+	if req.ConnectorId == 0 {
+		// The whole charge point, only a fault or unavailability is of interest
+		if req.Status == statusFaulted {
+			cs.status.State = types.EvChargerFaulted
+		}
+		return
+	}
+
+	cs.connectorId = req.ConnectorId
+	state := chargerState(req.Status)
+	if state != cs.status.State {
+		cs.logger.Info("charge point status changed",
+			slog.String("status", req.Status),
+			slog.String("state", string(state)),
+			slog.String("errorCode", req.ErrorCode))
+	}
+	cs.status.State = state
+	if state != types.EvChargerCharging {
+		cs.status.Power = 0
+	}
+}
+
+func chargerState(status string) types.EvChargerState {
+	switch status {
+	case statusAvailable, statusReserved:
+		return types.EvChargerAvailable
+	case statusPreparing, statusSuspendedEV, statusSuspendedEVSE, statusFinishing:
+		return types.EvChargerConnected
+	case statusCharging:
+		return types.EvChargerCharging
+	case statusFaulted:
+		return types.EvChargerFaulted
+	default:
+		return types.EvChargerUnavailable
+	}
+}
+
+func (cs *CentralSystem) onStartTransaction(req startTransactionReq, now time.Time) startTransactionConf {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	// Transaction ids must be unique, starting from the time avoids reuse after a restart
+	cs.lastTxId = max(cs.lastTxId+1, int(now.Unix()%1_000_000_000))
+	cs.transactionId = cs.lastTxId
+	cs.connectorId = req.ConnectorId
+	cs.meterStart = float64(req.MeterStart) / 1000
+	cs.status.Meter = cs.meterStart
+	cs.status.SessionEnergy = 0
+	cs.status.Updated = now
+	cs.logger.Info("transaction started",
+		slog.Int("transactionId", cs.transactionId),
+		slog.Int("connectorId", req.ConnectorId),
+		slog.String("idTag", req.IdTag))
+	return startTransactionConf{TransactionId: cs.transactionId, IdTagInfo: idTagInfo{Status: "Accepted"}}
+}
+
+func (cs *CentralSystem) onStopTransaction(req stopTransactionReq, now time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	meterStop := float64(req.MeterStop) / 1000
+	if req.TransactionId == cs.transactionId {
+		cs.status.SessionEnergy = max(meterStop-cs.meterStart, 0)
+		cs.transactionId = 0
+	}
+	cs.status.Meter = meterStop
+	cs.status.Power = 0
+	cs.status.Updated = now
+	cs.logger.Info("transaction stopped",
+		slog.Int("transactionId", req.TransactionId),
+		slog.String("reason", req.Reason),
+		slog.Float64("sessionEnergy", cs.status.SessionEnergy))
+}
+
+func (cs *CentralSystem) onMeterValues(req meterValuesReq, now time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.status.Updated = now
+	for _, mv := range req.MeterValue {
+		for _, sv := range mv.SampledValue {
+			v, err := sv.kilo()
+			if err != nil {
+				cs.logger.Warn("invalid meter value", slog.String("value", sv.Value), slog.Any("error", err))
+				continue
+			}
+			switch sv.Measurand {
+			case "", measurandEnergy:
+				cs.status.Meter = v
+				if cs.transactionId != 0 {
+					cs.status.SessionEnergy = max(v-cs.meterStart, 0)
+				}
+			case measurandPower:
+				cs.status.Power = v
+			}
+		}
+	}
+}
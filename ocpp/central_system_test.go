@@ -0,0 +1,148 @@
+package ocpp
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+func connect(t *testing.T, cs *CentralSystem, id string) (*Simulator, func()) {
+	srv := httptest.NewServer(cs)
+	sim := NewSimulator(id, 11)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ocpp"
+	if err := sim.Connect(context.Background(), url); err != nil {
+		srv.Close()
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return sim, func() {
+		sim.Close()
+		srv.Close()
+	}
+}
+
+// Some status changes are notified after the call that caused them has been answered
+func waitForState(t *testing.T, cs *CentralSystem, state types.EvChargerState) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for cs.Status().State != state {
+		if time.Now().After(deadline) {
+			t.Fatalf("got state %s, wanted %s", cs.Status().State, state)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCentralSystemSession(t *testing.T) {
+	ctx := context.Background()
+	cs := NewCentralSystem("CP1")
+	sim, closeFn := connect(t, cs, "CP1")
+	defer closeFn()
+
+	waitForState(t, cs, types.EvChargerAvailable)
+
+	if err := sim.PlugIn(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForState(t, cs, types.EvChargerCharging)
+
+	if err := sim.Tick(ctx, 30*time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	status := cs.Status()
+	if status.Power != 11 || math.Abs(status.SessionEnergy-5.5) > 0.001 || math.Abs(status.Meter-5.5) > 0.001 {
+		t.Errorf("unexpected status while charging %+v", status)
+	}
+
+	if err := cs.SetCharging(ctx, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForState(t, cs, types.EvChargerConnected)
+	if err := sim.Tick(ctx, 30*time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if status := cs.Status(); status.Power != 0 || math.Abs(status.SessionEnergy-5.5) > 0.001 {
+		t.Errorf("unexpected status while paused %+v", status)
+	}
+
+	if err := cs.SetCharging(ctx, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForState(t, cs, types.EvChargerCharging)
+	if err := sim.Tick(ctx, 15*time.Minute); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := sim.Unplug(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForState(t, cs, types.EvChargerAvailable)
+	if status := cs.Status(); math.Abs(status.SessionEnergy-8.25) > 0.001 || status.Power != 0 {
+		t.Errorf("unexpected status after the session %+v", status)
+	}
+}
+
+func TestCentralSystemRemoteStart(t *testing.T) {
+	ctx := context.Background()
+	cs := NewCentralSystem("")
+	sim, closeFn := connect(t, cs, "any")
+	defer closeFn()
+
+	if err := sim.PlugIn(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForState(t, cs, types.EvChargerCharging)
+
+	// Stopped at the charger, e.g. by the app of the car
+	if err := sim.stopTransaction(ctx, "Local"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForState(t, cs, types.EvChargerConnected)
+
+	if err := cs.SetCharging(ctx, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForState(t, cs, types.EvChargerCharging)
+}
+
+func TestCentralSystemUnknownChargePoint(t *testing.T) {
+	cs := NewCentralSystem("CP1")
+	srv := httptest.NewServer(cs)
+	defer srv.Close()
+
+	sim := NewSimulator("CP2", 11)
+	if err := sim.Connect(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http")+"/ocpp"); err == nil {
+		t.Fatal("expected the connection to be refused")
+	}
+}
+
+func TestCentralSystemNotConnected(t *testing.T) {
+	cs := NewCentralSystem("CP1")
+	if cs.Status().State != types.EvChargerUnavailable {
+		t.Errorf("got state %s, wanted %s", cs.Status().State, types.EvChargerUnavailable)
+	}
+	if err := cs.SetCharging(context.Background(), true); err == nil {
+		t.Error("expected an error when no charge point is connected")
+	}
+}
+
+func TestCallNotImplemented(t *testing.T) {
+	cs := NewCentralSystem("CP1")
+	sim, closeFn := connect(t, cs, "CP1")
+	defer closeFn()
+
+	sim.mu.Lock()
+	c := sim.conn
+	sim.mu.Unlock()
+
+	var ce *CallError
+	err := c.call(context.Background(), "ReserveNow", struct{}{}, nil)
+	if !errors.As(err, &ce) || ce.Code != "NotImplemented" {
+		t.Errorf("got error %v, wanted NotImplemented", err)
+	}
+}
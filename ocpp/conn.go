@@ -0,0 +1,197 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+const (
+	subprotocol = "ocpp1.6"
+	writeWait   = 10 * time.Second
+)
+
+var errConnectionClosed = errors.New("ocpp connection closed")
+
+// An error answered to a call, e.g. "NotImplemented" for unsupported actions
+type CallError struct {
+	Code        string
+	Description string
+}
+
+func (e *CallError) Error() string {
+	return fmt.Sprintf("ocpp call error %s: %s", e.Code, e.Description)
+}
+
+// Handles a call from the other side and returns the response payload, or a *CallError
+type callHandler func(action string, payload json.RawMessage) (any, error)
+
+type callResult struct {
+	payload json.RawMessage
+	err     error
+}
+
+// A JSON-RPC like OCPP-J connection, used by both the central system and the simulator
+type conn struct {
+	ws      *ws.Conn
+	handle  callHandler
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	pending map[string]chan callResult
+	nextId  uint64
+	closed  bool
+}
+
+func newConn(wsConn *ws.Conn, handle callHandler) *conn {
+	return &conn{
+		ws:      wsConn,
+		handle:  handle,
+		pending: make(map[string]chan callResult),
+	}
+}
+
+// Sends a call and waits for the result, that is unmarshaled into res if not nil
+func (c *conn) call(ctx context.Context, action string, req any, res any) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return errConnectionClosed
+	}
+	c.nextId++
+	id := strconv.FormatUint(c.nextId, 10)
+	ch := make(chan callResult, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write([]any{messageTypeCall, id, action, req}); err != nil {
+		return fmt.Errorf("sending %s: %w", action, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for %s result: %w", action, ctx.Err())
+	case r := <-ch:
+		if r.err != nil {
+			return r.err
+		}
+		if res != nil {
+			if err := json.Unmarshal(r.payload, res); err != nil {
+				return fmt.Errorf("decoding %s result: %w", action, err)
+			}
+		}
+		return nil
+	}
+}
+
+func (c *conn) write(msg []any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return c.ws.WriteJSON(msg)
+}
+
+// Reads messages until the connection fails, incoming calls are handled one at a time
+func (c *conn) run() error {
+	defer c.close()
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return err
+		}
+
+		var msg []json.RawMessage
+		if err := json.Unmarshal(data, &msg); err != nil || len(msg) < 3 {
+			continue // Not an OCPP-J message, nothing to answer
+		}
+		var msgType int
+		var id string
+		if json.Unmarshal(msg[0], &msgType) != nil || json.Unmarshal(msg[1], &id) != nil {
+			continue
+		}
+
+		switch msgType {
+		case messageTypeCall:
+			if len(msg) < 4 {
+				continue
+			}
+			var action string
+			json.Unmarshal(msg[2], &action)
+			if err := c.answer(id, action, msg[3]); err != nil {
+				return err
+			}
+
+		case messageTypeCallResult:
+			c.resolve(id, callResult{payload: msg[2]})
+
+		case messageTypeCallError:
+			ce := &CallError{}
+			json.Unmarshal(msg[2], &ce.Code)
+			if len(msg) > 3 {
+				json.Unmarshal(msg[3], &ce.Description)
+			}
+			c.resolve(id, callResult{err: ce})
+		}
+	}
+}
+
+func (c *conn) answer(id string, action string, payload json.RawMessage) error {
+	res, err := c.handle(action, payload)
+	if err != nil {
+		var ce *CallError
+		if !errors.As(err, &ce) {
+			ce = &CallError{Code: "InternalError", Description: err.Error()}
+		}
+		return c.write([]any{messageTypeCallError, id, ce.Code, ce.Description, struct{}{}})
+	}
+	return c.write([]any{messageTypeCallResult, id, res})
+}
+
+func (c *conn) resolve(id string, r callResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ch, ok := c.pending[id]; ok {
+		select {
+		case ch <- r:
+		default: // Already resolved, e.g. by a duplicated message
+		}
+	}
+}
+
+func (c *conn) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	for _, ch := range c.pending {
+		select {
+		case ch <- callResult{err: errConnectionClosed}:
+		default:
+		}
+	}
+	c.ws.Close()
+}
+
+func notImplemented(action string) error {
+	return &CallError{Code: "NotImplemented", Description: fmt.Sprintf("action %s is not supported", action)}
+}
+
+func decode(payload json.RawMessage, v any) error {
+	if err := json.Unmarshal(payload, v); err != nil {
+		return &CallError{Code: "FormationViolation", Description: err.Error()}
+	}
+	return nil
+}
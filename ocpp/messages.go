@@ -0,0 +1,166 @@
+package ocpp
+
+import (
+	"strconv"
+	"time"
+)
+
+// OCPP-J message types, a call is answered by either a result or an error
+const (
+	messageTypeCall       = 2
+	messageTypeCallResult = 3
+	messageTypeCallError  = 4
+)
+
+// Charge point status as reported in StatusNotification
+const (
+	statusAvailable     = "Available"
+	statusPreparing     = "Preparing"
+	statusCharging      = "Charging"
+	statusSuspendedEVSE = "SuspendedEVSE"
+	statusSuspendedEV   = "SuspendedEV"
+	statusFinishing     = "Finishing"
+	statusReserved      = "Reserved"
+	statusUnavailable   = "Unavailable"
+	statusFaulted       = "Faulted"
+)
+
+const (
+	measurandEnergy = "Energy.Active.Import.Register"
+	measurandPower  = "Power.Active.Import"
+)
+
+// Id of the charging profile used to pause charging, it's replaced rather than stacked
+const pauseProfileId = 1
+
+type idTagInfo struct {
+	Status string `json:"status"`
+}
+
+type bootNotificationReq struct {
+	ChargePointVendor string `json:"chargePointVendor"`
+	ChargePointModel  string `json:"chargePointModel"`
+}
+
+type bootNotificationConf struct {
+	Status      string `json:"status"`
+	CurrentTime string `json:"currentTime"`
+	Interval    int    `json:"interval"`
+}
+
+type heartbeatConf struct {
+	CurrentTime string `json:"currentTime"`
+}
+
+type authorizeReq struct {
+	IdTag string `json:"idTag"`
+}
+
+type authorizeConf struct {
+	IdTagInfo idTagInfo `json:"idTagInfo"`
+}
+
+type statusNotificationReq struct {
+	ConnectorId int    `json:"connectorId"`
+	ErrorCode   string `json:"errorCode"`
+	Status      string `json:"status"`
+}
+
+type startTransactionReq struct {
+	ConnectorId int    `json:"connectorId"`
+	IdTag       string `json:"idTag"`
+	MeterStart  int    `json:"meterStart"` // Wh
+	Timestamp   string `json:"timestamp"`
+}
+
+type startTransactionConf struct {
+	TransactionId int       `json:"transactionId"`
+	IdTagInfo     idTagInfo `json:"idTagInfo"`
+}
+
+type stopTransactionReq struct {
+	TransactionId int    `json:"transactionId"`
+	MeterStop     int    `json:"meterStop"` // Wh
+	Timestamp     string `json:"timestamp"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+type stopTransactionConf struct {
+	IdTagInfo *idTagInfo `json:"idTagInfo,omitempty"`
+}
+
+type sampledValue struct {
+	Value     string `json:"value"`
+	Measurand string `json:"measurand,omitempty"` // Energy.Active.Import.Register if omitted
+	Unit      string `json:"unit,omitempty"`      // Wh if omitted
+}
+
+// Value in kWh or kW, samples are reported in Wh/W unless the unit says otherwise
+func (s sampledValue) kilo() (float64, error) {
+	v, err := strconv.ParseFloat(s.Value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if s.Unit == "kWh" || s.Unit == "kW" {
+		return v, nil
+	}
+	return v / 1000, nil
+}
+
+type meterValue struct {
+	Timestamp    string         `json:"timestamp"`
+	SampledValue []sampledValue `json:"sampledValue"`
+}
+
+type meterValuesReq struct {
+	ConnectorId   int          `json:"connectorId"`
+	TransactionId *int         `json:"transactionId,omitempty"`
+	MeterValue    []meterValue `json:"meterValue"`
+}
+
+type remoteStartTransactionReq struct {
+	ConnectorId *int   `json:"connectorId,omitempty"`
+	IdTag       string `json:"idTag"`
+}
+
+type remoteStopTransactionReq struct {
+	TransactionId int `json:"transactionId"`
+}
+
+type chargingSchedulePeriod struct {
+	StartPeriod int     `json:"startPeriod"`
+	Limit       float64 `json:"limit"`
+}
+
+type chargingSchedule struct {
+	ChargingRateUnit       string                   `json:"chargingRateUnit"`
+	ChargingSchedulePeriod []chargingSchedulePeriod `json:"chargingSchedulePeriod"`
+}
+
+type chargingProfile struct {
+	ChargingProfileId      int              `json:"chargingProfileId"`
+	StackLevel             int              `json:"stackLevel"`
+	ChargingProfilePurpose string           `json:"chargingProfilePurpose"`
+	ChargingProfileKind    string           `json:"chargingProfileKind"`
+	ChargingSchedule       chargingSchedule `json:"chargingSchedule"`
+}
+
+type setChargingProfileReq struct {
+	ConnectorId        int             `json:"connectorId"`
+	CsChargingProfiles chargingProfile `json:"csChargingProfiles"`
+}
+
+type clearChargingProfileReq struct {
+	Id *int `json:"id,omitempty"`
+}
+
+// Response to the calls from the central system that only carry a status
+type statusConf struct {
+	Status string `json:"status"`
+}
+
+type emptyConf struct{}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
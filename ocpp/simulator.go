@@ -0,0 +1,250 @@
+package ocpp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	ws "github.com/gorilla/websocket"
+)
+
+// A simulated OCPP 1.6J charge point with a single connector, used to test the central
+// system. Time is advanced explicitly with Tick so tests are deterministic.
+type Simulator struct {
+	Id            string
+	MaxPower      float64 // Charging power in kW when not limited by a charging profile
+	mu            sync.Mutex
+	conn          *conn
+	vehicle       bool
+	limited       bool // Paused by a zero power charging profile
+	transactionId int
+	meter         float64 // Lifetime meter reading in kWh
+	done          chan struct{}
+}
+
+func NewSimulator(id string, maxPower float64) *Simulator {
+	return &Simulator{Id: id, MaxPower: maxPower}
+}
+
+// Connects to the central system at baseUrl, e.g. ws://localhost:9000/ocpp, and boots
+func (s *Simulator) Connect(ctx context.Context, baseUrl string) error {
+	dialer := ws.Dialer{Subprotocols: []string{subprotocol}}
+	wsConn, _, err := dialer.DialContext(ctx, baseUrl+"/"+s.Id, http.Header{})
+	if err != nil {
+		return fmt.Errorf("connecting charge point simulator: %w", err)
+	}
+
+	s.mu.Lock()
+	s.conn = newConn(wsConn, s.handle)
+	s.done = make(chan struct{})
+	c, done := s.conn, s.done
+	s.mu.Unlock()
+
+	go func() {
+		c.run()
+		close(done)
+	}()
+
+	if err := c.call(ctx, "BootNotification", bootNotificationReq{ChargePointVendor: "solarplant", ChargePointModel: "simulator"}, nil); err != nil {
+		return err
+	}
+	return s.notifyStatus(ctx)
+}
+
+func (s *Simulator) Close() {
+	s.mu.Lock()
+	c, done := s.conn, s.done
+	s.mu.Unlock()
+	if c != nil {
+		c.close()
+		<-done
+	}
+}
+
+// Connects a vehicle and starts a transaction like when a RFID tag is presented
+func (s *Simulator) PlugIn(ctx context.Context) error {
+	s.mu.Lock()
+	s.vehicle = true
+	s.mu.Unlock()
+	if err := s.notifyStatus(ctx); err != nil {
+		return err
+	}
+	return s.startTransaction(ctx)
+}
+
+func (s *Simulator) Unplug(ctx context.Context) error {
+	s.mu.Lock()
+	s.vehicle = false
+	s.mu.Unlock()
+	return s.stopTransaction(ctx, "EVDisconnected")
+}
+
+// Charges for the duration if charging isn't paused, and reports the meter values
+func (s *Simulator) Tick(ctx context.Context, d time.Duration) error {
+	s.mu.Lock()
+	power := s.power()
+	s.meter += power * d.Hours()
+	transactionId := s.transactionId
+	meter := s.meter
+	c := s.conn
+	s.mu.Unlock()
+
+	if transactionId == 0 {
+		return nil
+	}
+	return c.call(ctx, "MeterValues", meterValuesReq{
+		ConnectorId:   1,
+		TransactionId: &transactionId,
+		MeterValue: []meterValue{{
+			Timestamp: timestamp(time.Now()),
+			SampledValue: []sampledValue{
+				{Value: fmt.Sprintf("%.0f", meter*1000), Measurand: measurandEnergy, Unit: "Wh"},
+				{Value: fmt.Sprintf("%.0f", power*1000), Measurand: measurandPower, Unit: "W"},
+			},
+		}},
+	}, nil)
+}
+
+// Lifetime meter reading in kWh
+func (s *Simulator) Meter() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.meter
+}
+
+// Must be called with the lock held
+func (s *Simulator) power() float64 {
+	if s.transactionId == 0 || s.limited {
+		return 0
+	}
+	return s.MaxPower
+}
+
+func (s *Simulator) status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case !s.vehicle:
+		return statusAvailable
+	case s.transactionId == 0:
+		return statusPreparing
+	case s.limited:
+		return statusSuspendedEVSE
+	default:
+		return statusCharging
+	}
+}
+
+func (s *Simulator) notifyStatus(ctx context.Context) error {
+	s.mu.Lock()
+	c := s.conn
+	s.mu.Unlock()
+	return c.call(ctx, "StatusNotification", statusNotificationReq{ConnectorId: 1, ErrorCode: "NoError", Status: s.status()}, nil)
+}
+
+func (s *Simulator) startTransaction(ctx context.Context) error {
+	s.mu.Lock()
+	meter := s.meter
+	c := s.conn
+	s.mu.Unlock()
+
+	var res startTransactionConf
+	err := c.call(ctx, "StartTransaction", startTransactionReq{
+		ConnectorId: 1,
+		IdTag:       idTag,
+		MeterStart:  int(meter * 1000),
+		Timestamp:   timestamp(time.Now()),
+	}, &res)
+	if err != nil {
+		return err
+	}
+	if res.IdTagInfo.Status != "Accepted" {
+		return fmt.Errorf("transaction not accepted: %s", res.IdTagInfo.Status)
+	}
+
+	s.mu.Lock()
+	s.transactionId = res.TransactionId
+	s.mu.Unlock()
+	return s.notifyStatus(ctx)
+}
+
+func (s *Simulator) stopTransaction(ctx context.Context, reason string) error {
+	s.mu.Lock()
+	transactionId := s.transactionId
+	s.transactionId = 0
+	meter := s.meter
+	c := s.conn
+	s.mu.Unlock()
+
+	if transactionId != 0 {
+		err := c.call(ctx, "StopTransaction", stopTransactionReq{
+			TransactionId: transactionId,
+			MeterStop:     int(meter * 1000),
+			Timestamp:     timestamp(time.Now()),
+			Reason:        reason,
+		}, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return s.notifyStatus(ctx)
+}
+
+// Calls that change the status are followed by a notification, which has to be sent
+// after the response and outside the read loop since it waits for its own response
+func (s *Simulator) handle(action string, payload json.RawMessage) (any, error) {
+	switch action {
+	case "SetChargingProfile":
+		var req setChargingProfileReq
+		if err := decode(payload, &req); err != nil {
+			return nil, err
+		}
+		periods := req.CsChargingProfiles.ChargingSchedule.ChargingSchedulePeriod
+		s.mu.Lock()
+		s.limited = len(periods) > 0 && periods[0].Limit <= 0
+		s.mu.Unlock()
+		go s.notifyStatus(context.Background())
+		return statusConf{Status: "Accepted"}, nil
+
+	case "ClearChargingProfile":
+		s.mu.Lock()
+		wasLimited := s.limited
+		s.limited = false
+		s.mu.Unlock()
+		if !wasLimited {
+			return statusConf{Status: "Unknown"}, nil
+		}
+		go s.notifyStatus(context.Background())
+		return statusConf{Status: "Accepted"}, nil
+
+	case "RemoteStartTransaction":
+		s.mu.Lock()
+		accepted := s.vehicle && s.transactionId == 0
+		s.mu.Unlock()
+		if !accepted {
+			return statusConf{Status: "Rejected"}, nil
+		}
+		go s.startTransaction(context.Background())
+		return statusConf{Status: "Accepted"}, nil
+
+	case "RemoteStopTransaction":
+		var req remoteStopTransactionReq
+		if err := decode(payload, &req); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		accepted := req.TransactionId != 0 && req.TransactionId == s.transactionId
+		s.mu.Unlock()
+		if !accepted {
+			return statusConf{Status: "Rejected"}, nil
+		}
+		go s.stopTransaction(context.Background(), "Remote")
+		return statusConf{Status: "Accepted"}, nil
+
+	default:
+		return nil, notImplemented(action)
+	}
+}
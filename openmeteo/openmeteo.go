@@ -0,0 +1,108 @@
+package openmeteo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/types"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
+)
+
+const BASE_URL = "https://api.open-meteo.com"
+
+type openMeteoData struct {
+	Hourly struct {
+		Time               []string   `json:"time"`
+		Temperature        []*float64 `json:"temperature_2m"`
+		CloudCover         []*float64 `json:"cloud_cover"`
+		Precipitation      []*float64 `json:"precipitation"`
+		ShortwaveRadiation []*float64 `json:"shortwave_radiation"`
+		WindGusts          []*float64 `json:"wind_gusts_10m"`
+	} `json:"hourly"`
+}
+
+type OpenMeteo struct {
+	baseUrl   string
+	latitude  float64
+	longitude float64
+}
+
+func New(baseUrl string, latitude float64, longitude float64) OpenMeteo {
+	return OpenMeteo{baseUrl: baseUrl, latitude: latitude, longitude: longitude}
+}
+
+func (o OpenMeteo) GetWeatherForecast(ctx context.Context) ([]types.WeatherForecast, error) {
+	url := fmt.Sprintf(
+		"%s/v1/forecast?latitude=%0.4f&longitude=%0.4f&hourly=temperature_2m,cloud_cover,precipitation,shortwave_radiation,wind_gusts_10m&wind_speed_unit=ms&timezone=UTC&forecast_days=3",
+		o.baseUrl, o.latitude, o.longitude)
+
+	slog.Default().Info("fetching forecast from Open-Meteo...", "url", url)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Open-Meteo request: %w", err)
+	}
+	client := http.Client{Timeout: 10 * time.Second}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error getting Open-Meteo forecast: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from Open-Meteo: %d", res.StatusCode)
+	}
+
+	var data openMeteoData
+	if err := json.NewDecoder(res.Body).Decode(&data); err != nil {
+		return nil, fmt.Errorf("error unmarshaling Open-Meteo json: %w", err)
+	}
+
+	h := data.Hourly
+	result := make([]types.WeatherForecast, 0, len(h.Time))
+	for i, ts := range h.Time {
+		t, err := time.ParseInLocation("2006-01-02T15:04", ts, time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing Open-Meteo time '%s': %w", ts, err)
+		}
+
+		// Temperature and cloud cover are instant values, while precipitation,
+		// radiation and gusts are summed/averaged/maxed over the preceding hour,
+		// i.e. the value for this hour is found at the next time step.
+		if i+1 >= len(h.Time) {
+			break
+		}
+		temperature, ok1 := valueAt(h.Temperature, i)
+		cloudCover, ok2 := valueAt(h.CloudCover, i)
+		precipitation, ok3 := valueAt(h.Precipitation, i+1)
+		if !ok1 || !ok2 || !ok3 {
+			continue
+		}
+		radiation, ok := valueAt(h.ShortwaveRadiation, i+1)
+		gust, gustOk := valueAt(h.WindGusts, i+1)
+
+		result = append(result, types.WeatherForecast{
+			Hour:           hours.FromTime(t),
+			CloudCover:     calc.PercentageToOctas(cloudCover),
+			Temperature:    temperature,
+			Precipitation:  precipitation,
+			SolarRadiation: maybe.SqlNull(radiation, ok),
+			WindGust:       maybe.SqlNull(gust, gustOk),
+		})
+	}
+
+	return result, nil
+}
+
+func valueAt(values []*float64, i int) (float64, bool) {
+	if i >= len(values) || values[i] == nil {
+		return 0, false
+	}
+	return *values[i], true
+}
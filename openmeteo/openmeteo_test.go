@@ -0,0 +1,47 @@
+package openmeteo
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+func TestGetWeatherForecast(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("timezone") != "UTC" {
+			t.Errorf("expected forecast to be requested in UTC")
+		}
+		http.ServeFile(w, r, "testdata/forecast.json")
+	}))
+	defer srv.Close()
+
+	fc, err := New(srv.URL, 56.86, 12.69).GetWeatherForecast(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The last time step only holds accumulated values for the previous hour
+	// and the hour at 12:00 is missing a temperature.
+	if len(fc) != 2 {
+		t.Fatalf("got %d hours, wanted 2", len(fc))
+	}
+
+	if fc[0].Hour != (hours.DateHour{Date: "2025-06-01", Hour: 10}) {
+		t.Errorf("got hour %s, wanted 2025-06-01 10", fc[0].Hour)
+	}
+	if fc[0].CloudCover != 0 || fc[0].Temperature != 17.2 {
+		t.Errorf("unexpected forecast %+v", fc[0])
+	}
+	if fc[1].CloudCover != 4 || fc[1].Precipitation != 0.4 {
+		t.Errorf("unexpected forecast %+v", fc[1])
+	}
+	if !fc[1].SolarRadiation.IsValid() || fc[1].SolarRadiation.Value() != 420.0 {
+		t.Errorf("got solar radiation %v, wanted 420", fc[1].SolarRadiation)
+	}
+	if !fc[1].WindGust.IsValid() || fc[1].WindGust.Value() != 12.8 {
+		t.Errorf("got wind gust %v, wanted 12.8", fc[1].WindGust)
+	}
+}
@@ -2,11 +2,18 @@ package optimize
 
 import (
 	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/degradation"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
 )
 
 type Battery struct {
 	config.AppConfigBatterySpec
-	CurrentLevel float64 // Current battery level in percentage
+	CurrentLevel    float64              // Current battery level in percentage
+	CellTemperature maybe.Maybe[float64] // Cell temperature in °C, the reference temperature is assumed if not valid
+	// The half cycle the battery is in, a new one begins at the current level if not started
+	Cycle degradation.Cycle
+	// Optional lower charge power near full and discharge power near empty
+	Taper Taper
 }
 
 // Returns the battery level in kWh for a given percentage
@@ -29,17 +36,46 @@ func (b Battery) RemainingCapacity() float64 {
 	return b.ToKWh(b.CurrentLevel) - b.ToKWh(b.MinLevel)
 }
 
-// Calculates and updates battery level for a given balance, returns diff in kWh
-func (b *Battery) UpdateLevel(load float64 /* Charge or discharge load in kW */) float64 {
-	var newLvlKWh float64
+// Number of steps an hour is split in when the battery power tapers with the level
+const taperSteps = 6
+
+// Calculates and updates battery level for a load charged (positive) or discharged (negative)
+// evenly over a number of hours, returns diff in kWh. With a taper the load is limited to
+// what the battery takes as its level changes.
+func (b *Battery) UpdateLevel(load float64 /* Charge or discharge load in kWh */, hours float64) float64 {
 	oldLvlKWh := b.ToKWh(b.CurrentLevel)
-	if load > 0 {
-		newLvlKWh = min(b.ToKWh(b.MaxLevel), oldLvlKWh+load)
+	newLvlKWh := oldLvlKWh
+	if b.Taper.Enabled() && hours > 0 && b.Taper.lowers(b.CurrentLevel, b.ToPercentage(oldLvlKWh+load)) {
+		step, stepHours := load/taperSteps, hours/taperSteps
+		for range taperSteps {
+			charge, discharge := b.Taper.limits(b.ToPercentage(newLvlKWh))
+			newLvlKWh = b.levelAfter(newLvlKWh, max(min(step, charge*stepHours), -discharge*stepHours))
+		}
 	} else {
-		newLvlKWh = max(b.ToKWh(b.MinLevel), oldLvlKWh+load)
+		newLvlKWh = b.levelAfter(oldLvlKWh, load)
 	}
 
 	b.CurrentLevel = b.ToPercentage(newLvlKWh)
 
 	return newLvlKWh - oldLvlKWh
 }
+
+// The battery level in kWh after charging or discharging from a level in kWh
+func (b *Battery) levelAfter(lvlKWh float64, load float64) float64 {
+	if load > 0 {
+		return min(b.ToKWh(b.MaxLevel), lvlKWh+load)
+	}
+	// Never below the minimum level, or the current level when it's already below
+	return max(min(b.ToKWh(b.MinLevel), lvlKWh), lvlKWh+load)
+}
+
+// Cost of the wear from a change in battery level of diffKWh during a number of hours,
+// the battery level must already be updated
+func (b *Battery) wearCost(model degradation.Model, diffKWh float64, hours float64) float64 {
+	if diffKWh == 0 || hours <= 0 {
+		return 0
+	}
+	from, to := b.Cycle.Step(b.CurrentLevel)
+	temperature := b.CellTemperature.ValueOrDefault(degradation.ReferenceTemperature)
+	return model.Cost(model.Wear(from, to, diffKWh/hours, temperature, diffKWh > 0))
+}
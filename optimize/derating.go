@@ -0,0 +1,40 @@
+package optimize
+
+import (
+	"fmt"
+
+	"github.com/icodeforyou/solarplant-go/config"
+)
+
+// Lower charge and discharge power by cell temperature, e.g. batteries that only take a
+// fraction of their rated power when they are cold
+type Derating struct {
+	curve rateCurve // By temperature
+}
+
+func NewDerating(spec config.AppConfigBatterySpec) (Derating, error) {
+	points := make([]ratePoint, 0, len(spec.Derating))
+	for _, p := range spec.Derating {
+		point := newRatePoint(spec, p.Temperature, p.MaxChargeRate, p.MaxDischargeRate)
+		if point.charge < 0 || point.discharge < 0 {
+			return Derating{}, fmt.Errorf("derating at %.1f °C: rates can't be negative", p.Temperature)
+		}
+		points = append(points, point)
+	}
+
+	curve, duplicate, ok := newRateCurve(spec, points)
+	if !ok {
+		return Derating{}, fmt.Errorf("derating at %.1f °C is given more than once", duplicate)
+	}
+	return Derating{curve: curve}, nil
+}
+
+func (d Derating) Enabled() bool {
+	return d.curve.enabled()
+}
+
+// Maximum charge and discharge power in kW at a temperature, interpolated between the
+// closest points and the same as the closest point outside them
+func (d Derating) Rates(temperature float64) (float64, float64) {
+	return d.curve.rates(temperature)
+}
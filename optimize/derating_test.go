@@ -0,0 +1,54 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/config"
+)
+
+func TestDeratingRates(t *testing.T) {
+	one, three := 1.0, 3.0
+	derating, err := NewDerating(config.AppConfigBatterySpec{
+		MaxChargeRate:    7,
+		MaxDischargeRate: 7,
+		Derating: []config.AppConfigDeratingPoint{
+			{Temperature: 15},
+			{Temperature: 0, MaxChargeRate: &one, MaxDischargeRate: &three},
+			{Temperature: 5, MaxChargeRate: &three},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		temperature float64
+		charge      float64
+		discharge   float64
+	}{
+		{-10, 1, 3},
+		{0, 1, 3},
+		{2.5, 2, 5},
+		{10, 5, 7},
+		{25, 7, 7},
+	}
+	for _, tt := range tests {
+		charge, discharge := derating.Rates(tt.temperature)
+		if !almostEqual(charge, tt.charge) || !almostEqual(discharge, tt.discharge) {
+			t.Errorf("got %.2f/%.2f kW at %.1f °C, wanted %.2f/%.2f kW", charge, discharge, tt.temperature, tt.charge, tt.discharge)
+		}
+	}
+}
+
+func TestNewDeratingInvalid(t *testing.T) {
+	negative := -1.0
+	invalid := [][]config.AppConfigDeratingPoint{
+		{{Temperature: 0, MaxChargeRate: &negative}},
+		{{Temperature: 5}, {Temperature: 5}},
+	}
+	for i, points := range invalid {
+		if _, err := NewDerating(config.AppConfigBatterySpec{MaxChargeRate: 7, MaxDischargeRate: 7, Derating: points}); err == nil {
+			t.Errorf("points %d: expected an error", i)
+		}
+	}
+}
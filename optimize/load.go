@@ -0,0 +1,130 @@
+package optimize
+
+import (
+	"math"
+	"slices"
+)
+
+// A flexible load that has to consume an amount of energy within a window, e.g. charging an EV
+type Load struct {
+	Power  float64 // Maximum power in kW
+	Energy float64 // Energy in kWh that has to be consumed within the window
+	From   int     // First hour in the forecast the load may run
+	To     int     // Hour in the forecast when the load must be done, exclusive
+	// Optional fraction of each hour in the forecast the load may run, e.g. 0.5 when
+	// only allowed after half past, all of the hours between From and To if empty
+	Availability []float64
+}
+
+// Part of an hour's capacity for a load, at what it costs per kWh
+type loadSlot struct {
+	hour int
+	kWh  float64
+	cost float64
+}
+
+// Schedules a load into the hours where the energy is cheapest. Surplus production is
+// valued at what it would have been sold for and the rest at what it costs to buy, so
+// solar surplus is used before cheap grid energy. The load is scheduled as far as the
+// window, the power and the grid allow. Returns the energy in kWh for each hour in the
+// forecast.
+func ScheduleLoad(input Input, load Load) []float64 {
+	planned := make([]float64, len(input.Forecast))
+	from, to := max(load.From, 0), min(load.To, len(input.Forecast))
+
+	var slots []loadSlot
+	for h := from; h < to; h++ {
+		frac := 1.0
+		if h == 0 && input.FirstHourFraction > 0 {
+			frac = input.FirstHourFraction
+		}
+		price := input.Forecast[h].EnergyPrice
+		balance := input.Forecast[h].EnergyBalance * frac
+		excess := input.exportExcess(max(balance, 0), frac)
+		if len(load.Availability) > 0 {
+			if h >= len(load.Availability) {
+				break
+			}
+			frac = min(frac, load.Availability[h])
+		}
+		capacity := load.Power * frac
+		if capacity <= 0 {
+			continue
+		}
+
+		surplus := min(max(balance, 0), capacity)
+		// Surplus above the export cap can't be sold, it's used before the rest
+		if excess = min(excess, surplus); excess > 0 {
+			slots = append(slots, loadSlot{hour: h, kWh: excess, cost: min(input.SellPrice(price, 1), 0)})
+			surplus -= excess
+		}
+		if surplus > 0 {
+			slots = append(slots, loadSlot{hour: h, kWh: surplus, cost: input.SellPrice(price, 1)})
+		}
+		imported := capacity - surplus
+		if input.GridMaxPower > 0 {
+			imported = min(imported, max(input.GridMaxPower*frac+min(balance, 0), 0))
+		}
+		if imported > 0 {
+			slots = append(slots, loadSlot{hour: h, kWh: imported, cost: input.importCost(price, 1)})
+		}
+	}
+
+	// Earlier hours first when the cost is the same, it leaves room if the plan changes
+	slices.SortStableFunc(slots, func(a, b loadSlot) int {
+		if a.cost < b.cost {
+			return -1
+		}
+		if a.cost > b.cost {
+			return 1
+		}
+		return a.hour - b.hour
+	})
+
+	remaining := load.Energy
+	for _, s := range slots {
+		if remaining <= 0 {
+			break
+		}
+		kWh := math.Min(s.kWh, remaining)
+		planned[s.hour] += kWh
+		remaining -= kWh
+	}
+
+	return planned
+}
+
+// Adds the energy planned for a load to the consumption, i.e. lowers the
+// energy balance of the forecast and of all scenarios
+func (i *Input) AddLoad(planned []float64) {
+	for h, kWh := range planned {
+		if h >= len(i.Forecast) {
+			break
+		}
+		if h == 0 && i.FirstHourFraction > 0 {
+			kWh /= i.FirstHourFraction // The balances are for the whole hour and scaled when simulated
+		}
+		i.Forecast[h].EnergyBalance -= kWh
+		for _, s := range i.Scenarios {
+			if h < len(s.EnergyBalance) {
+				s.EnergyBalance[h] -= kWh
+			}
+		}
+	}
+}
+
+// Adds energy the flexible loads can take beyond their schedule when export is curtailed
+func (i *Input) AddCurtailLoad(kWh []float64) {
+	if len(i.CurtailLoad) < len(i.Forecast) {
+		i.CurtailLoad = append(i.CurtailLoad, make([]float64, len(i.Forecast)-len(i.CurtailLoad))...)
+	}
+	for h, e := range kWh {
+		if h >= len(i.Forecast) {
+			break
+		}
+		if h == 0 && i.FirstHourFraction > 0 {
+			e /= i.FirstHourFraction // Like the balances it's for the whole hour and scaled when simulated
+		}
+		i.CurtailLoad[h] += e
+	}
+}
@@ -0,0 +1,142 @@
+package optimize
+
+import (
+	"math"
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
+)
+
+func checkPlannedLoad(t *testing.T, got []float64, want []float64) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d hours, wanted %d", len(got), len(want))
+	}
+	for h := range want {
+		if math.Abs(got[h]-want[h]) > 0.0001 {
+			t.Errorf("got %v, wanted %v", got, want)
+			return
+		}
+	}
+}
+
+func TestScheduleLoadCheapestHours(t *testing.T) {
+	input := Input{
+		Tariff: calc.Tariff{EnergyTax: 0.5},
+		Forecast: []Forecast{
+			{EnergyPrice: 2.0},
+			{EnergyPrice: 0.5},
+			{EnergyPrice: 1.0},
+			{EnergyPrice: 0.5},
+			{EnergyPrice: 0.1}, // Outside the window
+		},
+	}
+
+	planned := ScheduleLoad(input, Load{Power: 11, Energy: 15, From: 0, To: 4})
+	checkPlannedLoad(t, planned, []float64{0, 11, 0, 4, 0})
+
+	// More than fits in the window
+	planned = ScheduleLoad(input, Load{Power: 11, Energy: 100, From: 1, To: 4})
+	checkPlannedLoad(t, planned, []float64{0, 11, 11, 11, 0})
+}
+
+func TestScheduleLoadSolarSurplus(t *testing.T) {
+	input := Input{
+		Tariff: calc.Tariff{EnergyTax: 0.5, ExportCompensation: 0.1},
+		Forecast: []Forecast{
+			{EnergyPrice: 0.3, EnergyBalance: -1.0},
+			{EnergyPrice: 0.8, EnergyBalance: 5.0}, // Surplus is worth 0.9, buying 1.3
+			{EnergyPrice: 0.6, EnergyBalance: 0.0}, // Buying 1.1
+		},
+	}
+
+	planned := ScheduleLoad(input, Load{Power: 7, Energy: 14, From: 0, To: 3})
+	checkPlannedLoad(t, planned, []float64{7, 5, 2})
+}
+
+func TestScheduleLoadImportPenalty(t *testing.T) {
+	input := Input{
+		Tariff: calc.Tariff{EnergyTax: 0.5, ExportCompensation: 0.1},
+		Forecast: []Forecast{
+			{EnergyPrice: 0.3, EnergyBalance: -1.0}, // Buying 0.8
+			{EnergyPrice: 1.2, EnergyBalance: 5.0},  // Surplus is worth 1.3
+		},
+	}
+
+	planned := ScheduleLoad(input, Load{Power: 7, Energy: 8, From: 0, To: 2})
+	checkPlannedLoad(t, planned, []float64{7, 1})
+
+	// Buying costs 1.8 with the penalty, so the surplus is used first
+	input.ImportPenalty = 1.0
+	planned = ScheduleLoad(input, Load{Power: 7, Energy: 8, From: 0, To: 2})
+	checkPlannedLoad(t, planned, []float64{3, 5})
+}
+
+func TestScheduleLoadExportCap(t *testing.T) {
+	input := Input{
+		Forecast: []Forecast{
+			{EnergyPrice: 0.1, EnergyBalance: 0.0},
+			{EnergyPrice: 0.5, EnergyBalance: 4.0},
+		},
+	}
+
+	planned := ScheduleLoad(input, Load{Power: 3, Energy: 4, From: 0, To: 2})
+	checkPlannedLoad(t, planned, []float64{3, 1})
+
+	// The surplus above the cap can't be sold, so it's used first
+	input.ExportCap = maybe.Some(1.0)
+	planned = ScheduleLoad(input, Load{Power: 3, Energy: 4, From: 0, To: 2})
+	checkPlannedLoad(t, planned, []float64{1, 3})
+}
+
+func TestScheduleLoadGridMaxPower(t *testing.T) {
+	input := Input{
+		GridMaxPower: 10,
+		Forecast: []Forecast{
+			{EnergyPrice: 0.1, EnergyBalance: -6.0}, // Only 4 kW left for the load
+			{EnergyPrice: 0.2, EnergyBalance: 0.0},
+		},
+	}
+
+	planned := ScheduleLoad(input, Load{Power: 11, Energy: 10, From: 0, To: 2})
+	checkPlannedLoad(t, planned, []float64{4, 6})
+}
+
+func TestAddLoad(t *testing.T) {
+	input := Input{
+		FirstHourFraction: 0.5,
+		Forecast: []Forecast{
+			{EnergyPrice: 0.1, EnergyBalance: 2.0},
+			{EnergyPrice: 0.2, EnergyBalance: 1.0},
+		},
+		Scenarios: []Scenario{{Weight: 1, EnergyBalance: []float64{2.0, 1.0}}},
+	}
+
+	planned := ScheduleLoad(input, Load{Power: 4, Energy: 3, From: 0, To: 2})
+	checkPlannedLoad(t, planned, []float64{2, 1})
+
+	input.AddLoad(planned)
+	// The first hour is half an hour, so 2 kWh is 4 kWh for the whole hour
+	if input.Forecast[0].EnergyBalance != -2.0 || input.Forecast[1].EnergyBalance != 0.0 {
+		t.Errorf("unexpected forecast %+v", input.Forecast)
+	}
+	if input.Scenarios[0].EnergyBalance[0] != -2.0 || input.Scenarios[0].EnergyBalance[1] != 0.0 {
+		t.Errorf("unexpected scenario %+v", input.Scenarios[0])
+	}
+}
+
+func TestScheduleLoadAvailability(t *testing.T) {
+	input := Input{
+		Forecast: []Forecast{
+			{EnergyPrice: 0.1},
+			{EnergyPrice: 0.2},
+			{EnergyPrice: 0.3},
+			{EnergyPrice: 0.4},
+		},
+	}
+
+	// The cheapest hour isn't allowed and the second cheapest only half of it
+	planned := ScheduleLoad(input, Load{Power: 2, Energy: 3, From: 0, To: 4, Availability: []float64{0, 0.5, 1, 1}})
+	checkPlannedLoad(t, planned, []float64{0, 1, 2, 0})
+}
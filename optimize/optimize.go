@@ -4,34 +4,132 @@ import (
 	"math"
 
 	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/degradation"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
 )
 
 type Forecast struct {
-	EnergyPrice   float64 // Price of energy per kWh
-	EnergyBalance float64 // Difference between produced and consumed power (kWh) not including the battery effect
+	EnergyPrice          float64 // Price of energy per kWh
+	EnergyPriceEstimated bool    // The price is an estimate since the real price is not yet published
+	EnergyBalance        float64 // Difference between produced and consumed power (kWh) not including the battery effect
+}
+
+// An alternative outcome of the energy balance, e.g. a forecast quantile
+type Scenario struct {
+	Weight        float64   // Probability weight, the weights of all scenarios should sum up to 1
+	EnergyBalance []float64 // Energy balance (kWh) for each hour in the forecast
 }
 
 type Input struct {
-	Battery            Battery
-	GridMaxPower       float64 // Maximum power to and from grid in kW
-	EnergyTax          float64 // Energy tax in SEK/kWh including VAT (energiskatt)
-	EnergyTaxReduction float64 // Energy tax reduction in SEK/kWh (skattereduktion)
-	GridBenefit        float64 // Grid benefit in SEK/kWh (nätnytta)
-	Forecast           []Forecast
+	Battery      Battery
+	GridMaxPower float64     // Maximum power to and from grid in kW
+	Tariff       calc.Tariff // Taxes and fees added to the spot price
+	Forecast     []Forecast
+	// Optional scenarios that plans are evaluated across, if empty
+	// only the energy balance in the forecast is used
+	Scenarios []Scenario
+	// A value between 0 and 1 where 0 minimizes the expected cost
+	// over all scenarios and 1 minimizes the worst case cost
+	RiskAversion float64
+	// How much of the first hour that remains when planning within an hour, between
+	// 0 and 1. The energy balance and battery rates of that hour are scaled by it,
+	// zero means the whole hour.
+	FirstHourFraction float64
+	// Optional battery level in percentage to keep for outages for each hour in the
+	// forecast. The battery isn't discharged below it, and ending an hour below it
+	// costs more than charging up to it would, so it's reached in time if possible.
+	Reserve []float64
+	// Optional derating of the battery power by temperature, with the temperature in °C
+	// expected for each hour in the forecast
+	Derating    Derating
+	Temperature []float64
+	// Optional cost of changing strategy from one hour to the next, also from the strategy
+	// in the hour before the forecast if it's known
+	SwitchCost        float64
+	PrecedingStrategy maybe.Maybe[Strategy]
+	// Optional cost of each hour planned differently than in the previous plan, which is
+	// given for the first hours in the forecast
+	DeviationCost float64
+	Committed     []Strategy
+	// Optional extra cost per kWh bought from the grid, which weighs self-sufficiency
+	// against the cost of energy
+	ImportPenalty float64
+	// Optional maximum power exported to the grid in kW. The battery takes the surplus above
+	// it and what it can't take is penalized, so room is kept for high production.
+	ExportCap maybe.Maybe[float64]
+	// Optional energy in kWh for each hour in the forecast that the flexible loads can take
+	// beyond what's scheduled for them, they're switched on when export is curtailed
+	CurtailLoad []float64
 }
 
 func (i *Input) BuyPrice(price float64, kWh float64) float64 {
-	return calc.BuyPrice(kWh, price, i.EnergyTax, i.GridBenefit)
+	return i.Tariff.BuyPrice(kWh, price)
 }
 
 func (i *Input) SellPrice(price float64, kWh float64) float64 {
-	return calc.SellPrice(kWh, price, i.EnergyTaxReduction)
+	return i.Tariff.SellPrice(kWh, price)
+}
+
+// What buying energy costs the plan, the buy price with the import penalty
+func (i *Input) importCost(price float64, kWh float64) float64 {
+	return i.BuyPrice(price, kWh) + i.ImportPenalty*kWh
+}
+
+// What exporting costs the plan, negative when it pays. Energy above the export cap isn't
+// sold and is penalized since exporting it breaks the limit of the grid connection.
+func (i *Input) exportCost(price float64, kWh float64, frac float64, penalty float64) float64 {
+	if excess := i.exportExcess(kWh, frac); excess > 0 {
+		return excess*penalty - i.SellPrice(price, kWh-excess)
+	}
+	return -i.SellPrice(price, kWh)
+}
+
+// Energy in kWh above the export cap, if there's one
+func (i *Input) exportExcess(kWh float64, frac float64) float64 {
+	if !i.ExportCap.IsValid() {
+		return 0
+	}
+	return max(kWh-i.ExportCap.Value()*frac, 0)
+}
+
+// Cost per kWh below the reserve at the end of an hour or exported above the export cap,
+// more than any energy in the forecast costs to buy
+func (i *Input) reservePenalty() float64 {
+	penalty := 1.0
+	for _, f := range i.Forecast {
+		penalty = max(penalty, 2*i.importCost(f.EnergyPrice, 1))
+	}
+	return penalty
+}
+
+// Cost of changing strategies, both from one hour to the next and from the previous
+// plan, so plans don't flip between strategies on small changes in the forecast
+func (i *Input) stabilityCost(permutation []Strategy) float64 {
+	cost := 0.0
+	if i.SwitchCost > 0 {
+		prev, known := i.PrecedingStrategy.Value(), i.PrecedingStrategy.IsValid()
+		for _, s := range permutation {
+			if known && s != prev {
+				cost += i.SwitchCost
+			}
+			prev, known = s, true
+		}
+	}
+	if i.DeviationCost > 0 {
+		for h, s := range permutation[:min(len(permutation), len(i.Committed))] {
+			if s != i.Committed[h] {
+				cost += i.DeviationCost
+			}
+		}
+	}
+	return cost
 }
 
 type Output struct {
-	Cost         float64    // Total cost of energy
-	BatteryLevel float64    // Final battery level in percentage
-	Strategy     []Strategy // Optimal strategy for each hour in the forecast
+	Cost          float64    // Total cost of energy, including the import penalty
+	BatteryLevel  float64    // Final battery level in percentage
+	Strategy      []Strategy // Optimal strategy for each hour in the forecast
+	BatteryLevels []float64  // Expected battery level in percentage at the end of each hour
 }
 
 // Generate all (brute-force) permutations of strategies
@@ -39,81 +137,209 @@ type Output struct {
 // the cost for each permutation and find the one with the lowest cost
 func BestStrategies(input Input) Output {
 	best := Output{Cost: math.Inf(1), Strategy: []Strategy{}}
-	for _, p := range permute(len(input.Forecast)) {
+	bestObjective := math.Inf(1)
+	forEachPermutation(input.hourStrategies(), func(p []Strategy) {
 		cost, battLvl := costForPermutation(input, p)
-		if cost < best.Cost {
-			best = Output{Cost: cost, BatteryLevel: battLvl, Strategy: p}
+		if !math.IsInf(cost, 1) && len(input.Scenarios) > 0 {
+			cost = riskAdjustedCost(input, p)
+		}
+		// The cost of changing strategies is weighed in but isn't a cost of energy
+		if objective := cost + input.stabilityCost(p); objective < bestObjective {
+			bestObjective = objective
+			best = Output{Cost: cost, BatteryLevel: battLvl, Strategy: append([]Strategy(nil), p...)}
 		}
+	})
+
+	if len(best.Strategy) > 0 {
+		best.BatteryLevels = make([]float64, len(best.Strategy))
+		simulate(input, best.Strategy, forecastBalances(input), false, best.BatteryLevels)
 	}
 
 	return best
 }
 
+// The strategies to try in each hour, export is only curtailed where selling costs money
+func (i *Input) hourStrategies() [][]Strategy {
+	withCurtail := append(append([]Strategy(nil), baseStrategies...), StrategyCurtail)
+	options := make([][]Strategy, len(i.Forecast))
+	for h, f := range i.Forecast {
+		options[h] = baseStrategies
+		if i.SellPrice(f.EnergyPrice, 1) < 0 {
+			options[h] = withCurtail
+		}
+	}
+	return options
+}
+
+func forecastBalances(input Input) []float64 {
+	balances := make([]float64, len(input.Forecast))
+	for i, f := range input.Forecast {
+		balances[i] = f.EnergyBalance
+	}
+	return balances
+}
+
 // Calculates the total cost for a given permutation of strategies,
 // i.e. how much money is spent (or earned) to/from the grid.
 // Also returns new battery level in percentage.
 func costForPermutation(input Input, permutation []Strategy) (float64, float64) {
+	return simulate(input, permutation, forecastBalances(input), true, nil)
+}
+
+// Blends the expected cost over all scenarios with the worst case cost
+// according to the risk aversion.
+func riskAdjustedCost(input Input, permutation []Strategy) float64 {
+	expected, worst := 0.0, math.Inf(-1)
+	for _, s := range input.Scenarios {
+		cost, _ := simulate(input, permutation, s.EnergyBalance, false, nil)
+		expected += s.Weight * cost
+		worst = max(worst, cost)
+	}
+	return (1-input.RiskAversion)*expected + input.RiskAversion*worst
+}
+
+// Simulates a permutation of strategies for the given energy balances. If strict,
+// permutations where a strategy has no effect are disqualified, which avoids picking
+// charge/discharge when default gives the same result. Scenarios are not strict
+// since a strategy that is useless in one scenario may pay off in another.
+// If levels is given, it's filled with the battery level at the end of each hour.
+func simulate(input Input, permutation []Strategy, balances []float64, strict bool, levels []float64) (float64, float64) {
 	batt := input.Battery
 	totCost := 0.0
 	disqualified := false
+	penalty := 0.0
+	if len(input.Reserve) > 0 || input.ExportCap.IsValid() {
+		penalty = input.reservePenalty()
+	}
+	wear := degradation.New(input.Battery.AppConfigBatterySpec)
+	if !batt.Cycle.Started() {
+		batt.Cycle.Step(batt.CurrentLevel)
+	}
 
 	for hour, strategy := range permutation {
+		reserve := 0.0
+		if hour < len(input.Reserve) {
+			reserve = input.Reserve[hour]
+		}
+		batt.MinLevel = max(input.Battery.MinLevel, reserve)
+		batt.MaxChargeRate, batt.MaxDischargeRate = input.Battery.MaxChargeRate, input.Battery.MaxDischargeRate
+		if input.Derating.Enabled() && hour < len(input.Temperature) {
+			batt.MaxChargeRate, batt.MaxDischargeRate = input.Derating.Rates(input.Temperature[hour])
+		}
+
 		price := input.Forecast[hour].EnergyPrice
-		balance := input.Forecast[hour].EnergyBalance
+		balance := balances[hour]
+		frac := 1.0
+		if hour == 0 && input.FirstHourFraction > 0 {
+			frac = input.FirstHourFraction
+			balance *= frac
+		}
 
 		switch strategy {
 		case StrategyDefault:
-			battDiffKWh := batt.UpdateLevel(balance)
+			battDiffKWh := batt.UpdateLevel(balance, frac)
 			buyKwh := max(0.0, battDiffKWh-balance)
 			if buyKwh > 0 {
-				totCost += input.BuyPrice(price, buyKwh)
+				totCost += input.importCost(price, buyKwh)
 			}
 			sellKwh := max(0.0, balance-battDiffKWh)
 			if sellKwh > 0 {
-				totCost -= input.SellPrice(price, sellKwh)
+				totCost += input.exportCost(price, sellKwh, frac, penalty)
 			}
-			totCost += batt.DegradationCost * math.Abs(battDiffKWh)
+			totCost += batt.wearCost(wear, battDiffKWh, frac)
 
 		case StrategyPreserve:
+			// The battery is left alone unless the surplus is above the export cap
+			if excess := input.exportExcess(balance, frac); excess > 0 {
+				battDiffKWh := batt.UpdateLevel(min(excess, batt.MaxChargeRate*frac), frac)
+				balance -= battDiffKWh
+				totCost += batt.wearCost(wear, battDiffKWh, frac)
+			}
 			if balance < 0 {
-				totCost += input.BuyPrice(price, -balance)
+				totCost += input.importCost(price, -balance)
 			}
 			if balance > 0 {
-				totCost -= input.SellPrice(price, balance)
+				totCost += input.exportCost(price, balance, frac, penalty)
 			}
 
 		case StrategyCharge:
-			if batt.AvailableCapacity() <= 0 {
+			if batt.AvailableCapacity() <= 0 && strict {
 				disqualified = true
 				break
 			}
-			battDiffKWh := batt.UpdateLevel(batt.MaxChargeRate)
+			battDiffKWh := batt.UpdateLevel(batt.MaxChargeRate*frac, frac)
 			buyKwh := max(0.0, battDiffKWh-balance)
-			if buyKwh <= 0 {
+			if buyKwh <= 0 && strict {
 				disqualified = true
 				break
 			}
-			totCost += input.BuyPrice(price, buyKwh)
-			totCost += batt.DegradationCost * math.Abs(battDiffKWh)
+			if buyKwh > 0 {
+				totCost += input.importCost(price, buyKwh)
+			}
+			if sellKwh := max(0.0, balance-battDiffKWh); sellKwh > 0 {
+				totCost += input.exportCost(price, sellKwh, frac, penalty)
+			}
+			totCost += batt.wearCost(wear, battDiffKWh, frac)
 
 		case StrategyDischarge:
-			if batt.RemainingCapacity() <= 0 {
+			if batt.RemainingCapacity() <= 0 && strict {
 				disqualified = true
 				break
 			}
-			battDiffKWh := batt.UpdateLevel(-batt.MaxDischargeRate)
+			rate := batt.MaxDischargeRate * frac
+			if input.ExportCap.IsValid() {
+				// The regulator holds back what would be exported above the cap
+				rate = min(rate, max(input.ExportCap.Value()*frac-balance, 0))
+				if rate <= 0 && strict {
+					disqualified = true
+					break
+				}
+			}
+			battDiffKWh := batt.UpdateLevel(-rate, frac)
 			sellKwh := max(0.0, balance-battDiffKWh)
-			if sellKwh <= 0 {
+			if sellKwh <= 0 && strict {
 				disqualified = true
 				break
 			}
-			totCost -= input.SellPrice(price, sellKwh)
-			totCost += batt.DegradationCost * math.Abs(battDiffKWh)
+			if sellKwh > 0 {
+				totCost += input.exportCost(price, sellKwh, frac, penalty)
+			}
+			if buyKwh := max(0.0, battDiffKWh-balance); buyKwh > 0 {
+				totCost += input.importCost(price, buyKwh)
+			}
+			totCost += batt.wearCost(wear, battDiffKWh, frac)
+
+		case StrategyCurtail:
+			// The battery is charged from the surplus at full rate and the flexible loads take
+			// what they can of the rest. The export can't be limited, so what's left is exported.
+			battDiffKWh := batt.UpdateLevel(min(max(balance, 0), batt.MaxChargeRate*frac), frac)
+			surplus := max(0.0, balance-battDiffKWh)
+			absorbed := 0.0
+			if hour < len(input.CurtailLoad) {
+				absorbed = min(surplus, input.CurtailLoad[hour]*frac)
+			}
+			if absorbed <= 0 && strict {
+				disqualified = true // Nothing is curtailed, default gives the same result
+				break
+			}
+			if buyKwh := max(0.0, -balance); buyKwh > 0 {
+				totCost += input.importCost(price, buyKwh)
+			}
+			if sellKwh := surplus - absorbed; sellKwh > 0 {
+				totCost += input.exportCost(price, sellKwh, frac, penalty)
+			}
+			totCost += batt.wearCost(wear, battDiffKWh, frac)
 		}
 
 		if disqualified {
 			break // No need to continue if disqualified
 		}
+		if shortfall := batt.ToKWh(reserve) - batt.ToKWh(batt.CurrentLevel); shortfall > 0 {
+			totCost += shortfall * penalty
+		}
+		if levels != nil {
+			levels[hour] = batt.CurrentLevel
+		}
 	}
 
 	if disqualified {
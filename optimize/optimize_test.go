@@ -4,18 +4,21 @@ import (
 	"math"
 	"testing"
 
+	"github.com/icodeforyou/solarplant-go/calc"
 	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
 )
 
 // TODO: Write test for Input.SellPrice and Input.
 
+// Wear proportional to the energy charged and discharged, i.e. a fixed cost per kWh
+var flatWear = func() *float64 { v := 1.0; return &v }()
+
 func TestOptimizer(t *testing.T) {
 	input := Input{
 		GridMaxPower: 25.0,
 		// TODO: Adapt test to include tax etc.
-		EnergyTax:          0.0,
-		EnergyTaxReduction: 0.0,
-		GridBenefit:        0.0,
+		Tariff: calc.Tariff{},
 		Battery: Battery{
 			CurrentLevel: 10.0,
 			AppConfigBatterySpec: config.AppConfigBatterySpec{
@@ -25,6 +28,7 @@ func TestOptimizer(t *testing.T) {
 				MaxChargeRate:    3.0,
 				MaxDischargeRate: 3.0,
 				DegradationCost:  0.1,
+				DepthExponent:    flatWear,
 			},
 		},
 		Forecast: []Forecast{
@@ -40,6 +44,388 @@ func TestOptimizer(t *testing.T) {
 	checkBestStrategy(t, input, []Strategy{StrategyCharge, StrategyPreserve, StrategyDischarge}, -3.4, 10.0)
 }
 
+func TestOptimizerScenarios(t *testing.T) {
+	input := Input{
+		GridMaxPower: 25.0,
+		Tariff:       calc.Tariff{EnergyTax: 1.0},
+		Battery: Battery{
+			CurrentLevel: 50.0,
+			AppConfigBatterySpec: config.AppConfigBatterySpec{
+				Capacity:         10.0,
+				MinLevel:         10.0,
+				MaxLevel:         100.0,
+				MaxChargeRate:    4.0,
+				MaxDischargeRate: 4.0,
+				DegradationCost:  0.1,
+			},
+		},
+		Forecast: []Forecast{
+			{EnergyPrice: 2.0, EnergyBalance: 0.0},
+			{EnergyPrice: 1.5, EnergyBalance: 1.0},
+		},
+	}
+
+	// Expecting a production surplus, the battery is emptied in the expensive hour
+	output := BestStrategies(input)
+	if output.Strategy[0] != StrategyDischarge {
+		t.Errorf("got strategy '%s', wanted '%s' without scenarios", output.Strategy[0], StrategyDischarge)
+	}
+
+	// ...which still pays off on average when the production is uncertain...
+	input.Scenarios = []Scenario{
+		{Weight: 0.3, EnergyBalance: []float64{0.0, -4.0}},
+		{Weight: 0.4, EnergyBalance: []float64{0.0, 1.0}},
+		{Weight: 0.3, EnergyBalance: []float64{0.0, 4.0}},
+	}
+	output = BestStrategies(input)
+	if output.Strategy[0] != StrategyDischarge {
+		t.Errorf("got strategy '%s', wanted '%s' with risk aversion 0", output.Strategy[0], StrategyDischarge)
+	}
+
+	// ...but not if the worst case is what matters
+	input.RiskAversion = 1.0
+	output = BestStrategies(input)
+	if output.Strategy[0] == StrategyDischarge {
+		t.Errorf("didn't expect strategy '%s' with risk aversion 1", output.Strategy[0])
+	}
+}
+
+func TestOptimizerFirstHourFraction(t *testing.T) {
+	input := Input{
+		GridMaxPower: 25.0,
+		Battery: Battery{
+			CurrentLevel: 10.0,
+			AppConfigBatterySpec: config.AppConfigBatterySpec{
+				Capacity:         10.0,
+				MinLevel:         10.0,
+				MaxLevel:         100.0,
+				MaxChargeRate:    4.0,
+				MaxDischargeRate: 4.0,
+				DegradationCost:  0.1,
+				DepthExponent:    flatWear,
+			},
+		},
+		Forecast: []Forecast{
+			{EnergyPrice: 1.0, EnergyBalance: 0.0},
+			{EnergyPrice: 3.0, EnergyBalance: -4.0},
+		},
+	}
+
+	// Charging 4 kWh during the whole first hour covers the second hour...
+	checkPermutation(t, input, []Strategy{StrategyCharge, StrategyDefault}, 4.0+0.4+0.4, 10.0)
+
+	// ...but during the remaining quarter of it only 1 kWh is charged
+	input.FirstHourFraction = 0.25
+	checkPermutation(t, input, []Strategy{StrategyCharge, StrategyDefault}, 1.0+0.1+3.0*3.0+0.1, 10.0)
+
+	output := BestStrategies(input)
+	if len(output.BatteryLevels) != 2 {
+		t.Fatalf("got %d battery levels, wanted 2", len(output.BatteryLevels))
+	}
+	if !almostEqual(output.BatteryLevels[1], output.BatteryLevel) {
+		t.Errorf("got battery level %f after the last hour, wanted %f", output.BatteryLevels[1], output.BatteryLevel)
+	}
+}
+
+func TestOptimizerReserve(t *testing.T) {
+	input := Input{
+		GridMaxPower: 25.0,
+		Battery: Battery{
+			CurrentLevel: 50.0,
+			AppConfigBatterySpec: config.AppConfigBatterySpec{
+				Capacity:         10.0,
+				MinLevel:         10.0,
+				MaxLevel:         100.0,
+				MaxChargeRate:    4.0,
+				MaxDischargeRate: 4.0,
+				DegradationCost:  0.1,
+				DepthExponent:    flatWear,
+			},
+		},
+		Forecast: []Forecast{
+			{EnergyPrice: 3.0, EnergyBalance: -2.0},
+			{EnergyPrice: 1.0, EnergyBalance: 0.0},
+			{EnergyPrice: 3.0, EnergyBalance: -2.0},
+		},
+	}
+
+	// The battery isn't discharged below the reserve
+	input.Reserve = []float64{50.0, 50.0, 50.0}
+	checkPermutation(t, input, []Strategy{StrategyDefault, StrategyDefault, StrategyDefault}, 2.0*3.0+2.0*3.0, 50.0)
+
+	// A higher reserve in the last hour is reached by charging in the cheap hour, and
+	// by not using the battery before it
+	input.Reserve = []float64{0.0, 0.0, 80.0}
+	checkBestStrategy(t, input, []Strategy{StrategyPreserve, StrategyCharge, StrategyDefault}, 2.0*3.0+4.0*1.0+0.4+1.0*3.0+0.1, 80.0)
+}
+
+func TestOptimizerWear(t *testing.T) {
+	depthExponent := 2.0
+	input := Input{
+		GridMaxPower: 25.0,
+		Tariff:       calc.Tariff{},
+		Battery: Battery{
+			CurrentLevel: 50.0,
+			AppConfigBatterySpec: config.AppConfigBatterySpec{
+				Capacity:         10.0,
+				MinLevel:         10.0,
+				MaxLevel:         100.0,
+				MaxChargeRate:    2.0,
+				MaxDischargeRate: 2.0,
+				DegradationCost:  0.1,
+				DepthExponent:    &depthExponent,
+			},
+		},
+		Forecast: []Forecast{
+			{EnergyPrice: 0.0, EnergyBalance: 0.0},
+			{EnergyPrice: 0.0, EnergyBalance: 0.0},
+		},
+	}
+
+	// A half cycle of depth d wears d²/2 full cycles, each costing 2 * 10 kWh * 0.1
+	checkPermutation(t, input, []Strategy{StrategyCharge, StrategyPreserve}, 0.2*0.2/2*2.0, 70.0)
+	// Charging deeper costs more per kWh
+	checkPermutation(t, input, []Strategy{StrategyCharge, StrategyCharge}, 0.4*0.4/2*2.0, 90.0)
+	// Discharging after charging begins a new half cycle
+	checkPermutation(t, input, []Strategy{StrategyCharge, StrategyDischarge}, 2*0.2*0.2/2*2.0, 50.0)
+
+	// Charging cold cells wears them twice as fast at 5 °C, discharging them doesn't
+	input.Battery.CellTemperature = maybe.Some(5.0)
+	checkPermutation(t, input, []Strategy{StrategyCharge, StrategyPreserve}, 2*0.2*0.2/2*2.0, 70.0)
+	checkPermutation(t, input, []Strategy{StrategyDischarge, StrategyPreserve}, 0.2*0.2/2*2.0, 30.0)
+}
+
+func TestOptimizerDerating(t *testing.T) {
+	one := 1.0
+	input := Input{
+		GridMaxPower: 25.0,
+		Tariff:       calc.Tariff{},
+		Battery: Battery{
+			CurrentLevel: 10.0,
+			AppConfigBatterySpec: config.AppConfigBatterySpec{
+				Capacity:         10.0,
+				MinLevel:         10.0,
+				MaxLevel:         100.0,
+				MaxChargeRate:    3.0,
+				MaxDischargeRate: 3.0,
+				DegradationCost:  0.1,
+				DepthExponent:    flatWear,
+				Derating:         []config.AppConfigDeratingPoint{{Temperature: 0, MaxChargeRate: &one}, {Temperature: 10}},
+			},
+		},
+		Forecast: []Forecast{
+			{EnergyPrice: 1.0, EnergyBalance: 0.0},
+			{EnergyPrice: 2.0, EnergyBalance: -3.0},
+		},
+		Temperature: []float64{-5, 5},
+	}
+	var err error
+	input.Derating, err = NewDerating(input.Battery.AppConfigBatterySpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Only 1 kW can be charged in the cold hour, the rest is bought when it's expensive
+	checkPermutation(t, input, []Strategy{StrategyCharge, StrategyDefault}, 1.0+0.1+2.0*2.0+0.1, 10.0)
+}
+
+func TestOptimizerTaper(t *testing.T) {
+	half := 0.5
+	input := Input{
+		GridMaxPower: 25.0,
+		Tariff:       calc.Tariff{},
+		Battery: Battery{
+			CurrentLevel: 60.0,
+			AppConfigBatterySpec: config.AppConfigBatterySpec{
+				Capacity:         10.0,
+				MinLevel:         10.0,
+				MaxLevel:         100.0,
+				MaxChargeRate:    5.0,
+				MaxDischargeRate: 5.0,
+				Taper:            []config.AppConfigTaperPoint{{Level: 80}, {Level: 100, MaxChargeRate: &half}},
+			},
+		},
+		Forecast: []Forecast{
+			{EnergyPrice: 0.1, EnergyBalance: 0.0},
+			{EnergyPrice: 0.0, EnergyBalance: 0.0},
+			{EnergyPrice: 5.0, EnergyBalance: -9.0},
+		},
+	}
+
+	// Without the taper the battery is topped up in the free hour
+	if output := BestStrategies(input); output.Strategy[0] == StrategyCharge {
+		t.Errorf("got strategy '%s' in the first hour without a taper, wanted no charging", output.Strategy[0])
+	}
+
+	// With it the free hour isn't enough to fill the battery, so charging starts an hour earlier
+	var err error
+	input.Battery.Taper, err = NewTaper(input.Battery.AppConfigBatterySpec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if output := BestStrategies(input); output.Strategy[0] != StrategyCharge || output.Strategy[1] != StrategyCharge {
+		t.Errorf("got strategies %v with a taper, wanted charging in the first two hours", output.Strategy)
+	}
+}
+
+func TestOptimizerStability(t *testing.T) {
+	input := Input{
+		GridMaxPower: 25.0,
+		Tariff:       calc.Tariff{},
+		Battery: Battery{
+			CurrentLevel: 10.0,
+			AppConfigBatterySpec: config.AppConfigBatterySpec{
+				Capacity:         10.0,
+				MinLevel:         10.0,
+				MaxLevel:         100.0,
+				MaxChargeRate:    5.0,
+				MaxDischargeRate: 5.0,
+				DepthExponent:    flatWear,
+			},
+		},
+		Forecast: []Forecast{
+			{EnergyPrice: 1.0, EnergyBalance: 0.5},
+			{EnergyPrice: 1.01, EnergyBalance: 0.5},
+			{EnergyPrice: 3.0, EnergyBalance: -6.0},
+		},
+	}
+
+	// Charging in the first hour is slightly cheaper
+	checkBestStrategy(t, input, []Strategy{StrategyCharge, StrategyDefault, StrategyDefault}, 6.0, 10.0)
+
+	// The previous plan charged in the second hour and is kept
+	input.Committed = []Strategy{StrategyDefault, StrategyCharge}
+	input.DeviationCost = 0.1
+	checkBestStrategy(t, input, []Strategy{StrategyDefault, StrategyCharge, StrategyDefault}, 6.045, 10.0)
+
+	// Unless it switches strategy more often, charging already before the first hour
+	input.SwitchCost = 0.1
+	input.PrecedingStrategy = maybe.Some(StrategyCharge)
+	checkBestStrategy(t, input, []Strategy{StrategyCharge, StrategyDefault, StrategyDefault}, 6.0, 10.0)
+}
+
+func TestOptimizerImportPenalty(t *testing.T) {
+	input := Input{
+		GridMaxPower: 25.0,
+		Tariff:       calc.Tariff{},
+		Battery: Battery{
+			CurrentLevel: 10.0,
+			AppConfigBatterySpec: config.AppConfigBatterySpec{
+				Capacity:         10.0,
+				MinLevel:         10.0,
+				MaxLevel:         100.0,
+				MaxChargeRate:    3.0,
+				MaxDischargeRate: 3.0,
+				DepthExponent:    flatWear,
+			},
+		},
+		Forecast: []Forecast{
+			{EnergyPrice: 0.2, EnergyBalance: 0.0},
+			{EnergyPrice: 1.0, EnergyBalance: 0.0},
+		},
+	}
+
+	// Buying cheap and selling dear pays off
+	checkBestStrategy(t, input, []Strategy{StrategyCharge, StrategyDischarge}, -2.4, 10.0)
+
+	// Not when buying from the grid costs 1 more per kWh
+	input.ImportPenalty = 1.0
+	if output := BestStrategies(input); output.Strategy[0] == StrategyCharge || !almostEqual(output.Cost, 0) {
+		t.Errorf("got strategies %v costing %f with an import penalty, wanted no charging for free", output.Strategy, output.Cost)
+	}
+	checkPermutation(t, input, []Strategy{StrategyCharge, StrategyDischarge}, 3*1.2-3*1.0, 10.0)
+}
+
+func TestOptimizerCurtail(t *testing.T) {
+	input := Input{
+		GridMaxPower: 25.0,
+		Tariff:       calc.Tariff{EnergyTax: 1.5},
+		Battery: Battery{
+			CurrentLevel: 90.0,
+			AppConfigBatterySpec: config.AppConfigBatterySpec{
+				Capacity:         10.0,
+				MinLevel:         10.0,
+				MaxLevel:         100.0,
+				MaxChargeRate:    3.0,
+				MaxDischargeRate: 3.0,
+				DepthExponent:    flatWear,
+			},
+		},
+		Forecast: []Forecast{
+			{EnergyPrice: -1.0, EnergyBalance: 5.0},
+			{EnergyPrice: 1.0, EnergyBalance: 5.0},
+		},
+	}
+
+	// Without flexible loads to switch on, what the battery can't take is exported either
+	// way and costs 4 in the first hour
+	checkBestStrategy(t, input, []Strategy{StrategyDefault, StrategyDischarge}, 4.0-8.0, 70.0)
+	if cost, _ := costForPermutation(input, []Strategy{StrategyCurtail, StrategyDischarge}); !math.IsInf(cost, 1) {
+		t.Errorf("got cost %.2f, wanted curtailing to be disqualified", cost)
+	}
+	if options := input.hourStrategies(); len(options[1]) != len(baseStrategies) {
+		t.Errorf("got strategies %v when selling pays, wanted no curtailing", options[1])
+	}
+
+	// The loads take 3 of the 4 kWh, so only 1 kWh is exported at a cost
+	input.AddCurtailLoad([]float64{3.0, 3.0})
+	checkBestStrategy(t, input, []Strategy{StrategyCurtail, StrategyDischarge}, 1.0-8.0, 70.0)
+	checkPermutation(t, input, []Strategy{StrategyDefault, StrategyDischarge}, 4.0-8.0, 70.0)
+
+	// The battery charges at full rate and the loads take the rest
+	input.Battery.CurrentLevel = 50.0
+	input.Forecast = input.Forecast[:1]
+	checkPermutation(t, input, []Strategy{StrategyCurtail}, 0.0, 80.0)
+	input.Forecast[0].EnergyBalance = 8.0
+	checkPermutation(t, input, []Strategy{StrategyCurtail}, 2.0, 80.0)
+
+	// Nothing to curtail when the battery takes all of the surplus
+	input.Forecast[0].EnergyBalance = 2.0
+	if cost, _ := costForPermutation(input, []Strategy{StrategyCurtail}); !math.IsInf(cost, 1) {
+		t.Errorf("got cost %.2f, wanted curtailing to be disqualified", cost)
+	}
+
+	// The export compensation makes selling pay despite the negative price
+	input.Tariff.ExportCompensation = 1.5
+	if options := input.hourStrategies(); len(options[0]) != len(baseStrategies) {
+		t.Errorf("got strategies %v when selling pays, wanted no curtailing", options[0])
+	}
+}
+
+func TestOptimizerExportCap(t *testing.T) {
+	input := Input{
+		GridMaxPower: 25.0,
+		Tariff:       calc.Tariff{},
+		Battery: Battery{
+			CurrentLevel: 90.0,
+			AppConfigBatterySpec: config.AppConfigBatterySpec{
+				Capacity:         10.0,
+				MinLevel:         10.0,
+				MaxLevel:         100.0,
+				MaxChargeRate:    3.0,
+				MaxDischargeRate: 3.0,
+				DepthExponent:    flatWear,
+			},
+		},
+		Forecast: []Forecast{
+			{EnergyPrice: 0.2, EnergyBalance: 0.0},
+			{EnergyPrice: 0.5, EnergyBalance: 6.0},
+		},
+	}
+
+	checkBestStrategy(t, input, []Strategy{StrategyDischarge, StrategyDischarge}, -5.1, 30.0)
+
+	// Room is made in the battery for the surplus above the cap
+	input.ExportCap = maybe.Some(3.0)
+	checkBestStrategy(t, input, []Strategy{StrategyDischarge, StrategyPreserve}, -0.6-1.5, 90.0)
+	checkPermutation(t, input, []Strategy{StrategyDefault, StrategyDefault}, 2*1.0-1.5, 100.0)
+
+	// Nothing may be exported, so the battery is only discharged to cover the consumption
+	input.ExportCap = maybe.Some(0.0)
+	input.Forecast[0].EnergyBalance = -2.0
+	checkBestStrategy(t, input, []Strategy{StrategyDefault, StrategyDefault}, 3*1.0, 100.0)
+}
+
 func checkPermutation(t *testing.T, input Input, perm []Strategy, cost float64, battLvl float64) {
 	c, b := costForPermutation(input, perm)
 	if !almostEqual(c, cost) {
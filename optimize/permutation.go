@@ -2,26 +2,51 @@ package optimize
 
 import "math"
 
-// Generates all possible permutations of strategies
+// Strategies that are tried in every hour
+var baseStrategies = []Strategy{StrategyDefault, StrategyPreserve, StrategyCharge, StrategyDischarge}
+
+// Generates all possible permutations of the base strategies
 // for a given number of hours.
 func permute(hours int) [][]Strategy {
 	if hours < 1 || hours > 24 {
 		return [][]Strategy{{}}
 	}
 
-	count := int(math.Pow(float64(strategyCount), float64(hours)))
-	result := make([][]Strategy, count)
+	options := make([][]Strategy, hours)
+	for h := range options {
+		options[h] = baseStrategies
+	}
+	result := make([][]Strategy, 0, int(math.Pow(float64(len(baseStrategies)), float64(hours))))
+	forEachPermutation(options, func(perm []Strategy) {
+		result = append(result, append([]Strategy(nil), perm...))
+	})
+
+	return result
+}
+
+// Calls fn for every possible permutation of the strategies given for each hour,
+// without keeping them all in memory. The slice passed to fn is reused between calls.
+func forEachPermutation(options [][]Strategy, fn func(perm []Strategy)) {
+	hours := len(options)
+	if hours < 1 || hours > 24 {
+		fn([]Strategy{})
+		return
+	}
+
+	count := 1
+	for _, o := range options {
+		count *= len(o)
+	}
+	perm := make([]Strategy, hours)
 
 	for i := range count {
-		perm := make([]Strategy, hours)
 		temp := i
 		for j := hours - 1; j >= 0; j-- {
-			perm[j] = Strategy(temp % int(strategyCount))
-			temp /= int(strategyCount)
+			n := len(options[j])
+			perm[j] = options[j][temp%n]
+			temp /= n
 		}
 
-		result[i] = perm
+		fn(perm)
 	}
-
-	return result
 }
@@ -41,3 +41,17 @@ func TestPermutation(t *testing.T) {
 		t.Errorf("Expected permutations to be %v, got %v", expected, strategies)
 	}
 }
+
+func TestPermutationPerHour(t *testing.T) {
+	var strategies [][]Strategy
+	forEachPermutation([][]Strategy{{StrategyDefault, StrategyCurtail}, {StrategyCharge}}, func(perm []Strategy) {
+		strategies = append(strategies, append([]Strategy(nil), perm...))
+	})
+	expected := [][]Strategy{
+		{StrategyDefault, StrategyCharge},
+		{StrategyCurtail, StrategyCharge},
+	}
+	if !reflect.DeepEqual(strategies, expected) {
+		t.Errorf("Expected permutations to be %v, got %v", expected, strategies)
+	}
+}
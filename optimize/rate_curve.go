@@ -0,0 +1,79 @@
+package optimize
+
+import (
+	"slices"
+
+	"github.com/icodeforyou/solarplant-go/config"
+)
+
+// Maximum charge and discharge power that varies with something, e.g. the cell temperature
+// or the battery level, interpolated between points and the same as the closest point
+// outside them
+type rateCurve struct {
+	points       []ratePoint // Ordered by at
+	maxCharge    float64
+	maxDischarge float64
+}
+
+type ratePoint struct {
+	at        float64
+	charge    float64
+	discharge float64
+}
+
+// A point with the battery's maximum rates where none are given, and capped by them
+func newRatePoint(spec config.AppConfigBatterySpec, at float64, charge *float64, discharge *float64) ratePoint {
+	point := ratePoint{at: at, charge: spec.MaxChargeRate, discharge: spec.MaxDischargeRate}
+	if charge != nil {
+		point.charge = min(*charge, spec.MaxChargeRate)
+	}
+	if discharge != nil {
+		point.discharge = min(*discharge, spec.MaxDischargeRate)
+	}
+	return point
+}
+
+// Sorts the points, returns the position given more than once and false if any
+func newRateCurve(spec config.AppConfigBatterySpec, points []ratePoint) (rateCurve, float64, bool) {
+	slices.SortFunc(points, func(a, b ratePoint) int {
+		switch {
+		case a.at < b.at:
+			return -1
+		case a.at > b.at:
+			return 1
+		}
+		return 0
+	})
+	for i := 1; i < len(points); i++ {
+		if points[i].at == points[i-1].at {
+			return rateCurve{}, points[i].at, false
+		}
+	}
+	return rateCurve{points: points, maxCharge: spec.MaxChargeRate, maxDischarge: spec.MaxDischargeRate}, 0, true
+}
+
+func (c rateCurve) enabled() bool {
+	return len(c.points) > 0
+}
+
+// Maximum charge and discharge power in kW at a position on the curve
+func (c rateCurve) rates(at float64) (float64, float64) {
+	if len(c.points) == 0 {
+		return c.maxCharge, c.maxDischarge
+	}
+	first, last := c.points[0], c.points[len(c.points)-1]
+	if at <= first.at {
+		return first.charge, first.discharge
+	}
+	if at >= last.at {
+		return last.charge, last.discharge
+	}
+	for i := 1; i < len(c.points); i++ {
+		lo, hi := c.points[i-1], c.points[i]
+		if at <= hi.at {
+			frac := (at - lo.at) / (hi.at - lo.at)
+			return lo.charge + (hi.charge-lo.charge)*frac, lo.discharge + (hi.discharge-lo.discharge)*frac
+		}
+	}
+	return last.charge, last.discharge
+}
@@ -7,6 +7,7 @@ const (
 	StrategyPreserve                  // Preserve battery level
 	StrategyCharge                    // Buy power if produced power is not enough
 	StrategyDischarge                 // Sell excess power to the grid from the battery
+	StrategyCurtail                   // Selling costs money, the battery and flexible loads take the solar surplus
 	strategyCount                     // Number of strategies
 )
 
@@ -20,6 +21,8 @@ func (s Strategy) String() string {
 		return "charge"
 	case StrategyDischarge:
 		return "discharge"
+	case StrategyCurtail:
+		return "curtail"
 	default:
 		return "unknown"
 	}
@@ -28,3 +31,13 @@ func (s Strategy) String() string {
 func (s Strategy) IsValid() bool {
 	return s >= StrategyDefault && s < strategyCount
 }
+
+// The strategy with a name as given by String, false if there's none
+func ParseStrategy(name string) (Strategy, bool) {
+	for s := StrategyDefault; s < strategyCount; s++ {
+		if s.String() == name {
+			return s, true
+		}
+	}
+	return StrategyDefault, false
+}
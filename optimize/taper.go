@@ -0,0 +1,158 @@
+package optimize
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/icodeforyou/solarplant-go/config"
+)
+
+// Width in percentage points of the battery level ranges the taper is learned in
+const TaperStep = 5.0
+
+// Samples of a battery level range needed before the taper learned in it is trusted
+const minTaperSamples = 30
+
+// Lower charge power near full and discharge power near empty by battery level, e.g. the
+// constant voltage phase at the end of a charge where the battery takes less and less
+type Taper struct {
+	curve       rateCurve // By battery level
+	chargeFrom  float64   // Battery level above which the charge power is lowered
+	dischargeTo float64   // Battery level below which the discharge power is lowered
+}
+
+// How much of the commanded power the battery delivered within a range of battery levels
+type TaperSample struct {
+	Level    float64 // Lowest battery level of the range in percentage, see TaperRange
+	Charging bool
+	Ratio    float64 // Delivered power divided by commanded power
+	Samples  int
+}
+
+func NewTaper(spec config.AppConfigBatterySpec) (Taper, error) {
+	points := make([]ratePoint, 0, len(spec.Taper))
+	for _, p := range spec.Taper {
+		if p.Level < 0 || p.Level > 100 {
+			return Taper{}, fmt.Errorf("taper at %.0f%%: level must be between 0 and 100", p.Level)
+		}
+		point := newRatePoint(spec, p.Level, p.MaxChargeRate, p.MaxDischargeRate)
+		if point.charge < 0 || point.discharge < 0 {
+			return Taper{}, fmt.Errorf("taper at %.0f%%: rates can't be negative", p.Level)
+		}
+		points = append(points, point)
+	}
+
+	curve, duplicate, ok := newRateCurve(spec, points)
+	if !ok {
+		return Taper{}, fmt.Errorf("taper at %.0f%% is given more than once", duplicate)
+	}
+	return newTaper(curve), nil
+}
+
+func newTaper(curve rateCurve) Taper {
+	t := Taper{curve: curve, chargeFrom: math.Inf(1), dischargeTo: math.Inf(-1)}
+	for i, p := range curve.points {
+		if p.charge < curve.maxCharge {
+			t.chargeFrom = math.Inf(-1)
+			if i > 0 {
+				t.chargeFrom = curve.points[i-1].at
+			}
+			break
+		}
+	}
+	for i := len(curve.points) - 1; i >= 0; i-- {
+		if curve.points[i].discharge < curve.maxDischarge {
+			t.dischargeTo = math.Inf(1)
+			if i < len(curve.points)-1 {
+				t.dischargeTo = curve.points[i+1].at
+			}
+			break
+		}
+	}
+	return t
+}
+
+func (t Taper) Enabled() bool {
+	return t.curve.enabled()
+}
+
+// Maximum charge and discharge power in kW at a battery level in percentage
+func (t Taper) Rates(level float64) (float64, float64) {
+	return t.curve.rates(level)
+}
+
+// Maximum charge and discharge power in kW at a battery level where the taper lowers it and
+// infinite where it doesn't, the default strategy isn't limited by the battery's maximum
+// power and the taper doesn't change that
+func (t Taper) limits(level float64) (float64, float64) {
+	charge, discharge := t.curve.rates(level)
+	if charge >= t.curve.maxCharge {
+		charge = math.Inf(1)
+	}
+	if discharge >= t.curve.maxDischarge {
+		discharge = math.Inf(1)
+	}
+	return charge, discharge
+}
+
+// Whether the power is lowered anywhere between two battery levels, charging if the second
+// is higher and discharging otherwise
+func (t Taper) lowers(from, to float64) bool {
+	if to > from {
+		return to > t.chargeFrom
+	}
+	return to < t.dischargeTo
+}
+
+// The lowest battery level of the range a battery level is learned in
+func TaperRange(level float64) float64 {
+	return min(max(math.Floor(level/TaperStep)*TaperStep, 0), 100-TaperStep)
+}
+
+// The taper with what's learned from samples in place of the configured taper, in the
+// middle of each range with enough samples. Other ranges keep the configured taper.
+func (t Taper) Learned(samples []TaperSample) Taper {
+	type key struct {
+		level    float64
+		charging bool
+	}
+	ratios := make(map[key]float64)
+	for _, s := range samples {
+		if s.Samples >= minTaperSamples {
+			ratios[key{TaperRange(s.Level), s.Charging}] = min(max(s.Ratio, 0), 1)
+		}
+	}
+	if len(ratios) == 0 {
+		return t
+	}
+
+	var points []ratePoint
+	for level := 0.0; level < 100; level += TaperStep {
+		point := ratePoint{at: level + TaperStep/2}
+		point.charge, point.discharge = t.curve.rates(point.at)
+		chargeRatio, chargeLearned := ratios[key{level, true}]
+		if chargeLearned {
+			point.charge = chargeRatio * t.curve.maxCharge
+		}
+		dischargeRatio, dischargeLearned := ratios[key{level, false}]
+		if dischargeLearned {
+			point.discharge = dischargeRatio * t.curve.maxDischarge
+		}
+		points = append(points, point)
+	}
+	// Keep configured points where nothing is learned, e.g. a steep drop at full
+	for _, p := range t.curve.points {
+		r := TaperRange(p.at)
+		_, chargeLearned := ratios[key{r, true}]
+		_, dischargeLearned := ratios[key{r, false}]
+		if !chargeLearned && !dischargeLearned && p.at != r+TaperStep/2 {
+			points = append(points, p)
+		}
+	}
+
+	curve, _, _ := newRateCurve(config.AppConfigBatterySpec{
+		MaxChargeRate:    t.curve.maxCharge,
+		MaxDischargeRate: t.curve.maxDischarge,
+	}, points)
+	return newTaper(curve)
+}
@@ -0,0 +1,147 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/config"
+)
+
+func TestTaperRates(t *testing.T) {
+	one, three := 1.0, 3.0
+	taper, err := NewTaper(config.AppConfigBatterySpec{
+		MaxChargeRate:    5,
+		MaxDischargeRate: 5,
+		Taper: []config.AppConfigTaperPoint{
+			{Level: 100, MaxChargeRate: &one},
+			{Level: 10, MaxDischargeRate: &three},
+			{Level: 20},
+			{Level: 80},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		level     float64
+		charge    float64
+		discharge float64
+	}{
+		{5, 5, 3},
+		{15, 5, 4},
+		{50, 5, 5},
+		{90, 3, 5},
+		{100, 1, 5},
+	}
+	for _, tt := range tests {
+		charge, discharge := taper.Rates(tt.level)
+		if !almostEqual(charge, tt.charge) || !almostEqual(discharge, tt.discharge) {
+			t.Errorf("got %.2f/%.2f kW at %.0f%%, wanted %.2f/%.2f kW", charge, discharge, tt.level, tt.charge, tt.discharge)
+		}
+	}
+
+	ranges := []struct {
+		from, to float64
+		lowers   bool
+	}{
+		{30, 80, false},
+		{70, 85, true},
+		{90, 95, true},
+		{95, 20, false},
+		{50, 15, true},
+	}
+	for _, r := range ranges {
+		if got := taper.lowers(r.from, r.to); got != r.lowers {
+			t.Errorf("got %t for %.0f-%.0f%%, wanted %t", got, r.from, r.to, r.lowers)
+		}
+	}
+}
+
+func TestNewTaperInvalid(t *testing.T) {
+	negative := -1.0
+	invalid := [][]config.AppConfigTaperPoint{
+		{{Level: 90, MaxChargeRate: &negative}},
+		{{Level: 110}},
+		{{Level: 90}, {Level: 90}},
+	}
+	for i, points := range invalid {
+		if _, err := NewTaper(config.AppConfigBatterySpec{MaxChargeRate: 5, MaxDischargeRate: 5, Taper: points}); err == nil {
+			t.Errorf("points %d: expected an error", i)
+		}
+	}
+}
+
+func TestTaperLearned(t *testing.T) {
+	half := 0.5
+	spec := config.AppConfigBatterySpec{
+		MaxChargeRate:    5,
+		MaxDischargeRate: 5,
+		Taper:            []config.AppConfigTaperPoint{{Level: 80}, {Level: 100, MaxChargeRate: &half}},
+	}
+	configured, err := NewTaper(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	taper := configured.Learned([]TaperSample{
+		{Level: 90, Charging: true, Ratio: 0.4, Samples: 100},
+		{Level: 10, Charging: false, Ratio: 0.6, Samples: 100},
+		{Level: 50, Charging: true, Ratio: 0.1, Samples: 5}, // Too few samples
+	})
+
+	tests := []struct {
+		level     float64
+		charge    float64
+		discharge float64
+	}{
+		{12.5, 5, 3},      // Learned
+		{50, 5, 5},        // Not learned, nor configured
+		{92.5, 2, 5},      // Learned
+		{97.5, 1.0625, 5}, // Configured
+		{100, 0.5, 5},     // Configured point is kept
+	}
+	for _, tt := range tests {
+		charge, discharge := taper.Rates(tt.level)
+		if !almostEqual(charge, tt.charge) || !almostEqual(discharge, tt.discharge) {
+			t.Errorf("got %.3f/%.3f kW at %.1f%%, wanted %.3f/%.3f kW", charge, discharge, tt.level, tt.charge, tt.discharge)
+		}
+	}
+
+	if charge, _ := configured.Learned(nil).Rates(90); !almostEqual(charge, 2.75) {
+		t.Errorf("got %.3f kW at 90%% without samples, wanted the configured 2.75 kW", charge)
+	}
+}
+
+func TestUpdateLevelTaper(t *testing.T) {
+	zero := 0.0
+	spec := config.AppConfigBatterySpec{
+		Capacity:         10,
+		MinLevel:         10,
+		MaxLevel:         100,
+		MaxChargeRate:    5,
+		MaxDischargeRate: 5,
+		Taper:            []config.AppConfigTaperPoint{{Level: 80}, {Level: 100, MaxChargeRate: &zero}},
+	}
+	taper, err := NewTaper(spec)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Below the taper the whole hour is charged at full power
+	b := Battery{AppConfigBatterySpec: spec, CurrentLevel: 20, Taper: taper}
+	if diff := b.UpdateLevel(5, 1); !almostEqual(diff, 5) {
+		t.Errorf("got %.3f kWh charged below the taper, wanted 5 kWh", diff)
+	}
+
+	// The last 2 kWh up to full take more than an hour at full power
+	b = Battery{AppConfigBatterySpec: spec, CurrentLevel: 80, Taper: taper}
+	if diff := b.UpdateLevel(5, 1); diff <= 1.5 || diff >= 2 {
+		t.Errorf("got %.3f kWh charged in the taper, wanted between 1.5 and 2 kWh", diff)
+	}
+
+	// Discharging isn't tapered
+	b = Battery{AppConfigBatterySpec: spec, CurrentLevel: 100, Taper: taper}
+	if diff := b.UpdateLevel(-2.5, 0.5); !almostEqual(diff, -2.5) {
+		t.Errorf("got %.3f kWh discharged, wanted -2.5 kWh", diff)
+	}
+}
@@ -0,0 +1,143 @@
+package priceforecast
+
+import (
+	"errors"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+const (
+	minDays        = 14 // Minimum number of complete days needed to train a model
+	minDayHours    = 20 // A day with fewer priced hours than this is not used
+	minWeekDays    = 5  // Minimum number of days in the preceding week to compute its level
+	minBucketCount = 3  // Below this the hour of day profile is used instead of the more specific one
+)
+
+var ErrNotEnoughHistory = errors.New("not enough price history to train a price forecast model")
+
+type Sample struct {
+	Hour  hours.DateHour
+	Price float64
+}
+
+type profileKey struct {
+	season  string
+	weekday time.Weekday
+	hour    int
+}
+
+type average struct {
+	sum   float64
+	count int
+}
+
+func (a *average) add(v float64) {
+	a.sum += v
+	a.count++
+}
+
+func (a average) value() float64 {
+	if a.count == 0 {
+		return 0
+	}
+	return a.sum / float64(a.count)
+}
+
+// A price profile where an estimated price is the recent price level adjusted by
+// how the daily mean usually differs on the weekday, and by how the price of the
+// hour usually differs from the daily mean for the season and weekday.
+// Hours and weekdays are in Swedish local time, i.e. CET, like the day-ahead market.
+type Model struct {
+	dayOffsets   map[time.Weekday]average
+	hourOffsets  map[profileKey]average
+	hourFallback map[int]average
+}
+
+func Train(samples []Sample) (Model, error) {
+	days := make(map[string][]float64)
+	for _, s := range samples {
+		t := localTime(s.Hour)
+		date := t.Format(time.DateOnly)
+		days[date] = append(days[date], s.Price)
+	}
+
+	dayMeans := make(map[string]float64)
+	for date, prices := range days {
+		if len(prices) >= minDayHours {
+			dayMeans[date] = calc.Mean(prices)
+		}
+	}
+
+	if len(dayMeans) < minDays {
+		return Model{}, ErrNotEnoughHistory
+	}
+
+	m := Model{
+		dayOffsets:   make(map[time.Weekday]average),
+		hourOffsets:  make(map[profileKey]average),
+		hourFallback: make(map[int]average),
+	}
+
+	for date, mean := range dayMeans {
+		day, _ := time.Parse(time.DateOnly, date)
+		var week []float64
+		for i := 1; i <= 7; i++ {
+			if prev, ok := dayMeans[day.AddDate(0, 0, -i).Format(time.DateOnly)]; ok {
+				week = append(week, prev)
+			}
+		}
+		if len(week) >= minWeekDays {
+			a := m.dayOffsets[day.Weekday()]
+			a.add(mean - calc.Mean(week))
+			m.dayOffsets[day.Weekday()] = a
+		}
+	}
+
+	for _, s := range samples {
+		t := localTime(s.Hour)
+		mean, ok := dayMeans[t.Format(time.DateOnly)]
+		if !ok {
+			continue
+		}
+		key := profileKey{season: calc.Season(t.Month()), weekday: t.Weekday(), hour: t.Hour()}
+		a := m.hourOffsets[key]
+		a.add(s.Price - mean)
+		m.hourOffsets[key] = a
+
+		f := m.hourFallback[t.Hour()]
+		f.add(s.Price - mean)
+		m.hourFallback[t.Hour()] = f
+	}
+
+	return m, nil
+}
+
+// Estimates the price of the hour given the average price of the preceding week
+func (m Model) Predict(hour hours.DateHour, recentLevel float64) float64 {
+	t := localTime(hour)
+	price := recentLevel + m.dayOffsets[t.Weekday()].value()
+
+	key := profileKey{season: calc.Season(t.Month()), weekday: t.Weekday(), hour: t.Hour()}
+	if a := m.hourOffsets[key]; a.count >= minBucketCount {
+		return price + a.value()
+	}
+	return price + m.hourFallback[t.Hour()].value()
+}
+
+// Average price of the week before the hour, zero if there are no samples
+func RecentLevel(samples []Sample, before hours.DateHour) float64 {
+	from := before.Sub(7 * 24)
+	var prices []float64
+	for _, s := range samples {
+		if s.Hour.Compare(from) >= 0 && s.Hour.Compare(before) < 0 {
+			prices = append(prices, s.Price)
+		}
+	}
+	return calc.Mean(prices)
+}
+
+func localTime(dh hours.DateHour) time.Time {
+	return hours.LocationStockholm(hours.FromIso(dh.IsoString()))
+}
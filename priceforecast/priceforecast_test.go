@@ -0,0 +1,72 @@
+package priceforecast
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+// Prices are 1.0 during the night and day, 2.0 between 17 and 20 local time
+// and 0.5 lower on weekends
+func syntheticPrice(t time.Time) float64 {
+	local := hours.LocationStockholm(t)
+	price := 1.0
+	if local.Hour() >= 17 && local.Hour() < 20 {
+		price = 2.0
+	}
+	if local.Weekday() == time.Saturday || local.Weekday() == time.Sunday {
+		price -= 0.5
+	}
+	return price
+}
+
+func syntheticSamples(from time.Time, days int) []Sample {
+	var samples []Sample
+	for h := range days * 24 {
+		t := from.Add(time.Duration(h) * time.Hour)
+		samples = append(samples, Sample{Hour: hours.FromTime(t), Price: syntheticPrice(t)})
+	}
+	return samples
+}
+
+func TestPredict(t *testing.T) {
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	samples := syntheticSamples(from, 8*7)
+
+	m, err := Train(samples)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	next := from.AddDate(0, 0, 8*7)
+	level := RecentLevel(samples, hours.FromTime(next))
+	for h := range 48 {
+		tm := next.Add(time.Duration(h) * time.Hour)
+		want := syntheticPrice(tm)
+		if got := m.Predict(hours.FromTime(tm), level); math.Abs(got-want) > 0.05 {
+			t.Errorf("hour %s: got %f, wanted %f", hours.FromTime(tm), got, want)
+		}
+	}
+}
+
+func TestTrainNotEnoughHistory(t *testing.T) {
+	samples := syntheticSamples(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), 7)
+	if _, err := Train(samples); !errors.Is(err, ErrNotEnoughHistory) {
+		t.Errorf("got error %v, wanted ErrNotEnoughHistory", err)
+	}
+}
+
+func TestRecentLevel(t *testing.T) {
+	samples := []Sample{
+		{Hour: hours.DateHour{Date: "2025-03-01", Hour: 0}, Price: 10.0}, // More than a week before
+		{Hour: hours.DateHour{Date: "2025-03-05", Hour: 0}, Price: 1.0},
+		{Hour: hours.DateHour{Date: "2025-03-07", Hour: 0}, Price: 3.0},
+		{Hour: hours.DateHour{Date: "2025-03-08", Hour: 12}, Price: 10.0}, // After
+	}
+	if v := RecentLevel(samples, hours.DateHour{Date: "2025-03-08", Hour: 12}); v != 2.0 {
+		t.Errorf("got level %f, wanted 2.0", v)
+	}
+}
@@ -0,0 +1,134 @@
+package reserve
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+const (
+	ReasonSchedule   = "schedule"
+	ReasonBadWeather = "bad weather"
+)
+
+// Battery level to keep for an hour, and why
+type Level struct {
+	MinLevel float64 // Battery minimum level in percentage, 0 if no reserve applies
+	Reason   string
+}
+
+type scheduledLevel struct {
+	minLevel float64
+	window   *hours.TimeWindow // The whole day if nil
+	months   []time.Month      // The whole year if empty
+}
+
+// When and how much of the battery to keep for outages
+type Policy struct {
+	schedule []scheduledLevel
+	weather  config.AppConfigReserveWeather
+}
+
+func New(c config.AppConfigBatteryReserve) (Policy, error) {
+	var p Policy
+	for _, s := range c.Schedule {
+		if s.MinLevel < 0 || s.MinLevel > 100 {
+			return Policy{}, fmt.Errorf("battery reserve level %.1f is not a percentage", s.MinLevel)
+		}
+		level := scheduledLevel{minLevel: s.MinLevel}
+		if s.From != "" || s.To != "" {
+			w, err := hours.ParseTimeWindow(s.From, s.To)
+			if err != nil {
+				return Policy{}, fmt.Errorf("battery reserve schedule: %w", err)
+			}
+			level.window = &w
+		}
+		for _, m := range s.Months {
+			if m < 1 || m > 12 {
+				return Policy{}, fmt.Errorf("battery reserve schedule: invalid month %d", m)
+			}
+			level.months = append(level.months, time.Month(m))
+		}
+		p.schedule = append(p.schedule, level)
+	}
+
+	w := c.Weather
+	if w.MinLevel < 0 || w.MinLevel > 100 {
+		return Policy{}, fmt.Errorf("battery reserve level %.1f is not a percentage", w.MinLevel)
+	}
+	if w.MinLevel > 0 && w.WindGust == nil && w.Precipitation == nil {
+		return Policy{}, fmt.Errorf("battery reserve weather rule needs wind_gust or precipitation")
+	}
+	p.weather = w
+
+	return p, nil
+}
+
+// The highest scheduled level at the time
+func (p Policy) Scheduled(t time.Time) float64 {
+	level := 0.0
+	month := hours.InGuiTimezone(t).Month()
+	for _, s := range p.schedule {
+		if len(s.months) > 0 && !slices.Contains(s.months, month) {
+			continue
+		}
+		if s.window != nil && !s.window.ContainsTime(t) {
+			continue
+		}
+		level = max(level, s.minLevel)
+	}
+	return level
+}
+
+// Whether the forecast for the hour is bad enough to raise the reserve
+func (p Policy) BadWeather(wf database.WeatherForecastRow) bool {
+	if p.weather.MinLevel <= 0 {
+		return false
+	}
+	if p.weather.WindGust != nil && wf.WindGust.Valid && wf.WindGust.Float64 >= *p.weather.WindGust {
+		return true
+	}
+	if p.weather.Precipitation != nil && wf.Precipitation >= *p.weather.Precipitation {
+		return true
+	}
+	return false
+}
+
+// Returns the reserve for each of the hours from start. A scheduled level applies to an
+// hour if it applies to any part of it, and the bad weather level from some hours before
+// bad weather is forecast until it has passed.
+func (p Policy) Hourly(start hours.DateHour, noOfHours int, weather []database.WeatherForecastRow) []Level {
+	badWeather := make(map[hours.DateHour]bool)
+	for _, wf := range weather {
+		if p.BadWeather(wf) {
+			badWeather[wf.When] = true
+		}
+	}
+
+	levels := make([]Level, noOfHours)
+	for h := range noOfHours {
+		hour := start.Add(h)
+		from := hours.FromIso(hour.IsoString())
+		for m := 0; m < 60; m++ {
+			if level := p.Scheduled(from.Add(time.Duration(m) * time.Minute)); level > levels[h].MinLevel {
+				levels[h] = Level{MinLevel: level, Reason: ReasonSchedule}
+			}
+		}
+
+		if p.weather.MinLevel <= levels[h].MinLevel {
+			continue
+		}
+		for ahead := 0; ahead <= p.weather.GetHoursBefore(); ahead++ {
+			if badWeather[hour.Add(ahead)] {
+				levels[h] = Level{MinLevel: p.weather.MinLevel, Reason: ReasonBadWeather}
+				break
+			}
+		}
+	}
+
+	return levels
+}
@@ -0,0 +1,116 @@
+package reserve
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestScheduled(t *testing.T) {
+	policy, err := New(config.AppConfigBatteryReserve{
+		Schedule: []config.AppConfigReserveLevel{
+			{MinLevel: 20},
+			{MinLevel: 40, From: "16:00", To: "22:00", Months: []int{11, 12, 1, 2}},
+			{MinLevel: 30, From: "22:00", To: "06:00"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want float64
+	}{
+		{"winter evening", time.Date(2025, 12, 1, 17, 0, 0, 0, time.UTC), 40},
+		{"summer evening", time.Date(2025, 6, 1, 17, 0, 0, 0, time.UTC), 20},
+		{"winter night", time.Date(2025, 12, 1, 23, 0, 0, 0, time.UTC), 30},
+		{"winter day", time.Date(2025, 12, 1, 12, 0, 0, 0, time.UTC), 20},
+	}
+	for _, tt := range tests {
+		if got := policy.Scheduled(tt.t); got != tt.want {
+			t.Errorf("%s: got %.0f, wanted %.0f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHourly(t *testing.T) {
+	policy, err := New(config.AppConfigBatteryReserve{
+		Schedule: []config.AppConfigReserveLevel{{MinLevel: 30, From: "10:30", To: "11:00"}},
+		Weather:  config.AppConfigReserveWeather{MinLevel: 60, WindGust: ptr(20.0), HoursBefore: ptr(2)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	start := hours.DateHour{Date: "2025-12-01", Hour: 8}
+	weather := []database.WeatherForecastRow{
+		{When: hours.DateHour{Date: "2025-12-01", Hour: 14}, WindGust: sql.NullFloat64{Float64: 24, Valid: true}},
+		{When: hours.DateHour{Date: "2025-12-01", Hour: 15}, WindGust: sql.NullFloat64{Float64: 12, Valid: true}},
+	}
+
+	levels := policy.Hourly(start, 8, weather)
+	want := []Level{
+		{0, ""},
+		{0, ""},
+		{30, ReasonSchedule}, // 10:00, the schedule starts half way through the hour
+		{0, ""},
+		{60, ReasonBadWeather}, // 12:00, 2 hours before the storm
+		{60, ReasonBadWeather},
+		{60, ReasonBadWeather},
+		{0, ""}, // 15:00, the storm has passed
+	}
+	for h, l := range levels {
+		if l != want[h] {
+			t.Errorf("hour %d: got %+v, wanted %+v", h, l, want[h])
+		}
+	}
+}
+
+func TestBadWeather(t *testing.T) {
+	policy, err := New(config.AppConfigBatteryReserve{
+		Weather: config.AppConfigReserveWeather{MinLevel: 60, WindGust: ptr(20.0), Precipitation: ptr(8.0)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		wf   database.WeatherForecastRow
+		want bool
+	}{
+		{"calm", database.WeatherForecastRow{Precipitation: 1, WindGust: sql.NullFloat64{Float64: 8, Valid: true}}, false},
+		{"gusts", database.WeatherForecastRow{WindGust: sql.NullFloat64{Float64: 20, Valid: true}}, true},
+		{"heavy rain", database.WeatherForecastRow{Precipitation: 9.5}, true},
+		{"no gusts forecast", database.WeatherForecastRow{}, false},
+	}
+	for _, tt := range tests {
+		if got := policy.BadWeather(tt.wf); got != tt.want {
+			t.Errorf("%s: got %t, wanted %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	invalid := []config.AppConfigBatteryReserve{
+		{Schedule: []config.AppConfigReserveLevel{{MinLevel: 120}}},
+		{Schedule: []config.AppConfigReserveLevel{{MinLevel: 40, From: "16"}}},
+		{Schedule: []config.AppConfigReserveLevel{{MinLevel: 40, Months: []int{13}}}},
+		{Weather: config.AppConfigReserveWeather{MinLevel: 60}},
+	}
+	for i, c := range invalid {
+		if _, err := New(c); err == nil {
+			t.Errorf("config %d: expected an error", i)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package savings
+
+import (
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+)
+
+// What the energy for an hour cost, and what it would have cost without the battery and
+// with a battery that only stores the own production. Costs are positive when paying and
+// negative when earning.
+type Hour struct {
+	Actual          float64
+	NoBattery       float64
+	SelfConsumption float64
+	Level           float64 // Level of the self-consumption battery in percentage at the end of the hour
+}
+
+// Compares the cost of energy with baselines that have the same production and
+// consumption, flexible loads and EV charging included. The self-consumption battery
+// charges from any surplus and discharges whenever the consumption is higher than the
+// production, without regard to prices and without losses.
+type Model struct {
+	tariff calc.Tariff
+	spec   config.AppConfigBatterySpec
+}
+
+func New(tariff calc.Tariff, spec config.AppConfigBatterySpec) Model {
+	return Model{tariff: tariff, spec: spec}
+}
+
+// The costs of an hour in the time series, where the self-consumption battery starts
+// at a level in percentage, e.g. where it ended the hour before
+func (m Model) Hour(ts database.TimeSeriesRow, level float64) Hour {
+	surplus := ts.Production - ts.Consumption
+	h := Hour{
+		Actual:    m.cost(ts.GridImport, ts.GridExport, ts.EnergyPrice),
+		NoBattery: m.cost(max(-surplus, 0), max(surplus, 0), ts.EnergyPrice),
+	}
+	if m.spec.Capacity <= 0 {
+		h.SelfConsumption = h.NoBattery
+		return h
+	}
+
+	stored := min(max(level, m.spec.MinLevel), m.spec.MaxLevel) * m.spec.Capacity / 100
+	if surplus > 0 {
+		charged := max(min(surplus, m.spec.MaxChargeRate, m.spec.MaxKWh()-stored), 0)
+		stored += charged
+		surplus -= charged
+	} else {
+		discharged := max(min(-surplus, m.spec.MaxDischargeRate, stored-m.spec.MinKWh()), 0)
+		stored -= discharged
+		surplus += discharged
+	}
+	h.SelfConsumption = m.cost(max(-surplus, 0), max(surplus, 0), ts.EnergyPrice)
+	h.Level = stored / m.spec.Capacity * 100
+	return h
+}
+
+func (m Model) cost(gridImport, gridExport, price float64) float64 {
+	return -m.tariff.CashFlow(gridImport, gridExport, price)
+}
@@ -0,0 +1,57 @@
+package savings
+
+import (
+	"math"
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+)
+
+func TestHour(t *testing.T) {
+	tariff := calc.Tariff{VAT: 0.25, EnergyTax: 0.5, ImportFee: 0.2, ExportCompensation: 0.1}
+	spec := config.AppConfigBatterySpec{Capacity: 10, MinLevel: 10, MaxLevel: 90, MaxChargeRate: 3, MaxDischargeRate: 3}
+	model := New(tariff, spec)
+
+	tests := []struct {
+		name  string
+		ts    database.TimeSeriesRow
+		level float64
+		want  Hour
+	}{
+		{"surplus stored", database.TimeSeriesRow{Production: 3, Consumption: 1, EnergyPrice: 1}, 50,
+			Hour{Actual: 0, NoBattery: -2.2, SelfConsumption: 0, Level: 70}},
+		{"surplus above the charge rate", database.TimeSeriesRow{Production: 6, Consumption: 1, GridExport: 1, EnergyPrice: 1}, 50,
+			Hour{Actual: -1.1, NoBattery: -5.5, SelfConsumption: -2.2, Level: 80}},
+		{"full", database.TimeSeriesRow{Production: 3, Consumption: 1, GridExport: 2, EnergyPrice: 1}, 90,
+			Hour{Actual: -2.2, NoBattery: -2.2, SelfConsumption: -2.2, Level: 90}},
+		{"deficit covered", database.TimeSeriesRow{Consumption: 2, GridImport: 1, EnergyPrice: 1}, 50,
+			Hour{Actual: 2.125, NoBattery: 4.25, SelfConsumption: 0, Level: 30}},
+		{"nearly empty", database.TimeSeriesRow{Consumption: 2, GridImport: 2, EnergyPrice: 1}, 15,
+			Hour{Actual: 4.25, NoBattery: 4.25, SelfConsumption: 3.1875, Level: 10}},
+		{"below the min level", database.TimeSeriesRow{Consumption: 2, EnergyPrice: 1}, 5,
+			Hour{Actual: 0, NoBattery: 4.25, SelfConsumption: 4.25, Level: 10}},
+		{"negative price", database.TimeSeriesRow{Production: 3, Consumption: 1, EnergyPrice: -0.5}, 50,
+			Hour{Actual: 0, NoBattery: 0.8, SelfConsumption: 0, Level: 70}},
+	}
+	for _, tt := range tests {
+		got := model.Hour(tt.ts, tt.level)
+		if !almostEqual(got.Actual, tt.want.Actual) || !almostEqual(got.NoBattery, tt.want.NoBattery) ||
+			!almostEqual(got.SelfConsumption, tt.want.SelfConsumption) || !almostEqual(got.Level, tt.want.Level) {
+			t.Errorf("%s: got %+v, wanted %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestHourWithoutBattery(t *testing.T) {
+	model := New(calc.Tariff{}, config.AppConfigBatterySpec{})
+	got := model.Hour(database.TimeSeriesRow{Production: 1, Consumption: 3, GridImport: 2, EnergyPrice: 2}, 50)
+	if got.SelfConsumption != got.NoBattery || got.NoBattery != 4 {
+		t.Errorf("got %+v, wanted the self-consumption cost to be the 4 without battery", got)
+	}
+}
+
+func almostEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
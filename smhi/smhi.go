@@ -1,22 +1,40 @@
 package smhi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"time"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/types"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
 )
 
-func Get(lon float64, lat float64) ([]WetherForecast, error) {
+type Smhi struct {
+	baseUrl   string
+	latitude  float64
+	longitude float64
+}
+
+func New(baseUrl string, latitude float64, longitude float64) Smhi {
+	return Smhi{baseUrl: baseUrl, latitude: latitude, longitude: longitude}
+}
+
+func (s Smhi) GetWeatherForecast(ctx context.Context) ([]types.WeatherForecast, error) {
 	url := fmt.Sprintf(
 		"%s/api/category/pmp3g/version/2/geotype/point/lon/%0.4f/lat/%0.4f/data.json",
-		BASE_URL, lon, lat)
+		s.baseUrl, s.longitude, s.latitude)
 
 	slog.Default().Info("fetching forecast from SMHI...", "url", url)
 
-	req, _ := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SMHI request: %w", err)
+	}
 	client := http.Client{Timeout: 10 * time.Second}
 	res, err := client.Do(req)
 	if err != nil {
@@ -24,6 +42,10 @@ func Get(lon float64, lat float64) ([]WetherForecast, error) {
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code from SMHI: %d", res.StatusCode)
+	}
+
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
 		return nil, fmt.Errorf("error reading SMHI response body: %v", err)
@@ -34,13 +56,15 @@ func Get(lon float64, lat float64) ([]WetherForecast, error) {
 		return nil, fmt.Errorf("error unmarshaling SMHI json: %v", err)
 	}
 
-	result := make([]WetherForecast, 0)
+	result := make([]types.WeatherForecast, 0)
 	for _, entry := range smhi.TimeSeries {
-		result = append(result, WetherForecast{
-			Hour:          entry.ValidTime,
-			CloudCover:    uint8(getParameter(entry.Parameters, "tcc_mean")),
-			Temperature:   getParameter(entry.Parameters, "t"),
-			Precipitation: getParameter(entry.Parameters, "pmean"),
+		result = append(result, types.WeatherForecast{
+			Hour:           hours.FromTime(entry.ValidTime),
+			CloudCover:     uint8(getParameter(entry.Parameters, "tcc_mean")),
+			Temperature:    getParameter(entry.Parameters, "t"),
+			Precipitation:  getParameter(entry.Parameters, "pmean"),
+			SolarRadiation: maybe.None[float64](), // Not provided by SMHI
+			WindGust:       maybe.SqlNull(findParameter(entry.Parameters, "gust")),
 		})
 	}
 
@@ -48,11 +72,16 @@ func Get(lon float64, lat float64) ([]WetherForecast, error) {
 }
 
 func getParameter(params []parameter, name string) float64 {
+	value, _ := findParameter(params, name)
+	return value
+}
+
+func findParameter(params []parameter, name string) (float64, bool) {
 	for _, param := range params {
-		if param.Name == name {
-			return param.Values[0]
+		if param.Name == name && len(param.Values) > 0 {
+			return param.Values[0], true
 		}
 	}
 
-	return 0
+	return 0, false
 }
@@ -0,0 +1,53 @@
+package smhi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+func TestGetWeatherForecast(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/lon/12.6905/lat/56.8619/data.json") {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		http.ServeFile(w, r, "testdata/pmp3g.json")
+	}))
+	defer srv.Close()
+
+	fc, err := New(srv.URL, 56.86194, 12.69046).GetWeatherForecast(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fc) != 2 {
+		t.Fatalf("got %d hours, wanted 2", len(fc))
+	}
+	if fc[1].Hour != (hours.DateHour{Date: "2025-06-01", Hour: 11}) {
+		t.Errorf("got hour %s, wanted 2025-06-01 11", fc[1].Hour)
+	}
+	if fc[1].CloudCover != 7 || fc[1].Temperature != 18.1 || fc[1].Precipitation != 0.3 {
+		t.Errorf("unexpected forecast %+v", fc[1])
+	}
+	if fc[1].SolarRadiation.IsValid() {
+		t.Errorf("expected no solar radiation from SMHI")
+	}
+	if fc[0].WindGust.IsValid() || fc[1].WindGust.Value() != 14.2 {
+		t.Errorf("got wind gusts %v and %v, wanted none and 14.2", fc[0].WindGust, fc[1].WindGust)
+	}
+}
+
+func TestGetWeatherForecastBadStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if _, err := New(srv.URL, 56.86, 12.69).GetWeatherForecast(context.Background()); err == nil {
+		t.Errorf("expected an error when SMHI is unavailable")
+	}
+}
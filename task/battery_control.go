@@ -0,0 +1,208 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/ferroamp"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+// Difference in kWh between the commanded and the actual battery energy within which
+// the battery followed the plan, or in share of the commanded energy if that's more
+const (
+	adherenceEnergyTolerance      = 0.3
+	adherenceEnergyToleranceShare = 0.1
+)
+
+// Difference in percentage points between the planned and the actual battery level at
+// the end of the hour within which the target is reached
+const adherenceLevelTolerance = 5.0
+
+// Sends an instruction to the ESO and records it in the control log with the answer
+func SendBatteryInstruction(
+	ctx context.Context,
+	logger *slog.Logger,
+	db *database.Database,
+	fa *ferroamp.Ferroamp,
+	bi BatteryInstruction) {
+
+	sentAt := time.Now()
+	var result ferroamp.ControlResult
+	var err error
+	switch bi.Action {
+	case ActionAuto:
+		result, err = fa.SetBatteryAuto()
+	case ActionCharge:
+		result, err = fa.SetBatteryLoad(-bi.Power)
+	case ActionDischarge:
+		result, err = fa.SetBatteryLoad(bi.Power)
+	default:
+		logger.Error("unknown battery action", slog.Any("action", bi.Action))
+		return
+	}
+	if err != nil {
+		logger.Error(fmt.Sprintf("failed to set battery to %s mode", bi.Action), slog.Any("error", err))
+	}
+	if ctx.Err() != nil {
+		logger.Warn("not saving control log, the caller stopped waiting", slog.Any("action", bi.Action), slog.String("status", result.Status))
+		return
+	}
+
+	if err := db.AddControlLog(ctx, controlLogRow(bi, result, err, sentAt)); err != nil {
+		logger.Error("failed to save control log", slog.Any("error", err))
+	}
+}
+
+func controlLogRow(bi BatteryInstruction, result ferroamp.ControlResult, err error, sentAt time.Time) database.ControlLogRow {
+	row := database.ControlLogRow{
+		Timestamp: sentAt,
+		Action:    string(bi.Action),
+		Power:     bi.Power,
+		Strategy:  bi.Strategy,
+		Reason:    bi.Reason,
+		Limit:     bi.Limit,
+		TransId:   result.TransId,
+		Status:    result.Status,
+		Message:   result.Message,
+	}
+	if err != nil {
+		row.Status, row.Message = database.ControlStatusFailed, err.Error()
+	} else if result.Status != ferroamp.StatusTimeout {
+		row.Latency = sql.NullFloat64{Float64: result.Latency.Seconds(), Valid: true}
+	}
+	return row
+}
+
+// An instruction and how long it was in effect during an hour
+type controlInterval struct {
+	entry    database.ControlLogRow
+	duration time.Duration
+}
+
+// The time each instruction was in effect during the hour. The entries are the ones sent
+// during the hour and the one in effect when it began, oldest first.
+func controlIntervals(entries []database.ControlLogRow, dh hours.DateHour) []controlInterval {
+	from := hours.FromIso(dh.IsoString())
+	to := from.Add(time.Hour)
+	var intervals []controlInterval
+	for i, e := range entries {
+		end := to
+		if i+1 < len(entries) && entries[i+1].Timestamp.Before(to) {
+			end = entries[i+1].Timestamp
+		}
+		if start := maxTime(e.Timestamp, from); end.After(start) {
+			intervals = append(intervals, controlInterval{entry: e, duration: end.Sub(start)})
+		}
+	}
+	return intervals
+}
+
+// Instructions sent during the hour and minutes the battery followed the plan, i.e. an
+// instruction following the plan was in effect and acknowledged by the ESO, see
+// controlIntervals for the entries
+func controlSummary(entries []database.ControlLogRow, dh hours.DateHour) (int, float64) {
+	from := hours.FromIso(dh.IsoString())
+	to := from.Add(time.Hour)
+	commands := 0
+	for _, e := range entries {
+		if !e.Timestamp.Before(from) && e.Timestamp.Before(to) {
+			commands++
+		}
+	}
+	followed := time.Duration(0)
+	for _, ci := range controlIntervals(entries, dh) {
+		if ci.entry.Reason == ReasonPlan && ci.entry.Status == "ack" {
+			followed += ci.duration
+		}
+	}
+	return commands, followed.Minutes()
+}
+
+// How well the battery followed the plan for the hour, from the instructions in effect
+// during it, see controlIntervals, and the battery net load in kWh and level at the end
+// of it. The causes are the reasons, answers and limits of the instructions that didn't
+// simply follow the plan, and whether the battery delivered the commanded energy and
+// reached the planned level. Both are only judged when the battery was commanded all
+// hour, when left to the ESO they depend on the consumption.
+func planAdherence(
+	spec config.AppConfigBatterySpec,
+	planning database.PlanningRow,
+	entries []database.ControlLogRow,
+	dh hours.DateHour,
+	netLoad float64,
+	level float64) database.PlanAdherenceRow {
+
+	row := database.PlanAdherenceRow{
+		When:        dh,
+		Strategy:    planning.Strategy,
+		Actual:      netLoad,
+		LevelTarget: planning.BatteryLevelTo,
+		Level:       level,
+	}
+	var causes []string
+	addCause := func(cause string) {
+		if cause != "" && !slices.Contains(causes, cause) {
+			causes = append(causes, cause)
+		}
+	}
+
+	var auto, charge, discharge time.Duration
+	for _, ci := range controlIntervals(entries, dh) {
+		e := ci.entry
+		switch e.Action {
+		case ActionCharge:
+			charge += ci.duration
+			row.Commanded -= min(e.Power, spec.MaxChargeRate) * ci.duration.Hours()
+		case ActionDischarge:
+			discharge += ci.duration
+			row.Commanded += min(e.Power, spec.MaxDischargeRate) * ci.duration.Hours()
+		default:
+			auto += ci.duration
+		}
+		if e.Reason != ReasonPlan {
+			addCause(e.Reason)
+		}
+		if e.Status != "ack" {
+			addCause(e.Status)
+		}
+		addCause(e.Limit)
+	}
+	row.AutoMinutes, row.ChargeMinutes, row.DischargeMinutes = auto.Minutes(), charge.Minutes(), discharge.Minutes()
+
+	if auto == 0 && charge+discharge == time.Hour {
+		// Compared in the commanded direction, holding at 0 kW moves either way
+		commanded, delivered := row.Commanded, row.Actual
+		if commanded < 0 || (commanded == 0 && delivered < 0) {
+			commanded, delivered = -commanded, -delivered
+		}
+		tolerance := max(adherenceEnergyTolerance, commanded*adherenceEnergyToleranceShare)
+		switch {
+		case delivered < commanded-tolerance:
+			addCause("delivered less")
+		case delivered > commanded+tolerance:
+			addCause("delivered more")
+		}
+		if row.LevelTarget.Valid && math.Abs(level-row.LevelTarget.Float64) > adherenceLevelTolerance {
+			addCause("target missed")
+		}
+	}
+
+	row.Causes = strings.Join(causes, ", ")
+	return row
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
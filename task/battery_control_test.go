@@ -0,0 +1,116 @@
+package task
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/ferroamp"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+func TestControlLogRow(t *testing.T) {
+	bi := BatteryInstruction{Action: ActionCharge, Power: 3, Strategy: "charge", Reason: ReasonPlan}
+	now := time.Now()
+
+	row := controlLogRow(bi, ferroamp.ControlResult{TransId: "solarplant-1", Status: "ack", Latency: 1500 * time.Millisecond}, nil, now)
+	if row.Status != "ack" || !row.Latency.Valid || row.Latency.Float64 != 1.5 || row.Reason != ReasonPlan || row.Strategy != "charge" {
+		t.Errorf("got %+v, wanted an acknowledged charge after 1.5 s", row)
+	}
+
+	row = controlLogRow(bi, ferroamp.ControlResult{TransId: "solarplant-1", Status: ferroamp.StatusTimeout, Latency: 30 * time.Second}, nil, now)
+	if row.Status != ferroamp.StatusTimeout || row.Latency.Valid {
+		t.Errorf("got %+v, wanted a timeout without latency", row)
+	}
+
+	row = controlLogRow(bi, ferroamp.ControlResult{}, errors.New("not connected"), now)
+	if row.Status != database.ControlStatusFailed || row.Message != "not connected" || row.Latency.Valid {
+		t.Errorf("got %+v, wanted a failure with the error", row)
+	}
+}
+
+func TestControlSummary(t *testing.T) {
+	dh := hours.DateHour{Date: "2026-10-18", Hour: 10}
+	at := func(minutes int) time.Time {
+		return time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC).Add(time.Duration(minutes) * time.Minute)
+	}
+	entry := func(minutes int, reason string, status string) database.ControlLogRow {
+		return database.ControlLogRow{Timestamp: at(minutes), Reason: reason, Status: status}
+	}
+
+	tests := []struct {
+		name     string
+		entries  []database.ControlLogRow
+		commands int
+		followed float64
+	}{
+		{"nothing sent", nil, 0, 0},
+		{"in effect all hour", []database.ControlLogRow{entry(-30, ReasonPlan, "ack")}, 0, 60},
+		{"holding the reserve", []database.ControlLogRow{entry(-30, ReasonPlan, "ack"), entry(20, ReasonReserve, "ack")}, 1, 20},
+		{"nak", []database.ControlLogRow{entry(-30, ReasonPlan, "ack"), entry(15, ReasonPlan, "nak"), entry(45, ReasonPlan, "ack")}, 2, 30},
+		{"timeout", []database.ControlLogRow{entry(10, ReasonPlan, ferroamp.StatusTimeout)}, 1, 0},
+		{"fallback", []database.ControlLogRow{entry(0, ReasonFallback, "ack"), entry(30, ReasonPlan, "ack")}, 2, 30},
+	}
+	for _, tt := range tests {
+		commands, followed := controlSummary(tt.entries, dh)
+		if commands != tt.commands || math.Abs(followed-tt.followed) > 1e-9 {
+			t.Errorf("%s: got %d commands and %.1f minutes followed, wanted %d and %.1f", tt.name, commands, followed, tt.commands, tt.followed)
+		}
+	}
+}
+
+func TestPlanAdherence(t *testing.T) {
+	spec := config.AppConfigBatterySpec{MaxChargeRate: 6, MaxDischargeRate: 6}
+	dh := hours.DateHour{Date: "2026-10-18", Hour: 10}
+	at := func(minutes int) time.Time {
+		return time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC).Add(time.Duration(minutes) * time.Minute)
+	}
+	entry := func(minutes int, action string, power float64, reason string, status string, limit string) database.ControlLogRow {
+		return database.ControlLogRow{Timestamp: at(minutes), Action: action, Power: power, Reason: reason, Status: status, Limit: limit}
+	}
+	charge := database.PlanningRow{Strategy: "charge", BatteryLevelTo: sql.NullFloat64{Float64: 80, Valid: true}}
+	auto := database.PlanningRow{Strategy: "default", BatteryLevelTo: sql.NullFloat64{Float64: 50, Valid: true}}
+
+	tests := []struct {
+		name      string
+		planning  database.PlanningRow
+		entries   []database.ControlLogRow
+		netLoad   float64
+		level     float64
+		commanded float64
+		minutes   [3]float64 // Auto, charge and discharge
+		causes    string
+	}{
+		{"followed", charge, []database.ControlLogRow{entry(-5, ActionCharge, 5, ReasonPlan, "ack", "")}, -4.8, 79, -5, [3]float64{0, 60, 0}, ""},
+		{"grid fuse", charge, []database.ControlLogRow{
+			entry(-5, ActionCharge, 5, ReasonPlan, "ack", ""),
+			entry(30, ActionCharge, 2, ReasonPlan, "ack", LimitGridFuse)}, -3.5, 72, -3.5, [3]float64{0, 60, 0}, "grid fuse, target missed"},
+		{"nak", charge, []database.ControlLogRow{
+			entry(-5, ActionAuto, 0, ReasonPlan, "ack", ""),
+			entry(0, ActionCharge, 5, ReasonPlan, "nak", "")}, 0, 60, -5, [3]float64{0, 60, 0}, "nak, delivered less, target missed"},
+		{"tapering", charge, []database.ControlLogRow{entry(-5, ActionCharge, 5, ReasonPlan, "ack", "")}, -3, 78, -5, [3]float64{0, 60, 0}, "delivered less"},
+		{"over max rate", database.PlanningRow{Strategy: "discharge"}, []database.ControlLogRow{entry(-5, ActionDischarge, 9, ReasonPlan, "ack", "")}, 5.9, 20, 6, [3]float64{0, 0, 60}, ""},
+		{"preserve", database.PlanningRow{Strategy: "preserve"}, []database.ControlLogRow{entry(-5, ActionCharge, 0, ReasonPlan, "ack", "")}, 0.5, 50, 0, [3]float64{0, 60, 0}, "delivered more"},
+		{"auto misses target", auto, []database.ControlLogRow{entry(-5, ActionAuto, 0, ReasonPlan, "ack", "")}, 2, 30, 0, [3]float64{60, 0, 0}, ""},
+		{"reserve then auto", auto, []database.ControlLogRow{
+			entry(-5, ActionCharge, 1, ReasonReserve, "ack", ""),
+			entry(15, ActionAuto, 0, ReasonPlan, "ack", "")}, 0, 50, -0.25, [3]float64{45, 15, 0}, "reserve"},
+		{"fallback", database.PlanningRow{}, []database.ControlLogRow{entry(10, ActionAuto, 0, ReasonFallback, ferroamp.StatusTimeout, "")}, 0, 50, 0, [3]float64{50, 0, 0}, "fallback, timeout"},
+		{"nothing sent", auto, nil, 1, 45, 0, [3]float64{0, 0, 0}, ""},
+	}
+	for _, tt := range tests {
+		row := planAdherence(spec, tt.planning, tt.entries, dh, tt.netLoad, tt.level)
+		minutes := [3]float64{row.AutoMinutes, row.ChargeMinutes, row.DischargeMinutes}
+		if math.Abs(row.Commanded-tt.commanded) > 1e-9 || minutes != tt.minutes || row.Causes != tt.causes {
+			t.Errorf("%s: got %.2f kWh commanded, %v minutes and causes %q, wanted %.2f, %v and %q",
+				tt.name, row.Commanded, minutes, row.Causes, tt.commanded, tt.minutes, tt.causes)
+		}
+		if row.Diverged() != (tt.causes != "") || row.Actual != tt.netLoad || row.Level != tt.level || row.LevelTarget != tt.planning.BatteryLevelTo {
+			t.Errorf("%s: got %+v, wanted the measured and planned values", tt.name, row)
+		}
+	}
+}
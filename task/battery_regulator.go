@@ -4,16 +4,39 @@ import (
 	"context"
 	"log/slog"
 	"math"
+	"sync/atomic"
 	"time"
 
 	"github.com/icodeforyou/solarplant-go/optimize"
 
 	"github.com/icodeforyou/solarplant-go/config"
 	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/events"
 	"github.com/icodeforyou/solarplant-go/ferroamp"
 	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/reserve"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
 )
 
+// Percentage points above the reserve the battery has to reach before it's left to
+// the planned strategy again, so it doesn't flip between holding and discharging
+const reserveHysteresis = 1.0
+
+// Commanded battery power in kW below which the delivered power tells too little about
+// how the battery tapers to be sampled
+const minSampledPower = 1.0
+
+// Time the battery gets to reach a new commanded power before it's sampled
+const powerSettleTime = 30 * time.Second
+
+// Power in kW the export is kept under the export cap by, the surplus changes between
+// regulations
+const exportCapMargin = 0.2
+
+// Time the export may stay above the export cap before it's reported, the regulation
+// needs a moment to catch up with a sudden surplus
+const exportCapGrace = time.Minute
+
 type BatteryRegulatorStrategy struct {
 	// Time between each battery power update.
 	Interval time.Duration
@@ -24,17 +47,60 @@ type BatteryRegulatorStrategy struct {
 
 	// Maximum power from/to the grid in kW
 	GridMaxPower float64
+
+	// Maximum power exported to the grid in kW, no limit if not valid.
+	// The battery is charged with the surplus above it.
+	ExportCap maybe.Maybe[float64]
+
+	// Difference in percentage points between the actual and the
+	// planned battery level that triggers a replan, 0 disables.
+	SocDeviation float64
+
+	// Difference in kWh between the actual and the forecasted
+	// consumption that triggers a replan, 0 disables.
+	ConsumptionDeviation float64
+
+	// Minimum time between replans triggered by deviations.
+	ReplanMinInterval time.Duration
+
+	// Age of the planning for the current hour after which it's
+	// not followed and the fallback strategy is used, 0 disables.
+	MaxPlanAge time.Duration
 }
 
 type BatteryRegulator struct {
 	logger                *slog.Logger
 	db                    *database.Database
 	spec                  config.AppConfigBatterySpec
+	reserve               reserve.Policy
+	holdingReserve        bool // The battery is at the reserve and only charged from surplus
+	derating              optimize.Derating
 	faData                *ferroamp.FaInMemData
 	strategy              BatteryRegulatorStrategy
 	usingFallbackStrategy bool
+	unhealthyData         bool // Keeping state to avoid spamming logs
 	lastInstruction       BatteryInstruction
+	instructedAt          time.Time // When the last instruction was sent
+	failingPowerSample    bool      // Keeping state to avoid spamming logs
 	C                     chan BatteryInstruction
+	bus                   *events.Bus
+	deviation             deviationState
+	exportCap             exportCapState
+	resend                atomic.Bool // Send the next instruction even if it's the same as the last
+}
+
+// Where the consumption is measured from when looking for plan deviations
+type deviationState struct {
+	hour       hours.DateHour
+	since      time.Time
+	sinceData  *ferroamp.FaData
+	lastReplan time.Time
+}
+
+// When the export went above the export cap and whether it has been reported
+type exportCapState struct {
+	since    time.Time
+	exceeded bool
 }
 
 const (
@@ -45,27 +111,54 @@ const (
 
 type BatteryAction string
 
+// Why an instruction is sent to the battery
+const (
+	ReasonPlan      = "plan"           // Following the planned strategy
+	ReasonReserve   = "reserve"        // Holding the reserve, only the surplus is charged
+	ReasonExportCap = "export cap"     // Charging the surplus above the export cap
+	ReasonFallback  = "fallback"       // No usable planning for the hour
+	ReasonUnhealthy = "unhealthy data" // The ferroamp data is missing
+	ReasonShutdown  = "shutdown"       // Solarplant is stopping
+)
+
+// What lowered the power of an instruction below what the strategy asked for
+const (
+	LimitGridFuse    = "grid fuse"        // Charging would draw more than the grid max power
+	LimitTemperature = "cell temperature" // The battery is derated
+	LimitFull        = "full"             // The battery is at its max level
+	LimitReserve     = "reserve"          // The battery is at its min level or the reserve
+)
+
 type BatteryInstruction struct {
-	Action BatteryAction // charge, discharge, auto
-	Power  float64       // power in kW
+	Action   BatteryAction // charge, discharge, auto
+	Power    float64       // power in kW
+	Strategy string        // Planned strategy for the hour, empty if there's no plan
+	Reason   string        // Why the instruction is sent, see the Reason constants
+	Limit    string        // What lowered the power, see the Limit constants, empty if nothing did
 }
 
 func NewBatteryRegulator(
 	logger *slog.Logger,
 	db *database.Database,
 	bs config.AppConfigBatterySpec,
+	reservePolicy reserve.Policy,
+	derating optimize.Derating,
 	faData *ferroamp.FaInMemData,
-	strategy BatteryRegulatorStrategy) *BatteryRegulator {
+	strategy BatteryRegulatorStrategy,
+	bus *events.Bus) *BatteryRegulator {
 
 	return &BatteryRegulator{
 		logger:                logger,
 		db:                    db,
 		spec:                  bs,
+		reserve:               reservePolicy,
+		derating:              derating,
 		faData:                faData,
 		strategy:              strategy,
 		usingFallbackStrategy: false, // Keeping state to avoid spamming logs
 		lastInstruction:       BatteryInstruction{},
 		C:                     make(chan BatteryInstruction),
+		bus:                   bus,
 	}
 }
 
@@ -88,22 +181,45 @@ func (br *BatteryRegulator) Run(ctx context.Context) {
 	}()
 }
 
+// Sends the last instruction again on the next regulation, e.g. when the connection to
+// the ESO was lost and the broker set it to auto in the meantime
+func (br *BatteryRegulator) Resend() {
+	br.resend.Store(true)
+}
+
 func (br *BatteryRegulator) adjustLoad(ctx context.Context) {
+	if !br.faData.Healthy() {
+		// Nothing to regulate by, the ESO is left to itself until the data is back
+		if !br.unhealthyData {
+			br.unhealthyData = true
+			br.logger.Warn("ferroamp data is unhealthy, setting the battery to auto")
+		}
+		br.sendAuto(ReasonUnhealthy)
+		return
+	}
+	if br.unhealthyData {
+		br.unhealthyData = false
+		br.logger.Info("ferroamp data is healthy again, regulating the battery")
+	}
+
 	gridPwr := br.faData.GridPower()
 	battLvl := br.faData.BatteryLevel()
 	battPwr := br.faData.BatteryPower()
 	battStatus := br.faData.BatteryStatuses()
+	br.samplePower(ctx, battLvl, battPwr)
 
 	hour := hours.FromNow()
 	planning, err := br.db.GetPlanning(ctx, hour)
-	if err != nil {
+	reason := ReasonPlan
+	if problem := planningProblem(planning, err, br.strategy.MaxPlanAge, time.Now()); problem != "" {
+		reason = ReasonFallback
 		planning = database.PlanningRow{
 			When:     hour,
 			Strategy: optimize.StrategyDefault.String(),
 		}
 		if !br.usingFallbackStrategy {
 			br.usingFallbackStrategy = true
-			br.logger.Warn("failed to get planning for hour, using a fallback strategy",
+			br.logger.Warn(problem+", using a fallback strategy",
 				slog.String("hour", hour.String()),
 				slog.String("strategy", planning.Strategy),
 				slog.Any("error", err))
@@ -115,21 +231,57 @@ func (br *BatteryRegulator) adjustLoad(ctx context.Context) {
 				slog.String("hour", hour.String()),
 				slog.String("strategy", planning.Strategy))
 		}
+		br.checkPlanDeviation(ctx, planning, battLvl)
 	}
 
+	reserveLvl := currentReserve(br.spec, planning, br.reserve.Scheduled(time.Now()))
+	holding := holdReserve(battLvl, reserveLvl, br.spec.MinLevel, br.holdingReserve)
+	if holding != br.holdingReserve {
+		br.holdingReserve = holding
+		br.logger.Info("battery reserve", slog.Bool("holding", holding), slog.Float64("battLvl", battLvl), slog.Float64("reserve", reserveLvl))
+	}
+
+	if br.strategy.ExportCap.IsValid() {
+		br.checkExportCap(gridPwr, battLvl)
+	}
+
+	cellTemp, cellTempKnown := br.faData.BatteryTemperature()
+	limit := ""
+
 	sendAction := func(action BatteryAction, power float64) {
-		bi := BatteryInstruction{Action: action, Power: power}
+		bi := BatteryInstruction{Action: action, Power: power, Strategy: planning.Strategy, Reason: reason, Limit: limit}
+		if reason == ReasonFallback {
+			bi.Strategy = ""
+		}
+		if br.strategy.ExportCap.IsValid() {
+			bi = capExport(bi, -(gridPwr + battPwr), br.strategy.ExportCap.Value(), br.spec.MaxChargeRate)
+		}
+		derated := false
+		if br.derating.Enabled() && cellTempKnown {
+			bi, derated = derateInstruction(br.derating, bi, cellTemp)
+		}
+		if derated {
+			bi.Limit = LimitTemperature
+		}
 		diff := math.Abs(bi.Power - br.lastInstruction.Power)
-		if bi.Action == br.lastInstruction.Action && diff < br.strategy.UpdateThreshold {
+		if bi.Action == br.lastInstruction.Action && bi.Reason == br.lastInstruction.Reason && diff < br.strategy.UpdateThreshold && !br.resend.Swap(false) {
 			return
 		}
 		// Fully charged, stop charging
-		if bi.Action == ActionCharge && battLvl >= br.spec.MaxLevel {
-			bi.Power = 0
+		if bi.Action == ActionCharge && battLvl >= br.spec.MaxLevel && bi.Power > 0 {
+			bi.Power, bi.Limit = 0, LimitFull
+		}
+		// Fully discharged or at the reserve, stop discharging
+		if bi.Action == ActionDischarge && battLvl <= reserveLvl && bi.Power > 0 {
+			bi.Power, bi.Limit = 0, LimitReserve
 		}
-		// Fully discharged, stop discharging
-		if bi.Action == ActionDischarge && battLvl <= br.spec.MinLevel {
-			bi.Power = 0
+
+		if derated {
+			br.logger.Info("battery power limited by cell temperature",
+				slog.String("action", string(action)),
+				slog.Float64("requested", power),
+				slog.Float64("power", bi.Power),
+				slog.Float64("temperature", cellTemp))
 		}
 
 		br.logger.Debug("new battery regulation instruction",
@@ -141,11 +293,20 @@ func (br *BatteryRegulator) adjustLoad(ctx context.Context) {
 			slog.Any("instruction", bi))
 
 		br.lastInstruction = bi
+		br.instructedAt = time.Now()
+		br.resend.Store(false)
 		br.C <- bi
 	}
 
 	switch planning.Strategy {
 	case optimize.StrategyDefault.String():
+		if holding {
+			// Auto would discharge below the reserve, so only a solar surplus is charged
+			reason = ReasonReserve
+			surplus := max(-(gridPwr + battPwr), 0)
+			sendAction(ActionCharge, math.Min(surplus, br.spec.MaxChargeRate))
+			return
+		}
 		sendAction(ActionAuto, 0)
 
 	case optimize.StrategyPreserve.String():
@@ -155,6 +316,9 @@ func (br *BatteryRegulator) adjustLoad(ctx context.Context) {
 	case optimize.StrategyCharge.String():
 		freePwr := br.strategy.GridMaxPower - gridPwr - 1 // 1 kW safety zone
 		newBattPwr := math.Min(br.spec.MaxChargeRate, freePwr)
+		if newBattPwr < br.spec.MaxChargeRate {
+			limit = LimitGridFuse
+		}
 		sendAction(ActionCharge, newBattPwr)
 
 	case optimize.StrategyDischarge.String():
@@ -162,7 +326,252 @@ func (br *BatteryRegulator) adjustLoad(ctx context.Context) {
 		newBattPwr := math.Max(br.spec.MaxDischargeRate, freePwr)
 		sendAction(ActionDischarge, newBattPwr)
 
+	case optimize.StrategyCurtail.String():
+		// Exporting costs money. It can't be limited through the external API, so the
+		// battery takes as much of the solar surplus as it can.
+		surplus := max(-(gridPwr + battPwr), 0)
+		sendAction(ActionCharge, math.Min(surplus, br.spec.MaxChargeRate))
+
 	default:
 		br.logger.Error("unknown strategy", slog.Any("strategy", planning.Strategy))
 	}
 }
+
+// Why the planning for the hour can't be followed, empty if it can. A stale planning
+// means the planner has stopped, e.g. since prices or forecasts are missing.
+func planningProblem(planning database.PlanningRow, err error, maxAge time.Duration, now time.Time) string {
+	if err != nil {
+		return "failed to get planning for hour"
+	}
+	if maxAge > 0 && now.Sub(planning.Updated) > maxAge {
+		return "planning for hour is stale"
+	}
+	return ""
+}
+
+// Leaves the battery to the ESO's own control, unless it already has it for the same reason
+func (br *BatteryRegulator) sendAuto(reason string) {
+	if br.lastInstruction.Action == ActionAuto && br.lastInstruction.Reason == reason && !br.resend.Swap(false) {
+		return
+	}
+	br.lastInstruction = BatteryInstruction{Action: ActionAuto, Reason: reason}
+	br.instructedAt = time.Now()
+	br.C <- br.lastInstruction
+}
+
+// Changes an instruction so that no more than the export cap in kW is exported, given the
+// surplus in kW before the battery. The battery is charged with the surplus above the cap,
+// and discharged no more than the cap allows. Auto is left as is since the battery then
+// takes the surplus anyway.
+func capExport(bi BatteryInstruction, surplus float64, exportCap float64, maxChargeRate float64) BatteryInstruction {
+	capped := bi
+	excess := surplus - (exportCap - exportCapMargin)
+	switch bi.Action {
+	case ActionCharge:
+		capped.Power = max(bi.Power, min(excess, maxChargeRate))
+	case ActionDischarge:
+		if excess >= 0 {
+			capped.Action, capped.Power = ActionCharge, min(excess, maxChargeRate)
+		} else {
+			capped.Power = min(bi.Power, -excess)
+		}
+	}
+	if capped.Action != bi.Action || capped.Power != bi.Power {
+		capped.Reason, capped.Limit = ReasonExportCap, ""
+	}
+	return capped
+}
+
+// Reports when the export has stayed above the export cap, i.e. the battery can't take
+// the surplus because it's full or charging at its maximum
+func (br *BatteryRegulator) checkExportCap(gridPwr float64, battLvl float64) {
+	exportCap := br.strategy.ExportCap.Value()
+	exceeded, changed := br.exportCap.update(-gridPwr, exportCap, time.Now())
+	if !changed {
+		return
+	}
+	if exceeded {
+		br.logger.Warn("grid export above the cap, the battery can't take the surplus",
+			slog.Float64("exported", -gridPwr),
+			slog.Float64("cap", exportCap),
+			slog.Float64("battLvl", battLvl))
+		return
+	}
+	br.logger.Info("grid export back under the cap", slog.Float64("exported", -gridPwr), slog.Float64("cap", exportCap))
+}
+
+// Tracks the export in kW against the cap. Returns whether the export has been above the
+// cap for longer than the grace time, and whether that changed since the last update.
+func (s *exportCapState) update(exported float64, exportCap float64, now time.Time) (bool, bool) {
+	if exported <= exportCap {
+		changed := s.exceeded
+		*s = exportCapState{}
+		return false, changed
+	}
+	if s.since.IsZero() {
+		s.since = now
+	}
+	if s.exceeded || now.Sub(s.since) < exportCapGrace {
+		return s.exceeded, false
+	}
+	s.exceeded = true
+	return true, true
+}
+
+// Limits the power of a charge or discharge instruction to what the battery takes at the
+// cell temperature, it would otherwise quietly deliver less than commanded. Returns true
+// if the power was lowered.
+func derateInstruction(derating optimize.Derating, bi BatteryInstruction, temperature float64) (BatteryInstruction, bool) {
+	charge, discharge := derating.Rates(temperature)
+	limit := math.Inf(1)
+	switch bi.Action {
+	case ActionCharge:
+		limit = charge
+	case ActionDischarge:
+		limit = discharge
+	}
+	if bi.Power <= limit {
+		return bi, false
+	}
+	bi.Power = limit
+	return bi, true
+}
+
+// Records how much of the commanded power the battery delivers at its level, the planner
+// learns how the power tapers near full and empty from it
+func (br *BatteryRegulator) samplePower(ctx context.Context, battLvl float64, battPwr float64) {
+	if !br.faData.Healthy() {
+		return
+	}
+	row, ok := powerSample(br.spec, br.lastInstruction, br.instructedAt, battLvl, battPwr, time.Now())
+	if !ok {
+		return
+	}
+	if err := br.db.AddBatteryPowerSample(ctx, row); err != nil {
+		if !br.failingPowerSample {
+			br.failingPowerSample = true
+			br.logger.Error("failed to save battery power sample", slog.Any("error", err))
+		}
+		return
+	}
+	br.failingPowerSample = false
+}
+
+// The power delivered by the battery for a charge or discharge instruction that has had
+// time to settle, false if there's nothing to sample. The commanded power is capped by
+// the battery's maximum since more than it can be commanded when discharging.
+func powerSample(
+	spec config.AppConfigBatterySpec,
+	bi BatteryInstruction,
+	instructedAt time.Time,
+	battLvl float64,
+	battPwr float64,
+	now time.Time) (database.BatteryPowerSampleRow, bool) {
+
+	if bi.Power < minSampledPower || now.Sub(instructedAt) < powerSettleTime {
+		return database.BatteryPowerSampleRow{}, false
+	}
+	row := database.BatteryPowerSampleRow{Level: optimize.TaperRange(battLvl)}
+	switch bi.Action {
+	case ActionCharge:
+		// Battery power is negative when charging
+		row.Charging = true
+		row.Commanded = min(bi.Power, spec.MaxChargeRate)
+		row.Delivered = max(-battPwr, 0)
+	case ActionDischarge:
+		row.Commanded = min(bi.Power, spec.MaxDischargeRate)
+		row.Delivered = max(battPwr, 0)
+	default:
+		return database.BatteryPowerSampleRow{}, false
+	}
+	return row, true
+}
+
+// The battery level to keep now. The planned reserve includes bad weather, and the
+// schedule is checked as well in case there's no plan for the hour.
+func currentReserve(spec config.AppConfigBatterySpec, planning database.PlanningRow, scheduled float64) float64 {
+	level := max(spec.MinLevel, scheduled)
+	if planning.Reserve.Valid {
+		level = max(level, planning.Reserve.Float64)
+	}
+	return level
+}
+
+// Whether the battery should be held at the reserve instead of following the strategy.
+// The battery manages its own minimum level, so it's only held above it.
+func holdReserve(battLvl float64, reserveLvl float64, minLvl float64, holding bool) bool {
+	if reserveLvl <= minLvl {
+		return false
+	}
+	if holding {
+		return battLvl < reserveLvl+reserveHysteresis
+	}
+	return battLvl <= reserveLvl
+}
+
+// Requests a replan when the battery level or the consumption is far from what the
+// plan for the hour expected, e.g. when the sauna is on.
+func (br *BatteryRegulator) checkPlanDeviation(ctx context.Context, planning database.PlanningRow, battLvl float64) {
+	now := time.Now()
+	if br.deviation.hour != planning.When || br.deviation.sinceData == nil {
+		br.deviation.hour = planning.When
+		br.deviation.since = now
+		br.deviation.sinceData = br.faData.CurrentState()
+		return
+	}
+
+	if now.Sub(br.deviation.lastReplan) < br.strategy.ReplanMinInterval {
+		return
+	}
+
+	attrs := []any{slog.String("hour", planning.When.String()), slog.String("strategy", planning.Strategy)}
+	deviated := false
+
+	if br.strategy.SocDeviation > 0 && planning.BatteryLevelFrom.Valid && planning.BatteryLevelTo.Valid {
+		expected := expectedBatteryLevel(planning, now)
+		attrs = append(attrs, slog.Float64("battLvl", battLvl), slog.Float64("expectedBattLvl", expected))
+		if math.Abs(battLvl-expected) > br.strategy.SocDeviation {
+			deviated = true
+		}
+	}
+
+	if br.strategy.ConsumptionDeviation > 0 {
+		ef, err := br.db.GetEnergyForecast(ctx, planning.When)
+		if err == nil {
+			consumed := br.faData.ConsumedSince(*br.deviation.sinceData)
+			expected := ef.Consumption * now.Sub(br.deviation.since).Hours()
+			attrs = append(attrs, slog.Float64("consumed", consumed), slog.Float64("expectedConsumed", expected))
+			if math.Abs(consumed-expected) > br.strategy.ConsumptionDeviation {
+				deviated = true
+			}
+		}
+	}
+
+	if !deviated {
+		return
+	}
+
+	br.logger.Info("plan deviation, requesting replan", attrs...)
+	br.deviation.lastReplan = now
+	br.deviation.since = now
+	br.deviation.sinceData = br.faData.CurrentState()
+	br.bus.Publish(events.PlanDeviated)
+}
+
+// Interpolates the planned battery level from when the plan for the hour
+// started, i.e. the start of the hour or an intra-hour replan, to the end of the hour
+func expectedBatteryLevel(planning database.PlanningRow, now time.Time) float64 {
+	start := hours.FromIso(planning.When.IsoString())
+	end := start.Add(time.Hour)
+	if planning.Updated.After(start) && planning.Updated.Before(end) {
+		start = planning.Updated
+	}
+
+	frac := 1.0
+	if end.After(start) {
+		frac = min(max(now.Sub(start).Seconds()/end.Sub(start).Seconds(), 0), 1)
+	}
+
+	from, to := planning.BatteryLevelFrom.Float64, planning.BatteryLevelTo.Float64
+	return from + (to-from)*frac
+}
@@ -0,0 +1,221 @@
+package task
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/optimize"
+)
+
+func TestExpectedBatteryLevel(t *testing.T) {
+	start := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	planning := database.PlanningRow{
+		When:             hours.FromTime(start),
+		BatteryLevelFrom: sql.NullFloat64{Float64: 20, Valid: true},
+		BatteryLevelTo:   sql.NullFloat64{Float64: 60, Valid: true},
+		Updated:          start.Add(-time.Minute), // Planned before the hour started
+	}
+
+	tests := []struct {
+		now  time.Time
+		want float64
+	}{
+		{start, 20},
+		{start.Add(15 * time.Minute), 30},
+		{start.Add(time.Hour), 60},
+		{start.Add(2 * time.Hour), 60},
+	}
+	for _, tt := range tests {
+		if got := expectedBatteryLevel(planning, tt.now); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("at %s: got %f, wanted %f", tt.now.Format(time.TimeOnly), got, tt.want)
+		}
+	}
+
+	// Replanned half way through the hour
+	planning.Updated = start.Add(30 * time.Minute)
+	if got := expectedBatteryLevel(planning, start.Add(45*time.Minute)); math.Abs(got-40) > 1e-9 {
+		t.Errorf("got %f after replan, wanted 40", got)
+	}
+}
+
+func TestCurrentReserve(t *testing.T) {
+	spec := config.AppConfigBatterySpec{MinLevel: 10}
+	planning := database.PlanningRow{Reserve: sql.NullFloat64{Float64: 60, Valid: true}}
+
+	if got := currentReserve(spec, database.PlanningRow{}, 0); got != 10 {
+		t.Errorf("got %.0f without a reserve, wanted the minimum level 10", got)
+	}
+	if got := currentReserve(spec, planning, 40); got != 60 {
+		t.Errorf("got %.0f with a planned reserve, wanted 60", got)
+	}
+	if got := currentReserve(spec, database.PlanningRow{}, 40); got != 40 {
+		t.Errorf("got %.0f without a plan, wanted the scheduled 40", got)
+	}
+}
+
+func TestHoldReserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		battLvl float64
+		reserve float64
+		holding bool
+		want    bool
+	}{
+		{"above the reserve", 45, 40, false, false},
+		{"at the reserve", 40, 40, false, true},
+		{"charged a little from surplus", 40.5, 40, true, true},
+		{"charged above the hysteresis", 41, 40, true, false},
+		{"only the minimum level", 10, 10, false, false},
+	}
+	for _, tt := range tests {
+		if got := holdReserve(tt.battLvl, tt.reserve, 10, tt.holding); got != tt.want {
+			t.Errorf("%s: got %t, wanted %t", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDerateInstruction(t *testing.T) {
+	one := 1.0
+	derating, err := optimize.NewDerating(config.AppConfigBatterySpec{
+		MaxChargeRate:    7,
+		MaxDischargeRate: 7,
+		Derating:         []config.AppConfigDeratingPoint{{Temperature: 0, MaxChargeRate: &one}, {Temperature: 10}},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		bi          BatteryInstruction
+		temperature float64
+		want        float64
+		derated     bool
+	}{
+		{"cold charge", BatteryInstruction{Action: ActionCharge, Power: 7}, -5, 1, true},
+		{"cool charge", BatteryInstruction{Action: ActionCharge, Power: 7}, 5, 4, true},
+		{"slow charge", BatteryInstruction{Action: ActionCharge, Power: 0.5}, -5, 0.5, false},
+		{"cold discharge", BatteryInstruction{Action: ActionDischarge, Power: 7}, -5, 7, false},
+		{"auto", BatteryInstruction{Action: ActionAuto}, -5, 0, false},
+	}
+	for _, tt := range tests {
+		bi, derated := derateInstruction(derating, tt.bi, tt.temperature)
+		if bi.Power != tt.want || derated != tt.derated {
+			t.Errorf("%s: got %.1f kW (derated %t), wanted %.1f kW (derated %t)", tt.name, bi.Power, derated, tt.want, tt.derated)
+		}
+	}
+}
+
+func TestPowerSample(t *testing.T) {
+	spec := config.AppConfigBatterySpec{MaxChargeRate: 7, MaxDischargeRate: 7}
+	now := time.Now()
+	settled := now.Add(-time.Minute)
+
+	tests := []struct {
+		name         string
+		bi           BatteryInstruction
+		instructedAt time.Time
+		battLvl      float64
+		battPwr      float64
+		want         database.BatteryPowerSampleRow
+		ok           bool
+	}{
+		{"tapering charge", BatteryInstruction{Action: ActionCharge, Power: 7}, settled, 93, -2.5,
+			database.BatteryPowerSampleRow{Level: 90, Charging: true, Commanded: 7, Delivered: 2.5}, true},
+		{"full", BatteryInstruction{Action: ActionCharge, Power: 7}, settled, 100, -0.5,
+			database.BatteryPowerSampleRow{Level: 95, Charging: true, Commanded: 7, Delivered: 0.5}, true},
+		{"discharge above max", BatteryInstruction{Action: ActionDischarge, Power: 9}, settled, 12, 7,
+			database.BatteryPowerSampleRow{Level: 10, Commanded: 7, Delivered: 7}, true},
+		{"not settled", BatteryInstruction{Action: ActionCharge, Power: 7}, now.Add(-10 * time.Second), 50, -1, database.BatteryPowerSampleRow{}, false},
+		{"slow charge", BatteryInstruction{Action: ActionCharge, Power: 0.5}, settled, 50, -0.5, database.BatteryPowerSampleRow{}, false},
+		{"auto", BatteryInstruction{Action: ActionAuto}, settled, 50, 3, database.BatteryPowerSampleRow{}, false},
+	}
+	for _, tt := range tests {
+		row, ok := powerSample(spec, tt.bi, tt.instructedAt, tt.battLvl, tt.battPwr, now)
+		if row != tt.want || ok != tt.ok {
+			t.Errorf("%s: got %+v (%t), wanted %+v (%t)", tt.name, row, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCapExport(t *testing.T) {
+	plan := func(action BatteryAction, power float64) BatteryInstruction {
+		return BatteryInstruction{Action: action, Power: power, Reason: ReasonPlan}
+	}
+	capped := func(action BatteryAction, power float64) BatteryInstruction {
+		return BatteryInstruction{Action: action, Power: power, Reason: ReasonExportCap}
+	}
+	tests := []struct {
+		name    string
+		bi      BatteryInstruction
+		surplus float64
+		want    BatteryInstruction
+	}{
+		{"charging more than the excess", plan(ActionCharge, 4), 5, plan(ActionCharge, 4)},
+		{"preserve above the cap", plan(ActionCharge, 0), 5, capped(ActionCharge, 3.2)},
+		{"preserve above the maximum", plan(ActionCharge, 0), 12, capped(ActionCharge, 7)},
+		{"discharge within the cap", plan(ActionDischarge, 7), -3, capped(ActionDischarge, 4.8)},
+		{"discharge with a surplus", plan(ActionDischarge, 7), 4, capped(ActionCharge, 2.2)},
+		{"auto", plan(ActionAuto, 0), 12, plan(ActionAuto, 0)},
+		{"fuse limited charge", BatteryInstruction{Action: ActionCharge, Power: 1, Reason: ReasonPlan, Limit: LimitGridFuse}, 5, capped(ActionCharge, 3.2)},
+	}
+	for _, tt := range tests {
+		got := capExport(tt.bi, tt.surplus, 2, 7)
+		if got.Action != tt.want.Action || math.Abs(got.Power-tt.want.Power) > 1e-9 || got.Reason != tt.want.Reason || got.Limit != tt.want.Limit {
+			t.Errorf("%s: got %+v, wanted %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestExportCapState(t *testing.T) {
+	now := time.Now()
+	var s exportCapState
+
+	steps := []struct {
+		exported float64
+		after    time.Duration
+		exceeded bool
+		changed  bool
+	}{
+		{1, 0, false, false},
+		{3, 10 * time.Second, false, false},
+		{3, 40 * time.Second, false, false},
+		{3, 80 * time.Second, true, true},
+		{3, 90 * time.Second, true, false},
+		{2, 100 * time.Second, false, true},
+		{3, 110 * time.Second, false, false},
+	}
+	for i, st := range steps {
+		exceeded, changed := s.update(st.exported, 2, now.Add(st.after))
+		if exceeded != st.exceeded || changed != st.changed {
+			t.Errorf("step %d: got exceeded %t (changed %t), wanted %t (changed %t)", i, exceeded, changed, st.exceeded, st.changed)
+		}
+	}
+}
+
+func TestPlanningProblem(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		updated time.Time
+		err     error
+		maxAge  time.Duration
+		problem bool
+	}{
+		{"fresh", now.Add(-time.Hour), nil, 3 * time.Hour, false},
+		{"stale", now.Add(-4 * time.Hour), nil, 3 * time.Hour, true},
+		{"stale but disabled", now.Add(-4 * time.Hour), nil, 0, false},
+		{"missing", time.Time{}, sql.ErrNoRows, 3 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		got := planningProblem(database.PlanningRow{Updated: tt.updated}, tt.err, tt.maxAge, now)
+		if (got != "") != tt.problem {
+			t.Errorf("%s: got problem %q, wanted a problem %t", tt.name, got, tt.problem)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/degradation"
+	"github.com/icodeforyou/solarplant-go/ferroamp"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+// Change in battery level in percentage needed to estimate the capacity from, the level
+// is only reported in whole percent
+const minCapacityDepth = 30.0
+
+// Tracks how much the battery is cycled from its energy counters and level, and
+// estimates how much it wears from the depth, power and cell temperature. Also
+// records the health of the modules daily and estimates the usable capacity.
+type BatteryWearTracker struct {
+	logger     *slog.Logger
+	db         *database.Database
+	faData     *ferroamp.FaInMemData
+	model      degradation.Model
+	interval   time.Duration
+	cycle      degradation.Cycle
+	last       *wearSample
+	segment    capacitySegment
+	healthDate string // Date the module health was last saved
+	failing    bool   // Keeping state to avoid spamming logs
+}
+
+type wearSample struct {
+	at         time.Time
+	charged    float64 // Lifetime energy charged in kWh
+	discharged float64 // Lifetime energy discharged in kWh
+}
+
+// Energy charged or discharged since the battery level last changed direction
+type capacitySegment struct {
+	start  float64 // Battery level in percentage
+	energy float64 // Net energy charged in kWh, negative when discharging
+}
+
+func NewBatteryWearTracker(
+	logger *slog.Logger,
+	db *database.Database,
+	faData *ferroamp.FaInMemData,
+	spec config.AppConfigBatterySpec,
+	interval time.Duration) *BatteryWearTracker {
+
+	return &BatteryWearTracker{
+		logger:   logger,
+		db:       db,
+		faData:   faData,
+		model:    degradation.New(spec),
+		interval: interval,
+	}
+}
+
+func (t *BatteryWearTracker) Run(ctx context.Context) {
+	t.logger.Debug("starting battery wear tracker", slog.Any("interval", t.interval))
+
+	go func() {
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				t.track(ctx)
+			}
+		}
+	}()
+}
+
+func (t *BatteryWearTracker) track(ctx context.Context) {
+	if !t.faData.Healthy() {
+		return
+	}
+
+	now := time.Now()
+	if date := hours.FromTime(now).Date; date != t.healthDate {
+		t.saveHealth(ctx, date)
+	}
+
+	level := t.faData.BatteryLevel()
+	sample := wearSample{
+		at:         now,
+		charged:    t.faData.BatteryChargedLifetime(),
+		discharged: t.faData.BatteryDischargedLifetime(),
+	}
+	if sample.charged == 0 && sample.discharged == 0 {
+		return // Counters not reported yet
+	}
+
+	if t.last == nil {
+		t.last = &sample
+		t.resumeCycle(ctx, level)
+		t.segment = capacitySegment{start: level}
+		return
+	}
+
+	charged := sample.charged - t.last.charged
+	discharged := sample.discharged - t.last.discharged
+	elapsed := now.Sub(t.last.at).Hours()
+	t.last = &sample
+	if charged < 0 || discharged < 0 || elapsed <= 0 {
+		t.logger.Warn("battery energy counters went backwards, skipping sample")
+		return
+	}
+
+	temperature := sql.NullFloat64{}
+	cellTemperature := degradation.ReferenceTemperature
+	if temp, ok := t.faData.BatteryTemperature(); ok {
+		temperature = sql.NullFloat64{Float64: temp, Valid: true}
+		cellTemperature = temp
+	}
+	prevLevel, wasCharging := t.cycle.Level, t.cycle.Charging
+	from, to := t.cycle.Step(level)
+	if t.cycle.Charging != wasCharging {
+		t.estimateCapacity(ctx, prevLevel, now)
+		t.segment = capacitySegment{start: prevLevel}
+	}
+	t.segment.energy += charged - discharged
+	wear := t.model.Wear(from, to, (charged+discharged)/elapsed, cellTemperature, t.cycle.Charging)
+
+	err := t.db.AddBatteryWear(ctx, database.BatteryWearRow{
+		When:          hours.FromTime(now),
+		Charged:       charged,
+		Discharged:    discharged,
+		Wear:          wear,
+		Temperature:   temperature,
+		Cycles:        t.model.EquivalentCycles(sample.charged, sample.discharged),
+		Level:         level,
+		CycleStart:    t.cycle.Start,
+		CycleCharging: t.cycle.Charging,
+	})
+	if err != nil {
+		if !t.failing {
+			t.logger.Error("failed to save battery wear", slog.Any("error", err))
+			t.failing = true
+		}
+		return
+	}
+	t.failing = false
+}
+
+// The capacity in kWh and the energy charged or discharged in kWh that the segment
+// ending at a battery level gives, negative if the energy went the other way
+func (s capacitySegment) capacity(level float64) (float64, float64) {
+	if level == s.start {
+		return 0, 0
+	}
+	energy := s.energy
+	if level < s.start {
+		energy = -energy
+	}
+	return energy / math.Abs(level-s.start) * 100, energy
+}
+
+// Saves the usable capacity estimated from the segment ending at a battery level, if
+// it's deep enough and plausible
+func (t *BatteryWearTracker) estimateCapacity(ctx context.Context, level float64, now time.Time) {
+	depth := math.Abs(level - t.segment.start)
+	if depth < minCapacityDepth {
+		return
+	}
+	charging := level > t.segment.start
+	capacity, energy := t.segment.capacity(level)
+	if capacity < t.model.Capacity/2 || capacity > t.model.Capacity*1.5 {
+		t.logger.Warn("ignoring implausible battery capacity estimate",
+			slog.Float64("capacity", capacity), slog.Float64("depth", depth), slog.Float64("energy", energy))
+		return
+	}
+
+	t.logger.Info("estimated usable battery capacity",
+		slog.Float64("capacity", calc.RoundFloat64(capacity, 2)), slog.Bool("charging", charging), slog.Float64("depth", depth))
+	err := t.db.AddBatteryCapacityEstimate(ctx, database.BatteryCapacityEstimateRow{
+		When:     now,
+		Charging: charging,
+		Depth:    depth,
+		Energy:   energy,
+	})
+	if err != nil {
+		t.logger.Error("failed to save battery capacity estimate", slog.Any("error", err))
+	}
+}
+
+// Saves the state of health and rated capacity reported by the modules
+func (t *BatteryWearTracker) saveHealth(ctx context.Context, date string) {
+	for _, m := range t.faData.BatteryModules() {
+		if m.Soh == 0 && m.RatedCapacity == 0 {
+			continue // Not reported yet
+		}
+		err := t.db.SaveBatteryModuleHealth(ctx, date, database.BatteryModuleHealthRow{
+			Module:        m.ID,
+			Soh:           m.Soh,
+			RatedCapacity: m.RatedCapacity,
+		})
+		if err != nil {
+			t.logger.Error("failed to save battery module health", slog.String("module", m.ID), slog.Any("error", err))
+			return
+		}
+		t.healthDate = date
+	}
+}
+
+// Continues the half cycle from where it was last saved, unless the battery level has
+// changed direction since, e.g. while the application wasn't running
+func (t *BatteryWearTracker) resumeCycle(ctx context.Context, level float64) {
+	t.cycle = degradation.Cycle{}
+	t.cycle.Step(level)
+
+	last, err := t.db.GetLatestBatteryWear(ctx)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		t.logger.Error("failed to get latest battery wear", slog.Any("error", err))
+		return
+	}
+	if cycle, ok := resumedCycle(last, level); ok {
+		t.cycle = cycle
+	}
+}
+
+// The saved half cycle moved to the battery level, false if it would have changed direction
+func resumedCycle(last database.BatteryWearRow, level float64) (degradation.Cycle, bool) {
+	if level != last.Level && (level > last.Level) != last.CycleCharging {
+		return degradation.Cycle{}, false
+	}
+	cycle := degradation.NewCycle(last.CycleStart, last.Level, last.CycleCharging)
+	cycle.Step(level)
+	return cycle, true
+}
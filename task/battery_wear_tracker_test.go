@@ -0,0 +1,51 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/database"
+)
+
+func TestResumedCycle(t *testing.T) {
+	last := database.BatteryWearRow{Level: 60, CycleStart: 90, CycleCharging: false}
+
+	tests := []struct {
+		name  string
+		level float64
+		ok    bool
+		start float64
+	}{
+		{"unchanged", 60, true, 90},
+		{"discharged further", 40, true, 90},
+		{"charged since", 70, false, 0},
+	}
+	for _, tt := range tests {
+		cycle, ok := resumedCycle(last, tt.level)
+		if ok != tt.ok {
+			t.Errorf("%s: got %t, wanted %t", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && (cycle.Start != tt.start || cycle.Level != tt.level || cycle.Charging) {
+			t.Errorf("%s: got %+v, wanted a discharging half cycle from %.0f at %.0f", tt.name, cycle, tt.start, tt.level)
+		}
+	}
+}
+
+func TestCapacitySegment(t *testing.T) {
+	tests := []struct {
+		name     string
+		segment  capacitySegment
+		level    float64
+		capacity float64
+	}{
+		{"charged", capacitySegment{start: 20, energy: 6}, 80, 10},
+		{"discharged", capacitySegment{start: 90, energy: -4.5}, 40, 9},
+		{"counters going the other way", capacitySegment{start: 90, energy: 4.5}, 40, -9},
+		{"no change", capacitySegment{start: 50, energy: 0.1}, 50, 0},
+	}
+	for _, tt := range tests {
+		if got, _ := tt.segment.capacity(tt.level); got != tt.capacity {
+			t.Errorf("%s: got %.2f kWh, wanted %.2f kWh", tt.name, got, tt.capacity)
+		}
+	}
+}
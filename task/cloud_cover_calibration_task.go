@@ -0,0 +1,118 @@
+package task
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+// Number of days before and after an hour that are searched for
+// the highest production, used as the clear sky expectation.
+const clearSkyWindowDays = 7
+
+// Hours with a lower clear sky expectation (kWh) are considered dark and are not used
+const minClearSkyProduction = 0.1
+
+func NewCloudCoverCalibrationTask(logger *slog.Logger, db *database.Database, cnfg config.AppConfigEnergyForecast) func() {
+	return func() {
+		logger.Debug("running cloud cover calibration task...")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+		defer cancel()
+
+		from := hours.FromNow().Sub(24 * cnfg.GetCalibrationDays())
+		rows, err := db.GetTimeSeriesFrom(ctx, from)
+		if err != nil {
+			logger.Error("cloud cover calibration task error", slog.Any("error", err))
+			return
+		}
+
+		samples := cloudCoverSamples(rows)
+		for _, season := range calc.Seasons {
+			s := samples[season]
+			if len(s) == 0 {
+				logger.Debug("no cloud cover samples for season", slog.String("season", season))
+				continue
+			}
+			impact := calc.FitCloudCoverImpact(s)
+			if err := db.SaveCloudCoverImpact(ctx, database.CloudCoverImpactRow{
+				Season:  season,
+				Impact:  impact,
+				Samples: len(s),
+			}); err != nil {
+				logger.Error("cloud cover calibration task error", slog.Any("error", err))
+				return
+			}
+			logger.Info("cloud cover impact calibrated",
+				slog.String("season", season),
+				slog.Float64("impact", calc.RoundFloat64(impact, 4)),
+				slog.Int("samples", len(s)),
+				slog.Bool("used", len(s) >= cnfg.GetCalibrationMinSamples()))
+		}
+
+		logger.Info("cloud cover calibration task done")
+	}
+}
+
+// Pairs every daylight hour with a clear sky expectation, which is the highest
+// production for the same hour of day within a week, grouped by season.
+func cloudCoverSamples(rows []database.TimeSeriesRow) map[string][]calc.CloudCoverSample {
+	type entry struct {
+		date time.Time
+		row  database.TimeSeriesRow
+	}
+
+	byHour := make(map[uint8][]entry)
+	for _, row := range rows {
+		date, err := time.Parse("2006-01-02", row.When.Date)
+		if err != nil {
+			continue
+		}
+		byHour[row.When.Hour] = append(byHour[row.When.Hour], entry{date: date, row: row})
+	}
+
+	window := time.Duration(clearSkyWindowDays) * 24 * time.Hour
+	samples := make(map[string][]calc.CloudCoverSample)
+	for _, entries := range byHour {
+		for _, e := range entries {
+			clearSky := 0.0
+			for _, other := range entries {
+				if d := e.date.Sub(other.date); d <= window && d >= -window {
+					clearSky = max(clearSky, other.row.Production)
+				}
+			}
+			if clearSky < minClearSkyProduction {
+				continue
+			}
+			season := calc.Season(e.date.Month())
+			samples[season] = append(samples[season], calc.CloudCoverSample{
+				Production: e.row.Production,
+				ClearSky:   clearSky,
+				CloudCover: float64(e.row.CloudCover),
+			})
+		}
+	}
+
+	return samples
+}
+
+// Returns the learned cloud cover impact for the season of the given hour, or the
+// configured value if there aren't enough samples to rely on the learned one.
+func cloudCoverImpact(impacts []database.CloudCoverImpactRow, cnfg config.AppConfigEnergyForecast, hour hours.DateHour) float64 {
+	date, err := time.Parse("2006-01-02", hour.Date)
+	if err != nil {
+		return cnfg.CloudCoverImpact
+	}
+	season := calc.Season(date.Month())
+	for _, i := range impacts {
+		if i.Season == season && i.Samples >= cnfg.GetCalibrationMinSamples() {
+			return i.Impact
+		}
+	}
+	return cnfg.CloudCoverImpact
+}
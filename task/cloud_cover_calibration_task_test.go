@@ -0,0 +1,96 @@
+package task
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/hours"
+)
+
+func tsRow(date string, hour uint8, production float64, cloudCover uint8) database.TimeSeriesRow {
+	return database.TimeSeriesRow{When: hours.DateHour{Date: date, Hour: hour}, Production: production, CloudCover: cloudCover}
+}
+
+func TestCloudCoverSamples(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []database.TimeSeriesRow
+		want map[string][]calc.CloudCoverSample
+	}{
+		{
+			"clear sky within a week",
+			[]database.TimeSeriesRow{tsRow("2025-06-01", 12, 4, 0), tsRow("2025-06-08", 12, 2, 8)},
+			map[string][]calc.CloudCoverSample{calc.SeasonSummer: {
+				{Production: 2, ClearSky: 4, CloudCover: 8},
+				{Production: 4, ClearSky: 4, CloudCover: 0},
+			}},
+		},
+		{
+			"clear sky more than a week away",
+			[]database.TimeSeriesRow{tsRow("2025-06-01", 12, 4, 0), tsRow("2025-06-09", 12, 2, 8)},
+			map[string][]calc.CloudCoverSample{calc.SeasonSummer: {
+				{Production: 2, ClearSky: 2, CloudCover: 8},
+				{Production: 4, ClearSky: 4, CloudCover: 0},
+			}},
+		},
+		{
+			"other hours of the day",
+			[]database.TimeSeriesRow{tsRow("2025-06-01", 12, 4, 0), tsRow("2025-06-01", 13, 2, 8)},
+			map[string][]calc.CloudCoverSample{calc.SeasonSummer: {
+				{Production: 2, ClearSky: 2, CloudCover: 8},
+				{Production: 4, ClearSky: 4, CloudCover: 0},
+			}},
+		},
+		{
+			"grouped by season",
+			[]database.TimeSeriesRow{tsRow("2025-05-31", 12, 4, 0), tsRow("2025-06-01", 12, 3, 4)},
+			map[string][]calc.CloudCoverSample{
+				calc.SeasonSpring: {{Production: 4, ClearSky: 4, CloudCover: 0}},
+				calc.SeasonSummer: {{Production: 3, ClearSky: 4, CloudCover: 4}},
+			},
+		},
+		{
+			"dark hours",
+			[]database.TimeSeriesRow{tsRow("2025-12-01", 8, 0.05, 0), tsRow("2025-12-02", 8, 0, 8)},
+			map[string][]calc.CloudCoverSample{},
+		},
+	}
+	for _, tt := range tests {
+		got := cloudCoverSamples(tt.rows)
+		for _, s := range got {
+			slices.SortFunc(s, func(a, b calc.CloudCoverSample) int { return cmp.Compare(a.Production, b.Production) })
+		}
+		if !maps.EqualFunc(got, tt.want, slices.Equal) {
+			t.Errorf("%s: got %v, wanted %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCloudCoverImpact(t *testing.T) {
+	cnfg := config.AppConfigEnergyForecast{CloudCoverImpact: 0.6}
+	impacts := []database.CloudCoverImpactRow{
+		{Season: calc.SeasonSummer, Impact: 0.4, Samples: 150},
+		{Season: calc.SeasonWinter, Impact: 0.9, Samples: 20},
+	}
+
+	tests := []struct {
+		name string
+		hour hours.DateHour
+		want float64
+	}{
+		{"learned", hours.DateHour{Date: "2025-07-01", Hour: 12}, 0.4},
+		{"too few samples", hours.DateHour{Date: "2025-01-10", Hour: 12}, 0.6},
+		{"not learned", hours.DateHour{Date: "2025-04-10", Hour: 12}, 0.6},
+		{"invalid date", hours.DateHour{Date: "", Hour: 12}, 0.6},
+	}
+	for _, tt := range tests {
+		if got := cloudCoverImpact(impacts, cnfg, tt.hour); got != tt.want {
+			t.Errorf("%s: got %.2f, wanted %.2f", tt.name, got, tt.want)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/icodeforyou/solarplant-go/calc"
 	"github.com/icodeforyou/solarplant-go/config"
 	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/events"
 	"github.com/icodeforyou/solarplant-go/hours"
 )
 
@@ -19,15 +20,30 @@ type historyAverage struct {
 	Consumption float64
 	CloudCover  float64
 	Temperature float64
+	/** Deviations from the average for each historical hour */
+	ProductionDeviations  []float64
+	ConsumptionDeviations []float64
 }
 
-func NewEnergyForecastTask(logger *slog.Logger, db *database.Database, config config.AppConfigEnergyForecast) func() {
+// Number of days back to look for errors in previously issued forecasts
+const forecastErrorDays = 30
+
+// Minimum number of forecast errors for a horizon before they are used for the
+// quantiles, otherwise the spread among the historical hours is used instead.
+const minForecastErrorSamples = 20
+
+type forecastErrors struct {
+	production  []float64
+	consumption []float64
+}
+
+func NewEnergyForecastTask(logger *slog.Logger, db *database.Database, config config.AppConfigEnergyForecast, bus *events.Bus) func() {
 	return func() {
-		runEnergyForecastTask(logger, db, config)
+		runEnergyForecastTask(logger, db, config, bus)
 	}
 }
 
-func runEnergyForecastTask(logger *slog.Logger, db *database.Database, cnfg config.AppConfigEnergyForecast) {
+func runEnergyForecastTask(logger *slog.Logger, db *database.Database, cnfg config.AppConfigEnergyForecast, bus *events.Bus) {
 	logger.Debug("running energy forecast task...")
 
 	hour := hours.FromNow()
@@ -36,7 +52,25 @@ func runEnergyForecastTask(logger *slog.Logger, db *database.Database, cnfg conf
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	for range int(cnfg.HoursAhead) {
+	impacts, err := db.GetCloudCoverImpacts(ctx)
+	if err != nil {
+		logger.Error("energy forecast task error, using configured cloud cover impact", slog.Any("error", err))
+	}
+
+	errorsByHorizon := make(map[int]forecastErrors)
+	fromDate := time.Now().UTC().AddDate(0, 0, -forecastErrorDays).Format("2006-01-02")
+	if errs, err := db.GetEnergyForecastErrors(ctx, fromDate); err != nil {
+		logger.Error("energy forecast task error, getting forecast errors", slog.Any("error", err))
+	} else {
+		for _, e := range errs {
+			fe := errorsByHorizon[e.Horizon]
+			fe.production = append(fe.production, e.Production)
+			fe.consumption = append(fe.consumption, e.Consumption)
+			errorsByHorizon[e.Horizon] = fe
+		}
+	}
+
+	for h := range int(cnfg.HoursAhead) {
 		hour = hour.Add(1)
 
 		forecast, err := db.GetWeatherForecast(ctx, hour)
@@ -53,26 +87,39 @@ func runEnergyForecastTask(logger *slog.Logger, db *database.Database, cnfg conf
 			logger.Error("energy forecast task error, calculate history average", slog.Any("error", err))
 		}
 
+		impact := cloudCoverImpact(impacts, cnfg, hour)
 		// Normalize the production based on average cloud cover during the historical hours
-		avgProduction := avg.Production + avg.Production*cnfg.CloudCoverImpact*avg.CloudCover/8.0
+		avgProduction := avg.Production + avg.Production*impact*avg.CloudCover/8.0
 		// Adjust the estimated production based on the forecasted cloud cover
-		estProduction := avgProduction - avgProduction*cnfg.CloudCoverImpact*float64(forecast.CloudCover)/8.0
+		estProduction := avgProduction - avgProduction*impact*float64(forecast.CloudCover)/8.0
+
+		fe := errorsByHorizon[h+1]
+		prodP10, prodP90 := forecastQuantiles(estProduction, fe.production, avg.ProductionDeviations)
+		consP10, consP90 := forecastQuantiles(avg.Consumption, fe.consumption, avg.ConsumptionDeviations)
 
 		row := database.EnergyForecastRow{
-			When:        hour,
-			Production:  calc.TwoDecimals(estProduction),
-			Consumption: calc.TwoDecimals(avg.Consumption),
+			When:           hour,
+			Production:     calc.TwoDecimals(estProduction),
+			Consumption:    calc.TwoDecimals(avg.Consumption),
+			ProductionP10:  calc.TwoDecimals(prodP10),
+			ProductionP90:  calc.TwoDecimals(prodP90),
+			ConsumptionP10: calc.TwoDecimals(consP10),
+			ConsumptionP90: calc.TwoDecimals(consP90),
 		}
 
 		rows = append(rows, row)
 	}
 
-	if err := db.SaveEnergyForecast(ctx, rows); err != nil {
+	changed, err := db.SaveEnergyForecast(ctx, rows)
+	if err != nil {
 		logger.Error("energy forecast task error", slog.Any("error", err))
 		return
 	}
 
-	logger.Debug("energy forecast task done", slog.Int("noOfHoursUpdated", len(rows)))
+	logger.Debug("energy forecast task done", slog.Int("noOfHoursUpdated", len(rows)), slog.Int("noOfHoursChanged", changed))
+	if changed > 0 {
+		bus.Publish(events.EnergyForecastUpdated)
+	}
 }
 
 func calcHistoryAverage(ctx context.Context, db *database.Database, config config.AppConfigEnergyForecast, hour hours.DateHour) (historyAverage, error) {
@@ -101,5 +148,22 @@ func calcHistoryAverage(ctx context.Context, db *database.Database, config confi
 	avg.Temperature = avg.Temperature / count
 	avg.CloudCover = avg.CloudCover / count
 
+	for _, h := range tsh {
+		avg.ProductionDeviations = append(avg.ProductionDeviations, h.Production-avg.Production)
+		avg.ConsumptionDeviations = append(avg.ConsumptionDeviations, h.Consumption-avg.Consumption)
+	}
+
 	return avg, nil
 }
+
+// Returns the 10th and 90th percentile around the median estimate, based on the errors
+// of earlier forecasts with the same horizon or on the spread among historical hours.
+func forecastQuantiles(p50 float64, errors []float64, deviations []float64) (float64, float64) {
+	spread := errors
+	if len(spread) < minForecastErrorSamples {
+		spread = deviations
+	}
+	p10 := p50 + calc.Quantile(spread, 0.1)
+	p90 := p50 + calc.Quantile(spread, 0.9)
+	return max(0, min(p10, p50)), max(p90, p50)
+}
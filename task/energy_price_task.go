@@ -3,49 +3,79 @@ package task
 import (
 	"context"
 	"log/slog"
+	"math"
+	"slices"
 	"time"
 
+	"github.com/icodeforyou/solarplant-go/config"
 	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/events"
 	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/priceforecast"
 	"github.com/icodeforyou/solarplant-go/types"
 )
 
-func NewEnergyPriceTask(logger *slog.Logger, db *database.Database, providers []types.EnergyPriceProvider) func() {
+// How many days of price history the price forecast model is trained on
+const priceHistoryDays = 365
+
+type providerPrices struct {
+	provider string
+	prices   []types.EnergyPrice
+}
+
+// Summary of the hours where a provider disagrees with the price already chosen from a more preferred provider
+type priceDisagreement struct {
+	provider  string
+	other     string
+	noOfHours int
+	firstHour hours.DateHour
+	maxDiff   float64
+}
+
+func NewEnergyPriceTask(logger *slog.Logger, db *database.Database, providers []types.EnergyPriceProvider, cnfg config.AppConfigEnergyPrice, bus *events.Bus) func() {
 	if len(providers) == 0 {
 		panic("no energy price providers configured")
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	if needImmediateEnergyPriceUpdate(ctx, db) {
+	if needImmediateEnergyPriceUpdate(ctx, db, cnfg.GetCurrency()) {
 		logger.Info("need an immediate update of energy prices")
-		runEnergyPriceTask(logger, db, providers)
+		runEnergyPriceTask(logger, db, providers, cnfg, bus)
 	} else {
 		logger.Debug("no need for immediate update of energy prices")
 	}
 
-	return func() { runEnergyPriceTask(logger, db, providers) }
+	return func() { runEnergyPriceTask(logger, db, providers, cnfg, bus) }
 }
 
-func runEnergyPriceTask(logger *slog.Logger, db *database.Database, providers []types.EnergyPriceProvider) {
+func runEnergyPriceTask(logger *slog.Logger, db *database.Database, providers []types.EnergyPriceProvider, cnfg config.AppConfigEnergyPrice, bus *events.Bus) {
 	logger.Debug("running energy price task...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	var rows []database.EnergyPriceRow
+	var results []providerPrices
 	for _, provider := range providers {
 		prices, err := provider.GetEnergyPrices(ctx)
 		if err != nil {
-			logger.Error("energy price task error, fetching energy prices", slog.Any("error", err))
-		} else {
-			rows = make([]database.EnergyPriceRow, len(prices))
-			for i, ep := range prices {
-				logger.Debug("energy price", slog.String("hour", ep.Hour.String()), slog.Float64("price", ep.Price))
-				rows[i] = database.EnergyPriceRow{When: ep.Hour, Price: ep.Price}
-			}
-			break
+			logger.Error("energy price task error, fetching energy prices",
+				slog.String("provider", provider.Name()),
+				slog.Any("error", err))
+			continue
 		}
+		logger.Debug("energy prices fetched", slog.String("provider", provider.Name()), slog.Int("noOfHours", len(prices)))
+		results = append(results, providerPrices{provider: provider.Name(), prices: prices})
+	}
+
+	rows, disagreements := mergeEnergyPrices(results, cnfg.GetDisagreementTolerance())
+	for _, d := range disagreements {
+		logger.Warn("energy price providers disagree",
+			slog.String("provider", d.provider),
+			slog.String("other", d.other),
+			slog.Int("noOfHours", d.noOfHours),
+			slog.String("firstHour", d.firstHour.String()),
+			slog.Float64("maxDiff", d.maxDiff))
 	}
 
 	if len(rows) == 0 {
@@ -53,19 +83,143 @@ func runEnergyPriceTask(logger *slog.Logger, db *database.Database, providers []
 		return
 	}
 
-	err := db.SaveEnergyPrices(ctx, rows)
+	for i := range rows {
+		rows[i].Currency = cnfg.GetCurrency()
+		logger.Debug("energy price",
+			slog.String("hour", rows[i].When.String()),
+			slog.Float64("price", rows[i].Price),
+			slog.String("provider", rows[i].Provider))
+	}
+
+	changed, err := db.SaveEnergyPrices(ctx, rows)
 	if err != nil {
 		logger.Error("energy price task error", slog.Any("error", err))
 		return
 	}
 
-	logger.Info("energy price task done", slog.Int("noOfHoursUpdated", len(rows)))
+	logger.Info("energy price task done", slog.Int("noOfHoursUpdated", len(rows)), slog.Int("noOfHoursChanged", changed))
+
+	estimateEnergyPrices(ctx, logger, db, cnfg)
+
+	if changed > 0 {
+		bus.Publish(events.EnergyPriceUpdated)
+	}
+}
+
+// Fills the hours after the last published price with estimates
+func estimateEnergyPrices(ctx context.Context, logger *slog.Logger, db *database.Database, cnfg config.AppConfigEnergyPrice) {
+	hoursAhead := cnfg.GetEstimateHoursAhead()
+	if hoursAhead <= 0 {
+		return
+	}
+
+	fromDate := time.Now().UTC().AddDate(0, 0, -priceHistoryDays).Format(time.DateOnly)
+	history, err := db.GetEnergyPriceHistory(ctx, fromDate, cnfg.GetCurrency())
+	if err != nil {
+		logger.Error("energy price task error, fetching price history", slog.Any("error", err))
+		return
+	}
+	if len(history) == 0 {
+		return
+	}
+
+	samples := make([]priceforecast.Sample, len(history))
+	for i, ep := range history {
+		samples[i] = priceforecast.Sample{Hour: ep.When, Price: ep.Price}
+	}
+
+	model, err := priceforecast.Train(samples)
+	if err != nil {
+		logger.Debug("not estimating energy prices", slog.Any("reason", err))
+		return
+	}
+
+	start := history[len(history)-1].When.Add(1)
+	if now := hours.FromNow(); start.Compare(now) < 0 {
+		start = now
+	}
+	end := hours.FromNow().Add(hoursAhead)
+	level := priceforecast.RecentLevel(samples, start)
+
+	var estimates []database.EnergyPriceRow
+	for hour := start; hour.Compare(end) <= 0; hour = hour.Add(1) {
+		estimates = append(estimates, database.EnergyPriceRow{
+			When:      hour,
+			Price:     model.Predict(hour, level),
+			Currency:  cnfg.GetCurrency(),
+			Provider:  "estimate",
+			Estimated: true,
+		})
+	}
+	if len(estimates) == 0 {
+		return
+	}
+
+	if err := db.SaveEstimatedEnergyPrices(ctx, estimates); err != nil {
+		logger.Error("energy price task error, saving estimated prices", slog.Any("error", err))
+		return
+	}
+
+	logger.Info("energy prices estimated",
+		slog.String("from", start.String()),
+		slog.Int("noOfHours", len(estimates)),
+		slog.Float64("recentLevel", level))
+}
+
+// Merges prices from providers given in order of preference. Hours missing from
+// a provider are filled from the next one, and overlapping hours that differ
+// more than the tolerance are reported as disagreements.
+func mergeEnergyPrices(results []providerPrices, tolerance float64) ([]database.EnergyPriceRow, []priceDisagreement) {
+	merged := make(map[hours.DateHour]database.EnergyPriceRow)
+	var disagreements []priceDisagreement
+
+	for _, res := range results {
+		byOther := make(map[string]*priceDisagreement)
+		for _, ep := range res.prices {
+			existing, ok := merged[ep.Hour]
+			if !ok {
+				merged[ep.Hour] = database.EnergyPriceRow{When: ep.Hour, Price: ep.Price, Provider: res.provider}
+				continue
+			}
+
+			diff := math.Abs(existing.Price - ep.Price)
+			if diff <= tolerance {
+				continue
+			}
+
+			d, ok := byOther[existing.Provider]
+			if !ok {
+				d = &priceDisagreement{provider: res.provider, other: existing.Provider, firstHour: ep.Hour}
+				byOther[existing.Provider] = d
+			}
+			d.noOfHours++
+			d.maxDiff = max(d.maxDiff, diff)
+			if ep.Hour.Compare(d.firstHour) < 0 {
+				d.firstHour = ep.Hour
+			}
+		}
+
+		for _, d := range byOther {
+			disagreements = append(disagreements, *d)
+		}
+	}
+
+	rows := make([]database.EnergyPriceRow, 0, len(merged))
+	for _, row := range merged {
+		rows = append(rows, row)
+	}
+	slices.SortFunc(rows, func(a, b database.EnergyPriceRow) int { return a.When.Compare(b.When) })
+	slices.SortFunc(disagreements, func(a, b priceDisagreement) int { return a.firstHour.Compare(b.firstHour) })
+
+	return rows, disagreements
 }
 
-func needImmediateEnergyPriceUpdate(ctx context.Context, db *database.Database) bool {
+func needImmediateEnergyPriceUpdate(ctx context.Context, db *database.Database, currency string) bool {
 	dh := hours.FromNow().Add(12)
-	if _, err := db.GetEnergyPrice(ctx, dh); err != nil {
+	ep, err := db.GetEnergyPrice(ctx, dh)
+	if err != nil || ep.Estimated {
 		return true
 	}
-	return false
+	// The configured currency has changed since the prices were fetched
+	return ep.Currency != currency
 }
@@ -0,0 +1,58 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+func TestMergeEnergyPrices(t *testing.T) {
+	h := func(hour uint8) hours.DateHour { return hours.DateHour{Date: "2025-06-01", Hour: hour} }
+
+	results := []providerPrices{
+		{provider: "primary", prices: []types.EnergyPrice{
+			{Hour: h(0), Price: 1.0},
+			{Hour: h(1), Price: 2.0},
+		}},
+		{provider: "secondary", prices: []types.EnergyPrice{
+			{Hour: h(0), Price: 1.005}, // Within tolerance
+			{Hour: h(1), Price: 2.5},   // Disagrees
+			{Hour: h(2), Price: 3.0},   // Missing from primary
+		}},
+	}
+
+	rows, disagreements := mergeEnergyPrices(results, 0.01)
+
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, wanted 3", len(rows))
+	}
+	want := []struct {
+		price    float64
+		provider string
+	}{
+		{1.0, "primary"},
+		{2.0, "primary"},
+		{3.0, "secondary"},
+	}
+	for i, w := range want {
+		if rows[i].When != h(uint8(i)) || rows[i].Price != w.price || rows[i].Provider != w.provider {
+			t.Errorf("row %d: got %+v, wanted %f from %s", i, rows[i], w.price, w.provider)
+		}
+	}
+
+	if len(disagreements) != 1 {
+		t.Fatalf("got %d disagreements, wanted 1", len(disagreements))
+	}
+	d := disagreements[0]
+	if d.provider != "secondary" || d.other != "primary" || d.noOfHours != 1 || d.firstHour != h(1) || d.maxDiff != 0.5 {
+		t.Errorf("unexpected disagreement %+v", d)
+	}
+}
+
+func TestMergeEnergyPricesNoResults(t *testing.T) {
+	rows, disagreements := mergeEnergyPrices(nil, 0.01)
+	if len(rows) != 0 || len(disagreements) != 0 {
+		t.Errorf("got %d rows and %d disagreements, wanted none", len(rows), len(disagreements))
+	}
+}
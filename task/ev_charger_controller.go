@@ -0,0 +1,199 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+// How often a command is repeated when the charger doesn't do what it was told,
+// e.g. after it has restarted
+const evCommandRetry = 5 * time.Minute
+
+// Charges the EV according to the plan while there's an active charge request,
+// otherwise the charger is left alone and charges as it's set up to
+type EvChargerController struct {
+	logger            *slog.Logger
+	db                *database.Database
+	charger           types.EvCharger
+	interval          time.Duration
+	maxPower          float64
+	session           *database.EvSessionRow // Nil when no vehicle is connected
+	lastSessionEnergy float64
+	hour              hours.DateHour
+	hourDelivered     float64 // Energy in kWh charged this hour
+	controlling       bool    // Charging has been paused or resumed for a request
+	lastCommand       *bool
+	lastCommandTime   time.Time
+	failing           bool // Keeping state to avoid spamming logs
+}
+
+func NewEvChargerController(
+	logger *slog.Logger,
+	db *database.Database,
+	charger types.EvCharger,
+	interval time.Duration,
+	maxPower float64) *EvChargerController {
+
+	return &EvChargerController{
+		logger:   logger,
+		db:       db,
+		charger:  charger,
+		interval: interval,
+		maxPower: maxPower,
+	}
+}
+
+func (c *EvChargerController) Run(ctx context.Context) {
+	c.logger.Debug("starting ev charger controller", slog.String("charger", c.charger.Name()), slog.Any("interval", c.interval))
+
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.control(ctx)
+			}
+		}
+	}()
+}
+
+func (c *EvChargerController) control(ctx context.Context) {
+	now := time.Now()
+	status := c.charger.Status()
+	delivered := c.trackSession(ctx, status, now)
+
+	hour := hours.FromTime(now)
+	if hour != c.hour {
+		c.hour = hour
+		c.hourDelivered = 0
+	}
+	c.hourDelivered += delivered
+
+	req, err := c.db.GetActiveEvChargeRequest(ctx, now)
+	if err == sql.ErrNoRows {
+		if c.controlling {
+			// Hand the charger back, so it charges as usual when plugged in
+			c.controlling = false
+			c.setCharging(ctx, status, true, "no active charge request")
+		}
+		return
+	}
+	if err != nil {
+		c.logger.Error("failed to get ev charge request", slog.Any("error", err))
+		return
+	}
+
+	if delivered > 0 {
+		if err := c.db.AddEvChargeDelivered(ctx, req.Id, delivered); err != nil {
+			c.logger.Error("failed to save delivered ev energy", slog.Any("error", err))
+		}
+		req.Delivered += delivered
+	}
+
+	if !status.VehicleConnected() {
+		return
+	}
+
+	planned := sql.NullFloat64{}
+	if planning, err := c.db.GetPlanning(ctx, hour); err == nil {
+		planned = planning.EvCharge
+	}
+
+	want, reason := evChargingWanted(req, planned, c.hourDelivered, c.maxPower, now)
+	c.controlling = true
+	c.setCharging(ctx, status, want, reason)
+}
+
+// Whether the vehicle should charge now, and why
+func evChargingWanted(req database.EvChargeRequestRow, planned sql.NullFloat64, hourDelivered float64, maxPower float64, now time.Time) (bool, string) {
+	if req.Remaining() <= 0 {
+		return false, "requested energy delivered"
+	}
+	if maxPower > 0 && req.Remaining() >= maxPower*req.Deadline.Sub(now).Hours() {
+		return true, "deadline is near"
+	}
+	if !planned.Valid {
+		return true, "no plan for this hour"
+	}
+	if hourDelivered < planned.Float64-0.01 {
+		return true, "planned for this hour"
+	}
+	return false, "not planned for this hour"
+}
+
+func (c *EvChargerController) setCharging(ctx context.Context, status types.EvChargerStatus, enabled bool, reason string) {
+	now := time.Now()
+	followed := (status.State == types.EvChargerCharging) == enabled
+	if c.lastCommand != nil && *c.lastCommand == enabled && (followed || now.Sub(c.lastCommandTime) < evCommandRetry) {
+		return
+	}
+
+	if err := c.charger.SetCharging(ctx, enabled); err != nil {
+		if !c.failing {
+			c.failing = true
+			c.logger.Error("failed to control ev charger", slog.Bool("charging", enabled), slog.Any("error", err))
+		}
+		return
+	}
+	if c.failing {
+		c.failing = false
+		c.logger.Info("ev charger control recovered")
+	}
+
+	if c.lastCommand == nil || *c.lastCommand != enabled {
+		c.logger.Info("ev charging changed", slog.Bool("charging", enabled), slog.String("reason", reason))
+	}
+	c.lastCommand = &enabled
+	c.lastCommandTime = now
+}
+
+// Keeps the session up to date and returns the energy in kWh charged since the last call
+func (c *EvChargerController) trackSession(ctx context.Context, status types.EvChargerStatus, now time.Time) float64 {
+	if status.State == types.EvChargerUnavailable {
+		return 0 // The charger may just be restarting, so the session isn't ended
+	}
+
+	if !status.VehicleConnected() {
+		if c.session != nil {
+			c.session.Ended = sql.NullTime{Time: now, Valid: true}
+			c.saveSession(ctx)
+			c.logger.Info("ev disconnected", slog.Float64("energy", c.session.Energy))
+			c.session = nil
+		}
+		return 0
+	}
+
+	if c.session == nil {
+		c.session = &database.EvSessionRow{Started: now}
+		c.lastSessionEnergy = status.SessionEnergy // Could be left from an earlier session
+		c.saveSession(ctx)
+		c.logger.Info("ev connected")
+		return 0
+	}
+
+	delta := status.SessionEnergy - c.lastSessionEnergy
+	if delta < 0 {
+		delta = status.SessionEnergy // A new transaction was started
+	}
+	c.lastSessionEnergy = status.SessionEnergy
+	if delta > 0 {
+		c.session.Energy += delta
+		c.saveSession(ctx)
+	}
+	return delta
+}
+
+func (c *EvChargerController) saveSession(ctx context.Context) {
+	if err := c.db.SaveEvSession(ctx, *c.session); err != nil {
+		c.logger.Error("failed to save ev session", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,58 @@
+package task
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/database"
+)
+
+func TestEvChargingWanted(t *testing.T) {
+	now := time.Date(2025, 6, 1, 22, 15, 0, 0, time.UTC)
+	req := database.EvChargeRequestRow{Energy: 30, Delivered: 10, Deadline: now.Add(8 * time.Hour)}
+	planned := sql.NullFloat64{Float64: 5, Valid: true}
+
+	tests := []struct {
+		name          string
+		req           database.EvChargeRequestRow
+		planned       sql.NullFloat64
+		hourDelivered float64
+		want          bool
+	}{
+		{"planned", req, planned, 2, true},
+		{"planned energy delivered", req, planned, 5, false},
+		{"not planned", req, sql.NullFloat64{Float64: 0, Valid: true}, 0, false},
+		{"no plan", req, sql.NullFloat64{}, 0, true},
+		{"request delivered", database.EvChargeRequestRow{Energy: 30, Delivered: 30, Deadline: req.Deadline}, planned, 0, false},
+		{"deadline is near", database.EvChargeRequestRow{Energy: 30, Delivered: 10, Deadline: now.Add(90 * time.Minute)}, sql.NullFloat64{Float64: 0, Valid: true}, 0, true},
+	}
+	for _, tt := range tests {
+		if got, reason := evChargingWanted(tt.req, tt.planned, tt.hourDelivered, 11, now); got != tt.want {
+			t.Errorf("%s: got %t (%s), wanted %t", tt.name, got, reason, tt.want)
+		}
+	}
+}
+
+func TestEvChargeLoad(t *testing.T) {
+	start := time.Date(2025, 6, 1, 22, 0, 0, 0, time.UTC)
+	req := database.EvChargeRequestRow{Energy: 40, Delivered: 4, Deadline: time.Date(2025, 6, 2, 7, 30, 0, 0, time.UTC)}
+
+	// The deadline is within the planned hours, the hour it's in can't be used
+	load := evChargeLoad(req, 11, start, 12)
+	if load.To != 9 || load.Energy != 36 || load.Power != 11 {
+		t.Errorf("unexpected load %+v", load)
+	}
+
+	// Only 6 of 9 hours are planned, what fits in the last 3 hours at full power can wait
+	load = evChargeLoad(req, 11, start, 6)
+	if load.To != 6 || load.Energy != 3 {
+		t.Errorf("unexpected load %+v", load)
+	}
+
+	// Deadline has passed
+	load = evChargeLoad(req, 11, start.Add(12*time.Hour), 12)
+	if load.To != 0 {
+		t.Errorf("unexpected load %+v", load)
+	}
+}
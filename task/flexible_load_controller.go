@@ -0,0 +1,247 @@
+package task
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/flexload"
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/optimize"
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+// How often a command is repeated, the switches don't report their state and may
+// have been restarted or switched by hand
+const loadCommandRepeat = 5 * time.Minute
+
+// Allowed difference in hours between the planned and actual run time of an hour
+const loadRunTimeTolerance = 1.0 / 60.0
+
+// Switches flexible loads on and off according to the plan, overrides and daily run time
+type FlexibleLoadController struct {
+	logger   *slog.Logger
+	db       *database.Database
+	loads    []flexload.Load
+	switches map[string]types.LoadSwitch
+	interval time.Duration
+	mu       sync.RWMutex
+	states   map[string]*loadState
+}
+
+type loadState struct {
+	on          bool // Last command that succeeded
+	known       bool // A command has succeeded
+	reason      string
+	commandTime time.Time
+	lastTick    time.Time
+	failing     bool // Keeping state to avoid spamming logs
+}
+
+// The state of a load as last switched by the controller
+type FlexibleLoadState struct {
+	Known  bool // False until the load has been switched
+	On     bool
+	Reason string
+}
+
+func NewFlexibleLoadController(
+	logger *slog.Logger,
+	db *database.Database,
+	loads []flexload.Load,
+	switches map[string]types.LoadSwitch,
+	interval time.Duration) *FlexibleLoadController {
+
+	states := make(map[string]*loadState, len(loads))
+	for _, l := range loads {
+		states[l.Name] = &loadState{}
+	}
+
+	return &FlexibleLoadController{
+		logger:   logger,
+		db:       db,
+		loads:    loads,
+		switches: switches,
+		interval: interval,
+		states:   states,
+	}
+}
+
+func (c *FlexibleLoadController) Run(ctx context.Context) {
+	c.logger.Debug("starting flexible load controller", slog.Int("noOfLoads", len(c.loads)), slog.Any("interval", c.interval))
+
+	go func() {
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			c.control(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *FlexibleLoadController) Loads() []flexload.Load {
+	return c.loads
+}
+
+func (c *FlexibleLoadController) State(name string) FlexibleLoadState {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	s, ok := c.states[name]
+	if !ok {
+		return FlexibleLoadState{}
+	}
+	return FlexibleLoadState{Known: s.known, On: s.on, Reason: s.reason}
+}
+
+func (c *FlexibleLoadController) control(ctx context.Context) {
+	now := time.Now()
+	hour := hours.FromTime(now)
+
+	overrides, err := c.db.GetActiveFlexibleLoadOverrides(ctx, now)
+	if err != nil {
+		c.logger.Error("failed to get flexible load overrides", slog.Any("error", err))
+		return
+	}
+
+	// Exporting costs money, so the loads take what they can of the surplus
+	curtailing := false
+	if p, err := c.db.GetPlanning(ctx, hour); err == nil {
+		curtailing = p.Strategy == optimize.StrategyCurtail.String()
+	} else if err != sql.ErrNoRows {
+		c.logger.Error("failed to get planning", slog.Any("error", err))
+	}
+
+	for _, load := range c.loads {
+		c.trackRunTime(ctx, load, hour, now)
+
+		ranToday, err := c.db.GetFlexibleLoadRunTime(ctx, load.Name, hours.FromTime(flexload.StartOfDay(now)), hour.Add(1))
+		if err != nil {
+			c.logger.Error("failed to get flexible load run time", slog.String("load", load.Name), slog.Any("error", err))
+			continue
+		}
+
+		planned := sql.NullFloat64{}
+		hourRunTime := 0.0
+		row, err := c.db.GetFlexibleLoad(ctx, load.Name, hour)
+		if err != nil && err != sql.ErrNoRows {
+			c.logger.Error("failed to get flexible load plan", slog.String("load", load.Name), slog.Any("error", err))
+			continue
+		}
+		if err == nil {
+			planned = row.Planned
+			hourRunTime = row.Actual
+		}
+
+		var override *database.FlexibleLoadOverrideRow
+		if o, ok := overrides[load.Name]; ok {
+			override = &o
+		}
+
+		on, reason := loadWanted(load, override, planned, hourRunTime, ranToday, curtailing, now)
+		c.setOn(ctx, load, on, reason, now)
+	}
+}
+
+// Whether the load should be on now, and why
+func loadWanted(
+	load flexload.Load,
+	override *database.FlexibleLoadOverrideRow,
+	planned sql.NullFloat64,
+	hourRunTime float64,
+	ranToday float64,
+	curtailing bool,
+	now time.Time) (bool, string) {
+
+	if override != nil && override.Until.After(now) {
+		if override.On {
+			return true, "overridden on"
+		}
+		return false, "overridden off"
+	}
+	if !load.AllowedAt(now) {
+		return false, "outside the allowed windows"
+	}
+	if curtailing {
+		// The planner counts on the loads taking the surplus, also beyond their daily run time
+		return true, "curtailing export"
+	}
+	remaining := load.DailyRunTime - ranToday
+	if remaining <= 0 {
+		return false, "daily run time reached"
+	}
+	if remaining >= load.AllowedHours(now, flexload.EndOfDay(now)) {
+		return true, "daily run time at risk"
+	}
+	if !planned.Valid {
+		return false, "no plan for this hour"
+	}
+	if hourRunTime < planned.Float64-loadRunTimeTolerance {
+		return true, "planned for this hour"
+	}
+	return false, "not planned for this hour"
+}
+
+// Adds the time since the last tick to the run time of the hour if the load was on
+func (c *FlexibleLoadController) trackRunTime(ctx context.Context, load flexload.Load, hour hours.DateHour, now time.Time) {
+	c.mu.Lock()
+	s := c.states[load.Name]
+	elapsed := now.Sub(s.lastTick)
+	wasOn := s.known && s.on && !s.lastTick.IsZero()
+	s.lastTick = now
+	c.mu.Unlock()
+
+	if !wasOn {
+		return
+	}
+	// A long gap means the controller didn't run, so it's unknown if the load did
+	elapsed = min(elapsed, 2*c.interval)
+	if err := c.db.AddFlexibleLoadRunTime(ctx, load.Name, hour, elapsed.Hours()); err != nil {
+		c.logger.Error("failed to save flexible load run time", slog.String("load", load.Name), slog.Any("error", err))
+	}
+}
+
+func (c *FlexibleLoadController) setOn(ctx context.Context, load flexload.Load, on bool, reason string, now time.Time) {
+	c.mu.RLock()
+	s := *c.states[load.Name]
+	c.mu.RUnlock()
+
+	if s.known && s.on == on && now.Sub(s.commandTime) < loadCommandRepeat {
+		c.mu.Lock()
+		c.states[load.Name].reason = reason
+		c.mu.Unlock()
+		return
+	}
+
+	if err := c.switches[load.Name].SetOn(ctx, on); err != nil {
+		if !s.failing {
+			c.logger.Error("failed to switch flexible load", slog.String("load", load.Name), slog.Bool("on", on), slog.Any("error", err))
+		}
+		c.mu.Lock()
+		c.states[load.Name].failing = true
+		c.mu.Unlock()
+		return
+	}
+	if s.failing {
+		c.logger.Info("flexible load control recovered", slog.String("load", load.Name))
+	}
+	if !s.known || s.on != on {
+		c.logger.Info("flexible load switched", slog.String("load", load.Name), slog.Bool("on", on), slog.String("reason", reason))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state := c.states[load.Name]
+	state.failing = false
+	state.known = true
+	state.on = on
+	state.reason = reason
+	state.commandTime = now
+}
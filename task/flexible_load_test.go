@@ -0,0 +1,146 @@
+package task
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/flexload"
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/optimize"
+)
+
+func flexInput(prices ...float64) optimize.Input {
+	input := optimize.Input{Forecast: make([]optimize.Forecast, len(prices))}
+	for h, p := range prices {
+		input.Forecast[h] = optimize.Forecast{EnergyPrice: p}
+	}
+	return input
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func TestPlanFlexibleLoad(t *testing.T) {
+	start := time.Date(2025, 6, 1, 20, 0, 0, 0, time.UTC)
+	// 20:00 - 07:00, the cheapest hours are after midnight
+	input := flexInput(1.0, 0.9, 0.8, 0.7, 0.5, 0.3, 0.2, 0.1, 0.4, 0.6, 0.8)
+	load := flexload.Load{Name: "heater", Power: 3, DailyRunTime: 2}
+
+	// Today, 2 hours of which 1.5 has run, are planned before midnight. Tomorrow
+	// has more hours after the plan than needed, so nothing is planned.
+	runTime := planFlexibleLoad(input, load, start, start, 1.5, nil)
+	if math.Abs(sum(runTime[:4])-0.5) > 0.001 || runTime[3] != 0.5 {
+		t.Errorf("unexpected run time today %v", runTime)
+	}
+	if sum(runTime[4:]) != 0 {
+		t.Errorf("unexpected run time tomorrow %v", runTime)
+	}
+
+	// Only allowed 02:00 - 05:00 tomorrow, so the plan has to include those hours
+	load.Windows = []hours.TimeWindow{{From: 2 * 60, To: 5 * 60}}
+	runTime = planFlexibleLoad(input, load, start, start, 0, nil)
+	if sum(runTime[:4]) != 0 {
+		t.Errorf("unexpected run time outside the window %v", runTime)
+	}
+	if runTime[6] != 1 || runTime[7] != 1 || sum(runTime) != 2 {
+		t.Errorf("unexpected run time in the window %v", runTime)
+	}
+
+	// Forced off until 03:00 leaves only 2 hours in the window
+	override := &database.FlexibleLoadOverrideRow{Name: "heater", On: false, Until: start.Add(7 * time.Hour)}
+	runTime = planFlexibleLoad(input, load, start, start, 0, override)
+	if runTime[6] != 0 || runTime[7] != 1 || runTime[8] != 1 {
+		t.Errorf("unexpected run time when forced off %v", runTime)
+	}
+
+	// Forced on until 22:30 counts towards today's run time
+	load.Windows = nil
+	override = &database.FlexibleLoadOverrideRow{Name: "heater", On: true, Until: start.Add(150 * time.Minute)}
+	runTime = planFlexibleLoad(input, load, start, start, 0, override)
+	if runTime[0] != 1 || runTime[1] != 1 || runTime[2] != 0.5 || math.Abs(sum(runTime[:4])-2.5) > 0.001 {
+		t.Errorf("unexpected run time when forced on %v", runTime)
+	}
+}
+
+func TestPlanFlexibleLoadWithinTheHour(t *testing.T) {
+	start := time.Date(2025, 6, 1, 22, 0, 0, 0, time.UTC)
+	first := start.Add(30 * time.Minute)
+	input := flexInput(0.1, 0.5)
+	input.FirstHourFraction = 0.5
+	load := flexload.Load{Name: "pool", Power: 1, DailyRunTime: 1}
+
+	runTime := planFlexibleLoad(input, load, start, first, 0, nil)
+	if runTime[0] != 0.5 || runTime[1] != 0.5 {
+		t.Errorf("unexpected run time %v", runTime)
+	}
+}
+
+func TestCurtailRunTime(t *testing.T) {
+	start := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	first := start.Add(30 * time.Minute)
+	load := flexload.Load{Name: "pool", Power: 2, DailyRunTime: 1, Windows: []hours.TimeWindow{{From: 10 * 60, To: 12 * 60}}}
+
+	// Half of the first hour remains, the second hour has 0.25 hours planned, and the
+	// third hour is outside the window
+	extra := curtailRunTime(load, start, first, []float64{0, 0.25, 0}, nil)
+	if extra[0] != 0.5 || extra[1] != 0.75 || extra[2] != 0 {
+		t.Errorf("unexpected run time %v", extra)
+	}
+
+	// The override decides until 11:15
+	override := &database.FlexibleLoadOverrideRow{Name: "pool", On: false, Until: start.Add(75 * time.Minute)}
+	extra = curtailRunTime(load, start, first, []float64{0, 0.25, 0}, override)
+	if extra[0] != 0 || extra[1] != 0 || extra[2] != 0 {
+		t.Errorf("unexpected run time with an override %v", extra)
+	}
+}
+
+func TestLoadWanted(t *testing.T) {
+	now := time.Date(2025, 6, 1, 14, 10, 0, 0, time.UTC)
+	load := flexload.Load{Name: "heater", Power: 3, DailyRunTime: 3, Windows: []hours.TimeWindow{{From: 10 * 60, To: 20 * 60}}}
+	planned := sql.NullFloat64{Float64: 0.5, Valid: true}
+	on := &database.FlexibleLoadOverrideRow{On: true, Until: now.Add(time.Hour)}
+	off := &database.FlexibleLoadOverrideRow{On: false, Until: now.Add(time.Hour)}
+	expired := &database.FlexibleLoadOverrideRow{On: true, Until: now.Add(-time.Minute)}
+
+	tests := []struct {
+		name        string
+		load        flexload.Load
+		override    *database.FlexibleLoadOverrideRow
+		planned     sql.NullFloat64
+		hourRunTime float64
+		ranToday    float64
+		curtailing  bool
+		want        bool
+	}{
+		{"planned", load, nil, planned, 0.1, 1, false, true},
+		{"planned run time reached", load, nil, planned, 0.5, 1, false, false},
+		{"no plan", load, nil, sql.NullFloat64{}, 0, 1, false, false},
+		{"overridden on", load, on, sql.NullFloat64{}, 0, 3, false, true},
+		{"overridden off", load, off, planned, 0, 1, false, false},
+		{"expired override", load, expired, sql.NullFloat64{}, 0, 1, false, false},
+		{"outside the window", flexload.Load{Name: "heater", Power: 3, DailyRunTime: 3, Windows: []hours.TimeWindow{{From: 0, To: 6 * 60}}}, nil, planned, 0, 0, false, false},
+		{"daily run time reached", load, nil, planned, 0, 3, false, false},
+		{"not planned", load, nil, sql.NullFloat64{Float64: 0, Valid: true}, 0, 0, false, false},
+		// Less than 6 hours left of the window
+		{"daily run time at risk", flexload.Load{Name: "heater", Power: 3, DailyRunTime: 6, Windows: load.Windows}, nil, sql.NullFloat64{Float64: 0, Valid: true}, 0, 0, false, true},
+		{"curtailing", load, nil, sql.NullFloat64{Float64: 0, Valid: true}, 0, 1, true, true},
+		{"curtailing without a plan", load, nil, sql.NullFloat64{}, 0, 1, true, true},
+		{"curtailing after the daily run time", load, nil, planned, 0, 3, true, true},
+		{"curtailing outside the window", flexload.Load{Name: "heater", Power: 3, DailyRunTime: 3, Windows: []hours.TimeWindow{{From: 0, To: 6 * 60}}}, nil, planned, 0, 0, true, false},
+		{"curtailing overridden off", load, off, planned, 0, 1, true, false},
+	}
+	for _, tt := range tests {
+		if got, reason := loadWanted(tt.load, tt.override, tt.planned, tt.hourRunTime, tt.ranToday, tt.curtailing, now); got != tt.want {
+			t.Errorf("%s: got %t (%s), wanted %t", tt.name, got, reason, tt.want)
+		}
+	}
+}
@@ -2,20 +2,23 @@ package task
 
 import (
 	"context"
+	"database/sql"
 	"log/slog"
+	"slices"
 	"time"
 
-	"github.com/icodeforyou/solarplant-go/calc"
 	"github.com/icodeforyou/solarplant-go/config"
 	"github.com/icodeforyou/solarplant-go/database"
 	"github.com/icodeforyou/solarplant-go/ferroamp"
 	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/savings"
 )
 
 func NewHourlyTask(
 	logger *slog.Logger,
 	db *database.Database,
 	cnfg config.AppConfigEnergyPrice,
+	spec config.AppConfigBatterySpec,
 	faInMem *ferroamp.FaInMemData,
 	recentHours *database.RecentHours) func() {
 
@@ -73,8 +76,16 @@ func NewHourlyTask(
 			planning = database.PlanningRow{}
 		}
 
+		controlLog, err := db.GetControlLogForHour(ctx, currHour)
+		if err != nil {
+			logger.Error("hourly task error, getting control log", slog.Any("error", err))
+		}
+		controlCommands, planFollowed := controlSummary(controlLog, currHour)
+
 		gridImport := faInMem.ImportedSince(prevHour.Fa.Data)
 		gridExport := faInMem.ExportedSince(prevHour.Fa.Data)
+		batteryNetLoad := faInMem.BatteryNetLoadSince(prevHour.Fa.Data)
+		batteryLevel := faInMem.BatteryLevel()
 
 		err = db.SaveTimeSeries(ctx, database.TimeSeriesRow{
 			When:                 currHour,
@@ -89,15 +100,26 @@ func NewHourlyTask(
 			ConsumptionEstimated: ef.Consumption,
 			GridImport:           gridImport,
 			GridExport:           gridExport,
-			BatteryLevel:         faInMem.BatteryLevel(),
-			BatteryNetLoad:       faInMem.BatteryNetLoadSince(prevHour.Fa.Data),
-			CashFlow:             calc.CashFlow(gridImport, gridExport, ep.Price, cnfg.Tax, cnfg.TaxReduction, cnfg.GridBenefit),
+			BatteryLevel:         batteryLevel,
+			BatteryNetLoad:       batteryNetLoad,
+			CashFlow:             cnfg.GetTariff().CashFlow(gridImport, gridExport, ep.Price),
 			Strategy:             planning.Strategy,
+			ControlCommands:      controlCommands,
+			PlanFollowed:         planFollowed,
 		})
 		if err != nil {
 			logger.Error("hourly task error, saving time series", slog.Any("error", err))
 		}
 
+		adherence := planAdherence(spec, planning, controlLog, currHour, batteryNetLoad, batteryLevel)
+		if err = db.SavePlanAdherence(ctx, adherence); err != nil {
+			logger.Error("hourly task error, saving plan adherence", slog.Any("error", err))
+		}
+
+		if err = saveSavings(ctx, db, savings.New(cnfg.GetTariff(), spec)); err != nil {
+			logger.Error("hourly task error, saving savings", slog.Any("error", err))
+		}
+
 		if err = recentHours.Reload(ctx); err != nil {
 			logger.Error("hourly task error, reload recent hours", slog.Any("error", err))
 		}
@@ -105,3 +127,40 @@ func NewHourlyTask(
 		logger.Info("hourly task done")
 	}
 }
+
+// Computes the costs of the hours in the time series after the last one computed, where
+// the self-consumption battery continues from the level it ended at. The first time it
+// starts at the battery level of the first hour, and earlier hours are computed as well.
+func saveSavings(ctx context.Context, db *database.Database, model savings.Model) error {
+	from, level, started := hours.DateHour{}, 0.0, false
+	last, err := db.GetLatestSavings(ctx)
+	if err == nil {
+		from, level, started = last.When.Add(1), last.SelfConsumptionLevel, true
+	} else if err != sql.ErrNoRows {
+		return err
+	}
+
+	rows, err := db.GetTimeSeriesFrom(ctx, from)
+	if err != nil {
+		return err
+	}
+	// Oldest first, the battery level carries over from one hour to the next
+	for _, ts := range slices.Backward(rows) {
+		if !started {
+			level, started = ts.BatteryLevel, true
+		}
+		h := model.Hour(ts, level)
+		level = h.Level
+		err := db.SaveSavings(ctx, database.SavingsRow{
+			When:                 ts.When,
+			Actual:               h.Actual,
+			NoBattery:            h.NoBattery,
+			SelfConsumption:      h.SelfConsumption,
+			SelfConsumptionLevel: h.Level,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -52,6 +52,26 @@ func NewMaintenanceTask(logger *slog.Logger, db *database.Database, cnfg *config
 			logger.Error("weather_forecast maintenance error", slog.Any("error", err))
 		}
 
+		if err := db.PurgeForecastVintage(ctx, cnfg.Database.GetDataRetentionDays()); err != nil {
+			logger.Error("forecast vintage maintenance error", slog.Any("error", err))
+		}
+
+		if err := db.PurgeEvCharging(ctx, cnfg.Database.GetDataRetentionDays()); err != nil {
+			logger.Error("ev charging maintenance error", slog.Any("error", err))
+		}
+
+		if err := db.PurgeFlexibleLoad(ctx, cnfg.Database.GetDataRetentionDays()); err != nil {
+			logger.Error("flexible load maintenance error", slog.Any("error", err))
+		}
+
+		if err := db.PurgeControlLog(ctx, cnfg.Database.GetDataRetentionDays()); err != nil {
+			logger.Error("control log maintenance error", slog.Any("error", err))
+		}
+
+		if err := db.PurgePlanAdherence(ctx, cnfg.Database.GetDataRetentionDays()); err != nil {
+			logger.Error("plan adherence maintenance error", slog.Any("error", err))
+		}
+
 		logger.Info("maintenance task done")
 	}
 }
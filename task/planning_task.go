@@ -5,19 +5,49 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"slices"
 	"time"
 
 	"github.com/icodeforyou/solarplant-go/calc"
 	"github.com/icodeforyou/solarplant-go/config"
 	"github.com/icodeforyou/solarplant-go/database"
 	"github.com/icodeforyou/solarplant-go/ferroamp"
+	"github.com/icodeforyou/solarplant-go/flexload"
 	"github.com/icodeforyou/solarplant-go/hours"
 	"github.com/icodeforyou/solarplant-go/optimize"
+	"github.com/icodeforyou/solarplant-go/reserve"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
 )
 
-func NewPlanningTask(logger *slog.Logger, db *database.Database, cnfg *config.AppConfig, faInMem *ferroamp.FaInMemData) func() {
+// Replanning is pointless with less than this left of the hour, the next hourly plan is soon saved
+const minReplanFraction = 5.0 / 60.0
+
+// Days of capacity estimates the measured battery capacity is averaged over
+const measuredCapacityDays = 30
+
+// Plans the upcoming hours, or if intraHour the rest of this hour and onwards
+// starting from the current battery level
+func NewPlanningTask(logger *slog.Logger, db *database.Database, cnfg *config.AppConfig, faInMem *ferroamp.FaInMemData, intraHour bool) func() {
+	loads, err := flexload.FromConfigs(cnfg.FlexibleLoads)
+	if err != nil {
+		logger.Error("flexible loads won't be planned", slog.Any("error", err))
+	}
+	reservePolicy, err := reserve.New(cnfg.BatteryReserve)
+	if err != nil {
+		logger.Error("battery reserve won't be planned", slog.Any("error", err))
+	}
+	derating, err := optimize.NewDerating(cnfg.BatterySpec)
+	if err != nil {
+		logger.Error("battery derating won't be planned", slog.Any("error", err))
+	}
+	taper, err := optimize.NewTaper(cnfg.BatterySpec)
+	taperValid := err == nil
+	if !taperValid {
+		logger.Error("battery taper won't be planned", slog.Any("error", err))
+	}
+
 	return func() {
-		logger.Debug("running planning task...")
+		logger.Debug("running planning task...", slog.Bool("intraHour", intraHour))
 		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
 		defer cancel()
 
@@ -26,18 +56,65 @@ func NewPlanningTask(logger *slog.Logger, db *database.Database, cnfg *config.Ap
 			return
 		}
 
+		now := time.Now()
 		startHour := hours.FromNow().Add(1)
+		firstHourFraction := 0.0
+		if intraHour {
+			startHour = hours.FromNow()
+			firstHourFraction = 1 - now.Sub(now.Truncate(time.Hour)).Hours()
+			if firstHourFraction < minReplanFraction {
+				logger.Info("skipping intra-hour replanning, the hour is almost over")
+				return
+			}
+		}
 
 		optInput := optimize.Input{
 			Battery: optimize.Battery{
 				AppConfigBatterySpec: cnfg.BatterySpec,
 				CurrentLevel:         faInMem.BatteryLevel(),
 			},
-			EnergyTax:    cnfg.EnergyPrice.Tax,
-			GridMaxPower: cnfg.Planner.GridMaxPower,
-			Forecast:     make([]optimize.Forecast, cnfg.Planner.HoursAhead),
+			Tariff:            cnfg.EnergyPrice.GetTariff(),
+			GridMaxPower:      cnfg.Planner.GridMaxPower,
+			Forecast:          make([]optimize.Forecast, cnfg.Planner.HoursAhead),
+			RiskAversion:      cnfg.Planner.RiskAversion,
+			FirstHourFraction: firstHourFraction,
+			ImportPenalty:     cnfg.Planner.ImportPenalty,
+			ExportCap:         cnfg.Planner.GetGridMaxExport(),
+		}
+		if cnfg.BatterySpec.UseMeasuredCapacity {
+			capacity, err := db.GetMeasuredBatteryCapacity(ctx, now.AddDate(0, 0, -measuredCapacityDays))
+			if err == nil {
+				logger.Debug("planning with measured battery capacity", slog.Float64("capacity", capacity))
+				optInput.Battery.Capacity = capacity
+			} else if err != sql.ErrNoRows {
+				logger.Error("planning task error, getting measured battery capacity", slog.Any("error", err))
+			}
+		}
+		if temp, ok := faInMem.BatteryTemperature(); ok {
+			optInput.Battery.CellTemperature = maybe.Some(temp)
+		}
+		if taperValid {
+			optInput.Battery.Taper = taper
+			if cnfg.BatterySpec.LearnTaper {
+				optInput.Battery.Taper = learnedTaper(ctx, logger, db, taper)
+			}
+		}
+		// Continue the half cycle the battery is in, so the depth it's cycled to is costed right
+		if last, err := db.GetLatestBatteryWear(ctx); err == nil {
+			if cycle, ok := resumedCycle(last, optInput.Battery.CurrentLevel); ok {
+				optInput.Battery.Cycle = cycle
+			}
+		} else if err != sql.ErrNoRows {
+			logger.Error("planning task error, getting battery wear", slog.Any("error", err))
 		}
 
+		// Pessimistic, median and optimistic outcome, weighted according to Swanson's rule
+		pessimistic := optimize.Scenario{Weight: 0.3, EnergyBalance: make([]float64, cnfg.Planner.HoursAhead)}
+		median := optimize.Scenario{Weight: 0.4, EnergyBalance: make([]float64, cnfg.Planner.HoursAhead)}
+		optimistic := optimize.Scenario{Weight: 0.3, EnergyBalance: make([]float64, cnfg.Planner.HoursAhead)}
+		uncertain := false
+		noOfEstimatedPrices := 0
+
 		for h := range int(cnfg.Planner.HoursAhead) {
 			hour := startHour.Add(h)
 
@@ -62,14 +139,82 @@ func NewPlanningTask(logger *slog.Logger, db *database.Database, cnfg *config.Ap
 			}
 
 			optInput.Forecast[h] = optimize.Forecast{
-				EnergyPrice:   ep.Price,
-				EnergyBalance: calc.TwoDecimals(ef.Production - ef.Consumption),
+				EnergyPrice:          ep.Price,
+				EnergyPriceEstimated: ep.Estimated,
+				EnergyBalance:        calc.TwoDecimals(ef.Production - ef.Consumption),
+			}
+			if ep.Estimated {
+				noOfEstimatedPrices++
+			}
+
+			median.EnergyBalance[h] = optInput.Forecast[h].EnergyBalance
+			pessimistic.EnergyBalance[h] = median.EnergyBalance[h]
+			optimistic.EnergyBalance[h] = median.EnergyBalance[h]
+			if ef.HasQuantiles() {
+				uncertain = true
+				pessimistic.EnergyBalance[h] = calc.TwoDecimals(ef.ProductionP10 - ef.ConsumptionP90)
+				optimistic.EnergyBalance[h] = calc.TwoDecimals(ef.ProductionP90 - ef.ConsumptionP10)
+			}
+		}
+
+		if uncertain {
+			optInput.Scenarios = []optimize.Scenario{pessimistic, median, optimistic}
+		}
+
+		weather, err := db.GetWeatherForecastFrom(ctx, startHour)
+		if err != nil {
+			logger.Warn("planning without a weather forecast", slog.Any("error", err))
+		}
+
+		reserveLevels := planReserve(logger, reservePolicy, startHour, cnfg.Planner.HoursAhead, weather)
+		for _, l := range reserveLevels {
+			optInput.Reserve = append(optInput.Reserve, l.MinLevel)
+		}
+
+		if cnfg.Planner.SwitchCost > 0 || cnfg.Planner.DeviationCost > 0 {
+			previous, err := db.GetPlanningFrom(ctx, startHour.Add(-1))
+			if err != nil {
+				logger.Error("planning task error, getting previous plan", slog.Any("error", err))
+			} else {
+				optInput.SwitchCost = cnfg.Planner.SwitchCost
+				optInput.DeviationCost = cnfg.Planner.DeviationCost
+				optInput.PrecedingStrategy, optInput.Committed = previousPlan(previous, startHour, cnfg.Planner.GetStableHours())
+			}
+		}
+
+		if derating.Enabled() {
+			optInput.Derating = derating
+			optInput.Temperature = plannedTemperatures(startHour, cnfg.Planner.HoursAhead, weather, optInput.Battery.CellTemperature)
+		}
+
+		// The EV is charged in the cheapest hours before its deadline, and the battery is planned around it
+		var evCharge []float64
+		if cnfg.EvCharger.Enabled() {
+			var err error
+			evCharge, err = scheduleEvCharging(ctx, logger, db, cnfg.EvCharger, startHour, &optInput)
+			if err != nil {
+				logger.Error("planning task error, scheduling ev charging", slog.Any("error", err))
+				return
+			}
+		}
+
+		// Flexible loads are scheduled one at a time after the EV, each around what's already planned
+		var loadRunTimes map[string][]float64
+		if len(loads) > 0 {
+			var err error
+			loadRunTimes, err = scheduleFlexibleLoads(ctx, logger, db, loads, startHour, now, &optInput)
+			if err != nil {
+				logger.Error("planning task error, scheduling flexible loads", slog.Any("error", err))
+				return
 			}
 		}
 
 		logger.Debug(fmt.Sprintf("planning for %d hours ahead", cnfg.Planner.HoursAhead),
 			slog.String("hour", startHour.String()),
-			slog.Float64("battLvl", optInput.Battery.CurrentLevel))
+			slog.Float64("battLvl", optInput.Battery.CurrentLevel),
+			slog.Int("noOfScenarios", len(optInput.Scenarios)),
+			slog.Int("noOfEstimatedPrices", noOfEstimatedPrices),
+			slog.Float64("riskAversion", optInput.RiskAversion))
 
 		optOutput := optimize.BestStrategies(optInput)
 
@@ -87,21 +232,357 @@ func NewPlanningTask(logger *slog.Logger, db *database.Database, cnfg *config.Ap
 			dh := startHour.Add(h)
 			oi := optInput.Forecast[h]
 			ou := optOutput.Strategy[h]
+			battLvlFrom := optInput.Battery.CurrentLevel
+			if h > 0 {
+				battLvlFrom = optOutput.BatteryLevels[h-1]
+			}
 			logger.Debug(fmt.Sprintf("result for hour %s", dh),
 				slog.Float64("price", oi.EnergyPrice),
+				slog.Bool("estimatedPrice", oi.EnergyPriceEstimated),
 				slog.Float64("balance", oi.EnergyBalance),
-				slog.Any("strategy", ou))
-			if err := db.SavePanning(ctx, database.PlanningRow{
-				When:     dh,
-				Strategy: ou.String(),
-			}); err != nil {
+				slog.Any("strategy", ou),
+				slog.Float64("battLvl", optOutput.BatteryLevels[h]))
+			row := database.PlanningRow{
+				When:             dh,
+				Strategy:         ou.String(),
+				BatteryLevelFrom: sql.NullFloat64{Float64: battLvlFrom, Valid: true},
+				BatteryLevelTo:   sql.NullFloat64{Float64: optOutput.BatteryLevels[h], Valid: true},
+			}
+			if evCharge != nil {
+				row.EvCharge = sql.NullFloat64{Float64: calc.TwoDecimals(evCharge[h]), Valid: true}
+			}
+			if reserveLevels[h].MinLevel > 0 {
+				row.Reserve = sql.NullFloat64{Float64: reserveLevels[h].MinLevel, Valid: true}
+			}
+			if err := db.SavePanning(ctx, row); err != nil {
 				logger.Error("planning task error", slog.String("hour", dh.String()), slog.Any("error", err))
 			}
+			for name, runTime := range loadRunTimes {
+				if err := db.SaveFlexibleLoadPlan(ctx, name, dh, runTime[h]); err != nil {
+					logger.Error("planning task error, saving flexible load plan", slog.String("load", name), slog.String("hour", dh.String()), slog.Any("error", err))
+				}
+			}
 		}
 
 		logger.Info("planning task done",
+			slog.Bool("intraHour", intraHour),
 			slog.Int("noOfHoursUpdated", cnfg.Planner.HoursAhead),
 			slog.Float64("cost", optOutput.Cost),
 			slog.Float64("battLvl", optOutput.BatteryLevel))
 	}
 }
+
+// The configured taper with what's been learned from the power the battery delivered at
+// different levels in place of it
+func learnedTaper(ctx context.Context, logger *slog.Logger, db *database.Database, taper optimize.Taper) optimize.Taper {
+	rows, err := db.GetBatteryPowerByLevel(ctx)
+	if err != nil {
+		logger.Error("planning task error, getting battery power by level", slog.Any("error", err))
+		return taper
+	}
+	samples := make([]optimize.TaperSample, len(rows))
+	for i, r := range rows {
+		samples[i] = optimize.TaperSample{Level: r.Level, Charging: r.Charging, Ratio: r.Ratio, Samples: r.Samples}
+	}
+	return taper.Learned(samples)
+}
+
+// The strategy planned for the hour before the start hour, if any, and the strategies
+// planned for the stable hours from the start hour until the first hour without a plan
+func previousPlan(rows []database.PlanningRow, startHour hours.DateHour, stableHours int) (maybe.Maybe[optimize.Strategy], []optimize.Strategy) {
+	planned := make(map[hours.DateHour]optimize.Strategy, len(rows))
+	for _, r := range rows {
+		if s, ok := optimize.ParseStrategy(r.Strategy); ok {
+			planned[r.When] = s
+		}
+	}
+
+	preceding := maybe.None[optimize.Strategy]()
+	if s, ok := planned[startHour.Add(-1)]; ok {
+		preceding = maybe.Some(s)
+	}
+	var committed []optimize.Strategy
+	for h := range stableHours {
+		s, ok := planned[startHour.Add(h)]
+		if !ok {
+			break
+		}
+		committed = append(committed, s)
+	}
+	return preceding, committed
+}
+
+// The battery reserve for each planned hour. Without a weather forecast only the
+// scheduled reserve is used.
+func planReserve(
+	logger *slog.Logger,
+	policy reserve.Policy,
+	startHour hours.DateHour,
+	noOfHours int,
+	weather []database.WeatherForecastRow) []reserve.Level {
+
+	levels := policy.Hourly(startHour, noOfHours, weather)
+	for h, l := range levels {
+		if l.Reason == reserve.ReasonBadWeather {
+			logger.Info("battery reserve raised for bad weather",
+				slog.String("hour", startHour.Add(h).String()),
+				slog.Float64("reserve", l.MinLevel))
+			break
+		}
+	}
+	return levels
+}
+
+// The temperature in °C the battery power is derated by in each planned hour, the cell
+// temperature in the first hour and the forecast outdoor temperature after it. Hours
+// missing in the forecast get the temperature of the closest hour before, or after if
+// there's none before. Nil if no temperature is known.
+func plannedTemperatures(
+	startHour hours.DateHour,
+	noOfHours int,
+	weather []database.WeatherForecastRow,
+	cellTemperature maybe.Maybe[float64]) []float64 {
+
+	forecast := make(map[hours.DateHour]float64, len(weather))
+	for _, w := range weather {
+		forecast[w.When] = w.Temperature
+	}
+
+	temps := make([]maybe.Maybe[float64], noOfHours)
+	for h := range noOfHours {
+		if t, ok := forecast[startHour.Add(h)]; ok {
+			temps[h] = maybe.Some(t)
+		}
+	}
+	if noOfHours > 0 && cellTemperature.IsValid() {
+		temps[0] = cellTemperature
+	}
+
+	first := slices.IndexFunc(temps, func(t maybe.Maybe[float64]) bool { return t.IsValid() })
+	if first < 0 {
+		return nil
+	}
+	res := make([]float64, noOfHours)
+	last := temps[first].Value()
+	for h, t := range temps {
+		last = t.ValueOrDefault(last)
+		res[h] = last
+	}
+	return res
+}
+
+// Schedules the active EV charge request, if any, and adds it to the consumption.
+// Returns the energy in kWh planned for each hour.
+func scheduleEvCharging(
+	ctx context.Context,
+	logger *slog.Logger,
+	db *database.Database,
+	cnfg config.AppConfigEvCharger,
+	startHour hours.DateHour,
+	input *optimize.Input) ([]float64, error) {
+
+	req, err := db.GetActiveEvChargeRequest(ctx, time.Now())
+	if err == sql.ErrNoRows {
+		return make([]float64, len(input.Forecast)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	load := evChargeLoad(req, cnfg.MaxPower, hours.FromIso(startHour.IsoString()), len(input.Forecast))
+	planned := optimize.ScheduleLoad(*input, load)
+	input.AddLoad(planned)
+
+	scheduled := 0.0
+	for _, kWh := range planned {
+		scheduled += kWh
+	}
+	logger.Debug("scheduled ev charging",
+		slog.Float64("remaining", req.Remaining()),
+		slog.Float64("needed", load.Energy),
+		slog.Float64("scheduled", scheduled),
+		slog.Time("deadline", req.Deadline))
+	if scheduled < load.Energy-0.01 {
+		logger.Warn("not enough time to charge the ev before the deadline",
+			slog.Float64("needed", load.Energy),
+			slog.Float64("scheduled", scheduled),
+			slog.Time("deadline", req.Deadline))
+	}
+
+	return planned, nil
+}
+
+// The part of the request that has to be charged within the planned hours, what can
+// be charged after them at full power is left for later plans. Only whole hours
+// before the deadline are used.
+func evChargeLoad(req database.EvChargeRequestRow, maxPower float64, start time.Time, noOfHours int) optimize.Load {
+	hoursToDeadline := max(int(req.Deadline.Sub(start)/time.Hour), 0)
+	after := max(hoursToDeadline-noOfHours, 0)
+	return optimize.Load{
+		Power:  maxPower,
+		Energy: max(req.Remaining()-maxPower*float64(after), 0),
+		From:   0,
+		To:     min(hoursToDeadline, noOfHours),
+	}
+}
+
+// Schedules the flexible loads and adds them to the consumption. Returns the run time
+// in hours planned for each hour, by load name.
+func scheduleFlexibleLoads(
+	ctx context.Context,
+	logger *slog.Logger,
+	db *database.Database,
+	loads []flexload.Load,
+	startHour hours.DateHour,
+	now time.Time,
+	input *optimize.Input) (map[string][]float64, error) {
+
+	overrides, err := db.GetActiveFlexibleLoadOverrides(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	start := hours.FromIso(startHour.IsoString())
+	first := start
+	if now.After(start) {
+		first = now // Replanning from within the hour
+	}
+	dayStart := hours.FromTime(flexload.StartOfDay(first))
+
+	res := make(map[string][]float64, len(loads))
+	for _, load := range loads {
+		// Everything run so far, including what has run this hour before the plan starts
+		ranToday, err := db.GetFlexibleLoadRunTime(ctx, load.Name, dayStart, hours.FromTime(now).Add(1))
+		if err != nil {
+			return nil, err
+		}
+
+		var override *database.FlexibleLoadOverrideRow
+		if o, ok := overrides[load.Name]; ok {
+			override = &o
+		}
+
+		runTime := planFlexibleLoad(*input, load, start, first, ranToday, override)
+		energy := make([]float64, len(runTime))
+		for h, t := range runTime {
+			energy[h] = t * load.Power
+		}
+		input.AddLoad(energy)
+		res[load.Name] = runTime
+
+		extra := curtailRunTime(load, start, first, runTime, override)
+		curtail := make([]float64, len(extra))
+		for h, t := range extra {
+			curtail[h] = t * load.Power
+		}
+		input.AddCurtailLoad(curtail)
+
+		logger.Debug("scheduled flexible load",
+			slog.String("load", load.Name),
+			slog.Float64("ranToday", ranToday),
+			slog.Bool("overridden", override != nil))
+	}
+
+	return res, nil
+}
+
+// The run time in hours a load has left in each hour beyond its plan, which it runs when export
+// is curtailed. Hours with an override are left to the override.
+func curtailRunTime(
+	load flexload.Load,
+	start time.Time,
+	first time.Time,
+	runTime []float64,
+	override *database.FlexibleLoadOverrideRow) []float64 {
+
+	extra := make([]float64, len(runTime))
+	for h := range runTime {
+		from, to := start.Add(time.Duration(h)*time.Hour), start.Add(time.Duration(h+1)*time.Hour)
+		if from.Before(first) {
+			from = first
+		}
+		if override != nil && override.Until.After(from) {
+			continue
+		}
+		extra[h] = max(0, load.AllowedHours(from, to)-runTime[h])
+	}
+	return extra
+}
+
+// Plans the run time in hours of a load for each hour in the forecast, starting at start
+// or at first if later. Every day in the GUI timezone the load has to run its daily run
+// time within its windows, less what it has already run that day and what it can run
+// after the planned hours. An override is followed as long as it lasts.
+func planFlexibleLoad(
+	input optimize.Input,
+	load flexload.Load,
+	start time.Time,
+	first time.Time,
+	ranToday float64,
+	override *database.FlexibleLoadOverrideRow) []float64 {
+
+	n := len(input.Forecast)
+	hourStart := func(h int) time.Time {
+		t := start.Add(time.Duration(h) * time.Hour)
+		if t.Before(first) {
+			return first
+		}
+		return t
+	}
+
+	runTime := make([]float64, n)
+	availability := make([]float64, n)
+	for h := range n {
+		from, to := hourStart(h), hourStart(h+1)
+		if override != nil && override.Until.After(from) {
+			until := override.Until
+			if until.After(to) {
+				until = to
+			}
+			if override.On {
+				runTime[h] = until.Sub(from).Hours()
+			}
+			from = until
+		}
+		availability[h] = load.AllowedHours(from, to)
+	}
+
+	end := hourStart(n)
+	today := flexload.StartOfDay(first)
+	for h := 0; h < n; {
+		day := flexload.StartOfDay(hourStart(h))
+		dayEnd := flexload.EndOfDay(day)
+		last := h
+		for last < n && hourStart(last).Before(dayEnd) {
+			last++
+		}
+
+		required := load.DailyRunTime
+		for i := h; i < last; i++ {
+			required -= runTime[i]
+		}
+		if day.Equal(today) {
+			required -= ranToday
+		}
+		if dayEnd.After(end) {
+			required -= load.AllowedHours(end, dayEnd)
+		}
+
+		if required > 0 {
+			planned := optimize.ScheduleLoad(input, optimize.Load{
+				Power:        load.Power,
+				Energy:       required * load.Power,
+				From:         h,
+				To:           last,
+				Availability: availability,
+			})
+			for i, kWh := range planned {
+				runTime[i] += kWh / load.Power
+			}
+		}
+
+		h = last
+	}
+
+	return runTime
+}
@@ -0,0 +1,60 @@
+package task
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/optimize"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
+)
+
+func TestPlannedTemperatures(t *testing.T) {
+	start := hours.DateHour{Date: "2025-01-10", Hour: 22}
+	weather := []database.WeatherForecastRow{
+		{When: hours.DateHour{Date: "2025-01-10", Hour: 23}, Temperature: -4},
+		{When: hours.DateHour{Date: "2025-01-11", Hour: 1}, Temperature: -6},
+	}
+
+	tests := []struct {
+		name     string
+		weather  []database.WeatherForecastRow
+		cellTemp maybe.Maybe[float64]
+		want     []float64
+	}{
+		{"cell temperature first", weather, maybe.Some(8.0), []float64{8, -4, -4, -6}},
+		{"forecast only", weather, maybe.None[float64](), []float64{-4, -4, -4, -6}},
+		{"cell temperature only", nil, maybe.Some(8.0), []float64{8, 8, 8, 8}},
+		{"nothing known", nil, maybe.None[float64](), nil},
+	}
+	for _, tt := range tests {
+		if got := plannedTemperatures(start, 4, tt.weather, tt.cellTemp); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, wanted %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPreviousPlan(t *testing.T) {
+	start := hours.DateHour{Date: "2025-01-10", Hour: 23}
+	rows := []database.PlanningRow{
+		{When: hours.DateHour{Date: "2025-01-10", Hour: 22}, Strategy: "charge"},
+		{When: hours.DateHour{Date: "2025-01-10", Hour: 23}, Strategy: "charge"},
+		{When: hours.DateHour{Date: "2025-01-11", Hour: 0}, Strategy: "discharge"},
+		{When: hours.DateHour{Date: "2025-01-11", Hour: 2}, Strategy: "default"},
+	}
+
+	preceding, committed := previousPlan(rows, start, 4)
+	if preceding != maybe.Some(optimize.StrategyCharge) {
+		t.Errorf("got preceding strategy %v, wanted charge", preceding)
+	}
+	// Stops at the hour without a plan
+	if want := []optimize.Strategy{optimize.StrategyCharge, optimize.StrategyDischarge}; !slices.Equal(committed, want) {
+		t.Errorf("got committed strategies %v, wanted %v", committed, want)
+	}
+
+	preceding, committed = previousPlan(nil, start, 4)
+	if preceding.IsValid() || committed != nil {
+		t.Errorf("got %v and %v without a previous plan, wanted nothing", preceding, committed)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync"
 
 	"github.com/icodeforyou/solarplant-go/config"
 	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/events"
 	"github.com/icodeforyou/solarplant-go/ferroamp"
 	"github.com/icodeforyou/solarplant-go/types"
 	"github.com/robfig/cron/v3"
@@ -16,52 +18,80 @@ type Tasks struct {
 	cron                *cron.Cron
 	cnfg                *config.AppConfig
 	logger              *slog.Logger
+	replan              *events.Debouncer
+	Events              *events.Bus
 	WeatherForecastTask func()
 	EnergyForecastTask  func()
+	CalibrationTask     func()
 	EnergyPriceTask     func()
 	TimeSeriesTask      func()
 	PlanningTask        func()
+	ReplanTask          func() // Replans from within the current hour
 	MaintenanceTask     func()
 }
 
 func NewTasks(
 	db *database.Database,
+	weatherForecastProviders []types.WeatherForecastProvider,
 	energyPriceProviders []types.EnergyPriceProvider,
 	faInMem *ferroamp.FaInMemData,
 	recentHours *database.RecentHours,
 	cnfg *config.AppConfig,
 ) *Tasks {
 	logger := slog.Default().With("module", "tasks")
+	bus := events.NewBus(slog.Default().With("module", "events"))
+	planningMu := &sync.Mutex{}
 	return &Tasks{
 		cron:                cron.New(),
 		cnfg:                cnfg,
 		logger:              logger,
-		WeatherForecastTask: NewWeatherForecastTask(logger.With(slog.String("task", "weather_forecast")), db, cnfg.WeatherForecast),
-		EnergyForecastTask:  NewEnergyForecastTask(logger.With(slog.String("task", "energy_forecast")), db, cnfg.EnergyForecast),
-		EnergyPriceTask:     NewEnergyPriceTask(logger.With(slog.String("task", "energy_price")), db, energyPriceProviders),
-		TimeSeriesTask:      NewHourlyTask(logger.With(slog.String("task", "time_series")), db, cnfg.EnergyPrice, faInMem, recentHours),
-		PlanningTask:        NewPlanningTask(logger.With(slog.String("task", "planning")), db, cnfg, faInMem),
+		Events:              bus,
+		WeatherForecastTask: NewWeatherForecastTask(logger.With(slog.String("task", "weather_forecast")), db, weatherForecastProviders, bus),
+		EnergyForecastTask:  serialized(&sync.Mutex{}, NewEnergyForecastTask(logger.With(slog.String("task", "energy_forecast")), db, cnfg.EnergyForecast, bus)),
+		CalibrationTask:     serialized(&sync.Mutex{}, NewCloudCoverCalibrationTask(logger.With(slog.String("task", "cloud_cover_calibration")), db, cnfg.EnergyForecast)),
+		EnergyPriceTask:     NewEnergyPriceTask(logger.With(slog.String("task", "energy_price")), db, energyPriceProviders, cnfg.EnergyPrice, bus),
+		TimeSeriesTask:      NewHourlyTask(logger.With(slog.String("task", "time_series")), db, cnfg.EnergyPrice, cnfg.BatterySpec, faInMem, recentHours),
+		PlanningTask:        serialized(planningMu, NewPlanningTask(logger.With(slog.String("task", "planning")), db, cnfg, faInMem, false)),
+		ReplanTask:          serialized(planningMu, NewPlanningTask(logger.With(slog.String("task", "planning")), db, cnfg, faInMem, true)),
 		MaintenanceTask:     NewMaintenanceTask(logger.With(slog.String("task", "maintenance")), db, cnfg),
 	}
 }
 
+// Makes sure tasks sharing the mutex aren't run concurrently, e.g. by cron and an event at the same time
+func serialized(mu *sync.Mutex, task func()) func() {
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		task()
+	}
+}
+
 func (t *Tasks) Run() {
+	// Weather forecasts and prices are fetched on a schedule, the rest of the chain
+	// follows from them through the events below
 	_, err := t.cron.AddFunc(t.cnfg.WeatherForecast.RunAt, t.WeatherForecastTask)
 	if err != nil {
 		panic(fmt.Sprintf("failed to schedule weather forecast task: %v", err))
 	}
-	_, err = t.cron.AddFunc(t.cnfg.EnergyForecast.RunAt, t.EnergyForecastTask)
+	_, err = t.cron.AddFunc(t.cnfg.EnergyForecast.GetCalibrationRunAt(), t.CalibrationTask)
 	if err != nil {
-		panic(fmt.Sprintf("failed to schedule energy forecast task: %v", err))
+		panic(fmt.Sprintf("failed to schedule cloud cover calibration task: %v", err))
 	}
 	_, err = t.cron.AddFunc(t.cnfg.EnergyPrice.RunAt, t.EnergyPriceTask)
 	if err != nil {
 		panic(fmt.Sprintf("failed to schedule energy price task: %v", err))
 	}
-	_, err = t.cron.AddFunc("@hourly", t.TimeSeriesTask)
+	// The energy forecast is made from the hours just saved, and moves its horizon one
+	// hour ahead even when the weather forecast hasn't changed
+	_, err = t.cron.AddFunc("@hourly", func() {
+		t.TimeSeriesTask()
+		t.EnergyForecastTask()
+	})
 	if err != nil {
 		panic(fmt.Sprintf("failed to schedule time series task: %v", err))
 	}
+	// Plans the coming hour from the actual battery level even when nothing the plan
+	// is made from has changed, and in case the events above failed to trigger a replan
 	_, err = t.cron.AddFunc(t.cnfg.Planner.RunAt, t.PlanningTask)
 	if err != nil {
 		panic(fmt.Sprintf("failed to schedule planning task: %v", err))
@@ -70,9 +100,43 @@ func (t *Tasks) Run() {
 	if err != nil {
 		panic(fmt.Sprintf("failed to schedule maintenance task: %v", err))
 	}
+
+	t.subscribe()
 	t.cron.Start()
+
+	// The learned impact is otherwise missing until the first scheduled run after a fresh install
+	go t.CalibrationTask()
+}
+
+// New weather forecasts give new energy forecasts, and new energy forecasts or prices
+// give a new plan from the current hour, without waiting for the next scheduled run
+func (t *Tasks) subscribe() {
+	t.replan = events.NewDebouncer(t.cnfg.Planner.GetReplanDebounce(), t.ReplanTask)
+	t.Events.Subscribe(events.WeatherForecastUpdated, func(e events.Event) {
+		t.logger.Info("running energy forecast task", slog.String("reason", string(e)))
+		t.EnergyForecastTask()
+	})
+	replan := func(e events.Event) {
+		t.logger.Debug("replanning requested", slog.String("reason", string(e)))
+		t.replan.Trigger()
+	}
+	t.Events.Subscribe(events.EnergyForecastUpdated, replan)
+	t.Events.Subscribe(events.EnergyPriceUpdated, replan)
+
+	// The battery regulator rate limits deviations, and charge requests and load
+	// overrides are made by hand, so no need to debounce
+	replanNow := func(e events.Event) {
+		t.logger.Info("replanning from within the hour", slog.String("reason", string(e)))
+		t.ReplanTask()
+	}
+	t.Events.Subscribe(events.PlanDeviated, replanNow)
+	t.Events.Subscribe(events.EvChargeRequested, replanNow)
+	t.Events.Subscribe(events.LoadOverridden, replanNow)
 }
 
 func (t *Tasks) Stop() context.Context {
+	if t.replan != nil {
+		t.replan.Stop()
+	}
 	return t.cron.Stop()
 }
@@ -0,0 +1,99 @@
+package task
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/events"
+	"github.com/icodeforyou/solarplant-go/ferroamp"
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/robfig/cron/v3"
+)
+
+func TestPriceUpdateReplansCurrentHour(t *testing.T) {
+	now := time.Now()
+	if now.Truncate(time.Hour).Add(time.Hour).Sub(now) < 2*time.Duration(minReplanFraction*float64(time.Hour)) {
+		t.Skip("too close to the end of the hour to replan it")
+	}
+
+	ctx := context.Background()
+	db, err := database.New(ctx, filepath.Join(t.TempDir(), "solarplant.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	faInMem := ferroamp.NewFaInMemData()
+	faInMem.SetEHub(&ferroamp.EhubMessage{Ts: ferroamp.StrObj{Value: now.Format(time.RFC3339)}})
+	faInMem.SetEsm(&ferroamp.EsmMessage{ID: ferroamp.StrObj{Value: "1"}, Soc: ferroamp.FltObj{Value: 50}})
+
+	debounce := 0
+	cnfg := &config.AppConfig{
+		BatterySpec: config.AppConfigBatterySpec{
+			Capacity:         10,
+			MinLevel:         10,
+			MaxLevel:         100,
+			MaxChargeRate:    3,
+			MaxDischargeRate: 3,
+		},
+		Planner: config.AppConfigPlanner{HoursAhead: 2, ReplanDebounce: &debounce},
+	}
+
+	current := hours.FromNow()
+	_, err = db.SaveEnergyForecast(ctx, []database.EnergyForecastRow{
+		{When: current, Consumption: 1},
+		{When: current.Add(1), Consumption: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.SaveEnergyPrices(ctx, []database.EnergyPriceRow{
+		{When: current, Price: 5.0, Currency: "SEK", Provider: "test"},
+		{When: current.Add(1), Price: 0.1, Currency: "SEK", Provider: "test"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// Planned before the prices were known
+	if err := db.SavePanning(ctx, database.PlanningRow{When: current, Strategy: "charge"}); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := slog.Default()
+	tasks := &Tasks{
+		cron:         cron.New(),
+		cnfg:         cnfg,
+		logger:       logger,
+		Events:       events.NewBus(logger),
+		PlanningTask: NewPlanningTask(logger, db, cnfg, faInMem, false),
+		ReplanTask:   NewPlanningTask(logger, db, cnfg, faInMem, true),
+	}
+	tasks.subscribe()
+	defer tasks.Stop()
+	tasks.Events.Publish(events.EnergyPriceUpdated)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		row, err := db.GetPlanning(ctx, current)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row.Strategy != "charge" {
+			if row.Strategy != "discharge" {
+				t.Errorf("got strategy %s, wanted discharge when the current hour is expensive", row.Strategy)
+			}
+			if row.BatteryLevelFrom.Float64 != 50 {
+				t.Errorf("got battery level %.2f, wanted the live level 50", row.BatteryLevelFrom.Float64)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the current hour wasn't replanned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,56 +2,83 @@ package task
 
 import (
 	"context"
+	"database/sql"
 	"log/slog"
 	"time"
 
-	"github.com/icodeforyou/solarplant-go/config"
 	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/events"
 	"github.com/icodeforyou/solarplant-go/hours"
-	"github.com/icodeforyou/solarplant-go/smhi"
+	"github.com/icodeforyou/solarplant-go/types"
 )
 
-func NewWeatherForecastTask(logger *slog.Logger, db *database.Database, config config.AppConfigWeatherForecast) func() {
+func NewWeatherForecastTask(logger *slog.Logger, db *database.Database, providers []types.WeatherForecastProvider, bus *events.Bus) func() {
+	if len(providers) == 0 {
+		panic("no weather forecast providers configured")
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if needImmediateForecastUpdate(ctx, db) {
 		logger.Info("need an immediate update of weather forecast")
-		runForecastTask(logger, db, config)
+		runForecastTask(logger, db, providers, bus)
 	} else {
 		logger.Debug("no need for immediate update of weather forecast")
 	}
 
 	return func() {
-		runForecastTask(logger, db, config)
+		runForecastTask(logger, db, providers, bus)
 	}
 }
 
-func runForecastTask(logger *slog.Logger, db *database.Database, config config.AppConfigWeatherForecast) {
+func runForecastTask(logger *slog.Logger, db *database.Database, providers []types.WeatherForecastProvider, bus *events.Bus) {
 	logger.Debug("running weather forecast task...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	fc, err := smhi.Get(config.Longitude, config.Latitude)
-	if err != nil {
-		logger.Error("weather forecast task error", slog.Any("error", err))
-	} else {
-		rows := make([]database.WeatherForecastRow, len(fc))
-		for i, ep := range fc {
-			rows[i] = database.WeatherForecastRow{
-				When:          hours.FromTime(ep.Hour),
-				CloudCover:    ep.CloudCover,
-				Temperature:   ep.Temperature,
-				Precipitation: ep.Precipitation,
+	var rows []database.WeatherForecastRow
+	for _, provider := range providers {
+		fc, err := provider.GetWeatherForecast(ctx)
+		if err != nil {
+			logger.Error("weather forecast task error, fetching weather forecast", slog.Any("error", err))
+		} else if len(fc) == 0 {
+			logger.Warn("weather forecast task problem, provider returned an empty forecast")
+		} else {
+			rows = make([]database.WeatherForecastRow, len(fc))
+			for i, wf := range fc {
+				rows[i] = database.WeatherForecastRow{
+					When:          wf.Hour,
+					CloudCover:    wf.CloudCover,
+					Temperature:   wf.Temperature,
+					Precipitation: wf.Precipitation,
+					SolarRadiation: sql.NullFloat64{
+						Float64: wf.SolarRadiation.Value(),
+						Valid:   wf.SolarRadiation.IsValid(),
+					},
+					WindGust: sql.NullFloat64{
+						Float64: wf.WindGust.Value(),
+						Valid:   wf.WindGust.IsValid(),
+					},
+				}
 			}
+			break
 		}
-		if err = db.SaveForecast(ctx, rows); err != nil {
-			logger.Error("weather forecast task error", slog.Any("error", err))
-		}
 	}
 
-	logger.Info("weather forecast task done", slog.Int("noOfHoursUpdated", len(fc)))
+	if len(rows) == 0 {
+		logger.Error("weather forecast task error, no forecast fetched")
+		return
+	}
+
+	if err := db.SaveForecast(ctx, rows); err != nil {
+		logger.Error("weather forecast task error", slog.Any("error", err))
+		return
+	}
+
+	logger.Info("weather forecast task done", slog.Int("noOfHoursUpdated", len(rows)))
+	bus.Publish(events.WeatherForecastUpdated)
 }
 
 func needImmediateForecastUpdate(ctx context.Context, db *database.Database) bool {
@@ -8,9 +8,10 @@ import (
 
 type EnergyPrice struct {
 	Hour  hours.DateHour
-	Price float64 // Price in SEK per kWh excluding VAT
+	Price float64 // Spot price per kWh in the configured currency, excluding VAT
 }
 
 type EnergyPriceProvider interface {
+	Name() string
 	GetEnergyPrices(ctx context.Context) ([]EnergyPrice, error)
 }
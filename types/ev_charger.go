@@ -0,0 +1,36 @@
+package types
+
+import (
+	"context"
+	"time"
+)
+
+type EvChargerState string
+
+const (
+	EvChargerUnavailable EvChargerState = "unavailable" // The charger is offline or not yet heard from
+	EvChargerAvailable   EvChargerState = "available"   // No vehicle is connected
+	EvChargerConnected   EvChargerState = "connected"   // A vehicle is connected but not charging
+	EvChargerCharging    EvChargerState = "charging"
+	EvChargerFaulted     EvChargerState = "faulted"
+)
+
+type EvChargerStatus struct {
+	State         EvChargerState
+	Power         float64   // Current charging power in kW
+	SessionEnergy float64   // Energy delivered in the current session in kWh
+	Meter         float64   // Lifetime energy meter reading in kWh
+	Updated       time.Time // When the charger last reported
+}
+
+// A vehicle is plugged in, whether it's charging or not
+func (s EvChargerStatus) VehicleConnected() bool {
+	return s.State == EvChargerConnected || s.State == EvChargerCharging
+}
+
+type EvCharger interface {
+	Name() string
+	Status() EvChargerStatus
+	// Allows or pauses charging of the connected vehicle
+	SetCharging(ctx context.Context, enabled bool) error
+}
@@ -0,0 +1,15 @@
+package types
+
+import "context"
+
+type ExchangeRateProvider interface {
+	// Returns how many units of the local currency one EUR is worth
+	GetExchangeRate(ctx context.Context) (float64, error)
+}
+
+// A fixed exchange rate, used when the rate is given in the configuration
+type FixedExchangeRate float64
+
+func (f FixedExchangeRate) GetExchangeRate(ctx context.Context) (float64, error) {
+	return float64(f), nil
+}
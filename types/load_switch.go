@@ -0,0 +1,9 @@
+package types
+
+import "context"
+
+// Turns a flexible load, e.g. a water heater, on and off
+type LoadSwitch interface {
+	Name() string
+	SetOn(ctx context.Context, on bool) error
+}
@@ -16,13 +16,18 @@ func NewChart(title string) Chart {
 		labels[i] = label
 	}
 
+	return NewChartWithLabels(title, labels)
+}
+
+// A chart with a data point for each label in both datasets, e.g. one per day
+func NewChartWithLabels(title string, labels []string) Chart {
 	chart := Chart{
 		Type: "line",
 		Data: ChartData{
 			Labels: labels,
 			Datasets: []ChartDataset{
 				{
-					Data:        make([]*float64, NoOfHours),
+					Data:        make([]*float64, len(labels)),
 					BorderWidth: 1,
 					Tension:     0.4,
 					Fill:        true,
@@ -30,7 +35,7 @@ func NewChart(title string) Chart {
 					YAxisID:     "YAxis1",
 				},
 				{
-					Data:        make([]*float64, NoOfHours),
+					Data:        make([]*float64, len(labels)),
 					BorderWidth: 1,
 					Tension:     0.4,
 					Fill:        true,
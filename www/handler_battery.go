@@ -0,0 +1,170 @@
+package www
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/degradation"
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
+	"github.com/icodeforyou/solarplant-go/www/chartjs"
+)
+
+// Days of capacity estimates the measured capacity is averaged over, same as when planning
+const measuredCapacityDays = 30
+
+type batteryTemplData struct {
+	Cycles           maybe.Maybe[float64] // Equivalent full cycles over the battery's lifetime
+	LifeUsed         float64              // Estimated share of the cycle life used since tracking began in percentage
+	CycleLife        float64
+	Capacity         float64              // Configured capacity in kWh
+	MeasuredCapacity maybe.Maybe[float64] // Usable capacity in kWh measured over the last 30 days
+	UsedWhenPlanning bool                 // The measured capacity is used when planning
+	Modules          []database.BatteryModuleHealthRow
+	Days             []batteryTemplRow
+}
+
+type batteryTemplRow struct {
+	Date              string
+	Charged           maybe.Maybe[float64]
+	Discharged        maybe.Maybe[float64]
+	Cycles            maybe.Maybe[float64] // Equivalent full cycles during the day
+	TotalCycles       maybe.Maybe[float64] // Equivalent full cycles over the battery's lifetime at the end of the day
+	AvgTemperature    maybe.Maybe[float64]
+	LifeUsed          maybe.Maybe[float64] // Share of the cycle life used during the day in percentage
+	TotalLifeUsed     maybe.Maybe[float64] // Share of the cycle life used since tracking began in percentage
+	WearCost          maybe.Maybe[float64]
+	Soh               maybe.Maybe[float64]
+	EstimatedCapacity maybe.Maybe[float64]
+	IsToday           bool
+}
+
+// Shows how much the battery has been cycled, how much it's estimated to have worn and its health, per day
+func NewBatteryHandler(logger *slog.Logger, db *database.Database, spec config.AppConfigBatterySpec, tm *TemplateManager) http.HandlerFunc {
+	model := degradation.New(spec)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+
+		wearDays, err := db.GetDailyBatteryWear(r.Context())
+		if err != nil {
+			logger.Error("handling battery request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		healthDays, err := db.GetDailyBatteryHealth(r.Context())
+		if err != nil {
+			logger.Error("handling battery request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		modules, err := db.GetLatestBatteryModuleHealth(r.Context())
+		if err != nil {
+			logger.Error("handling battery request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		measured, err := db.GetMeasuredBatteryCapacity(r.Context(), time.Now().AddDate(0, 0, -measuredCapacityDays))
+		if err != nil && err != sql.ErrNoRows {
+			logger.Error("handling battery request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := batteryTemplData{
+			CycleLife:        model.CycleLife,
+			Capacity:         spec.Capacity,
+			MeasuredCapacity: maybe.SqlNull(measured, err == nil),
+			UsedWhenPlanning: spec.UseMeasuredCapacity && err == nil,
+			Modules:          modules,
+		}
+
+		rows := make(map[string]*batteryTemplRow)
+		row := func(date string) *batteryTemplRow {
+			if _, ok := rows[date]; !ok {
+				rows[date] = &batteryTemplRow{Date: date}
+			}
+			return rows[date]
+		}
+		totalWear := 0.0
+		for _, day := range wearDays {
+			totalWear += day.Wear
+			r := row(day.Date)
+			r.Charged = maybe.Some(day.Charged)
+			r.Discharged = maybe.Some(day.Discharged)
+			r.Cycles = maybe.Some(model.EquivalentCycles(day.Charged, day.Discharged))
+			r.TotalCycles = maybe.Some(day.Cycles)
+			r.AvgTemperature = maybe.SqlNull(day.AvgTemperature.Float64, day.AvgTemperature.Valid)
+			r.LifeUsed = maybe.Some(model.LifeUsed(day.Wear))
+			r.TotalLifeUsed = maybe.Some(model.LifeUsed(totalWear))
+			r.WearCost = maybe.Some(model.Cost(day.Wear))
+		}
+		for _, day := range healthDays {
+			r := row(day.Date)
+			r.Soh = maybe.SqlNull(day.Soh.Float64, day.Soh.Valid)
+			r.EstimatedCapacity = maybe.SqlNull(day.EstimatedCapacity.Float64, day.EstimatedCapacity.Valid)
+		}
+		if len(wearDays) > 0 {
+			data.Cycles = maybe.Some(wearDays[len(wearDays)-1].Cycles)
+		}
+		data.LifeUsed = model.LifeUsed(totalWear)
+
+		today := hours.FromNow().Date
+		for _, r := range rows {
+			r.IsToday = r.Date == today
+			data.Days = append(data.Days, *r)
+		}
+		slices.SortFunc(data.Days, func(a, b batteryTemplRow) int { return strings.Compare(b.Date, a.Date) }) // Latest first
+
+		if err := tm.ExecuteToWriter("battery.html", data, &w); err != nil {
+			logger.Error("handling battery request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// Trend of the state of health and estimated usable capacity per day
+func NewBatteryChartHandler(logger *slog.Logger, db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		days, err := db.GetDailyBatteryHealth(r.Context())
+		if err != nil {
+			logger.Error("handling battery chart request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		labels := make([]string, len(days))
+		for i, day := range days {
+			labels[i] = day.Date
+		}
+		chart := chartjs.NewChartWithLabels("", labels)
+		for i, day := range days {
+			if day.Soh.Valid {
+				chart.Data.Datasets[0].Data[i] = chartjs.FixedFloat64(day.Soh.Float64, 1)
+			}
+			if day.EstimatedCapacity.Valid {
+				chart.Data.Datasets[1].Data[i] = chartjs.FixedFloat64(day.EstimatedCapacity.Float64, 2)
+			}
+		}
+		chart.Data.Datasets[0].Fill = false
+		chart.Data.Datasets[1].Fill = false
+		chart.Options.Scales["YAxis1"] = chart.Options.Scales["YAxis1"].
+			WithTitle("State of Health (%)")
+		chart.Options.Scales["YAxis2"] = chart.Options.Scales["YAxis2"].
+			WithTitle("Estimated Capacity (kWh)")
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode([]chartjs.Chart{chart}); err != nil {
+			logger.Error("handling battery chart request", slog.Any("error", err))
+			http.Error(w, "unable to encode data points", http.StatusInternalServerError)
+			return
+		}
+	}
+}
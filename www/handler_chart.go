@@ -2,6 +2,7 @@ package www
 
 import (
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"math"
 	"net/http"
@@ -11,7 +12,7 @@ import (
 	"github.com/icodeforyou/solarplant-go/www/chartjs"
 )
 
-func NewChartHandler(logger *slog.Logger, db *database.Database) http.HandlerFunc {
+func NewChartHandler(logger *slog.Logger, db *database.Database, currency string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		midnight := hours.FromMidnight()
 
@@ -63,7 +64,7 @@ func NewChartHandler(logger *slog.Logger, db *database.Database) http.HandlerFun
 			WithTitle("Battery Level (%)").
 			WithMinAndMax(0, 100)
 		chart1.Options.Scales["YAxis2"] = chart1.Options.Scales["YAxis2"].
-			WithTitle("Energy Price (SEK/kWh)")
+			WithTitle(fmt.Sprintf("Energy Price (%s/kWh)", currency))
 
 		// Chart 2: Energy Production and Consumption
 		chart2 := chartjs.NewChart("")
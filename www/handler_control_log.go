@@ -0,0 +1,51 @@
+package www
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/icodeforyou/solarplant-go/database"
+)
+
+func NewControlLogHandler(logger *slog.Logger, db *database.Database, tm *TemplateManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			if err := tm.ExecuteToWriter("control_log.html", nil, &w); err != nil {
+				logger.Error("handling control log request", slog.Any("error", err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		pageSize := 25
+		if ps, err := strconv.Atoi(r.URL.Query().Get("pageSize")); err == nil && ps > 0 {
+			pageSize = ps
+		}
+
+		e, err := db.GetControlLog(r.Context(), page, pageSize)
+		if err != nil {
+			logger.Error("handling control log request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Page     int
+			PageSize int
+			Entries  []database.ControlLogRow
+		}{
+			Page:     page + 1,
+			PageSize: pageSize,
+			Entries:  e,
+		}
+
+		if err := tm.ExecuteToWriter("control_log_entries.html", data, &w); err != nil {
+			logger.Error("handling control log request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
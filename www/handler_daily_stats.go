@@ -24,6 +24,7 @@ type dailyStatsTemplRow struct {
 	TotGridImport    maybe.Maybe[float64]
 	TotGridExport    maybe.Maybe[float64]
 	TotCashFlow      maybe.Maybe[float64]
+	SelfSufficiency  maybe.Maybe[float64]
 	IsToday          bool
 }
 
@@ -54,6 +55,7 @@ func NewDailyStatsHandler(logger *slog.Logger, db *database.Database, tm *Templa
 				TotGridImport:    maybe.Some(row.TotGridImport),
 				TotGridExport:    maybe.Some(row.TotGridExport),
 				TotCashFlow:      maybe.Some(row.TotCashFlow),
+				SelfSufficiency:  maybe.SqlNull(row.SelfSufficiency.Float64, row.SelfSufficiency.Valid),
 				IsToday:          row.Date == thisHour.Date,
 			}
 		}
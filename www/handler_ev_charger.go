@@ -0,0 +1,115 @@
+package www
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/events"
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/types"
+)
+
+type evChargerTemplData struct {
+	Enabled    bool
+	Status     types.EvChargerStatus
+	Updated    string
+	HasRequest bool
+	Request    database.EvChargeRequestRow
+	Deadline   string
+	Sessions   []evSessionTemplRow
+	Error      string
+}
+
+type evSessionTemplRow struct {
+	Started string
+	Ended   string
+	Energy  float64
+}
+
+// Shows the charger status and sessions, and takes "need X kWh by HH:MM" requests.
+// Charger is nil when no charger is configured.
+func NewEvChargerHandler(logger *slog.Logger, db *database.Database, charger types.EvCharger, bus *events.Bus, tm *TemplateManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		data := evChargerTemplData{Enabled: charger != nil}
+
+		if r.Method == http.MethodPost && charger != nil {
+			var err error
+			switch r.PathValue("action") {
+			case "request":
+				err = saveEvChargeRequest(r, db)
+			case "cancel":
+				err = db.CancelEvChargeRequests(r.Context())
+			default:
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				logger.Warn("handling ev charge request", slog.Any("error", err))
+				data.Error = err.Error()
+			} else {
+				bus.Publish(events.EvChargeRequested)
+			}
+		}
+
+		if charger != nil {
+			data.Status = charger.Status()
+			if !data.Status.Updated.IsZero() {
+				data.Updated = hours.FormatTimeInGuiTimezone(data.Status.Updated)
+			}
+
+			req, err := db.GetActiveEvChargeRequest(r.Context(), time.Now())
+			if err != nil && err != sql.ErrNoRows {
+				logger.Error("getting ev charge request", slog.Any("error", err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if err == nil {
+				data.HasRequest = true
+				data.Request = req
+				data.Deadline = hours.FormatTimeInGuiTimezone(req.Deadline)
+			}
+
+			sessions, err := db.GetEvSessions(r.Context(), 10)
+			if err != nil {
+				logger.Error("getting ev sessions", slog.Any("error", err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			for _, s := range sessions {
+				row := evSessionTemplRow{Started: hours.FormatTimeInGuiTimezone(s.Started), Ended: "-", Energy: s.Energy}
+				if s.Ended.Valid {
+					row.Ended = hours.FormatTimeInGuiTimezone(s.Ended.Time)
+				}
+				data.Sessions = append(data.Sessions, row)
+			}
+		}
+
+		if err := tm.ExecuteToWriter("ev_charger.html", data, &w); err != nil {
+			logger.Error("handling ev charger request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
+
+func saveEvChargeRequest(r *http.Request, db *database.Database) error {
+	energy, err := strconv.ParseFloat(r.FormValue("energy"), 64)
+	if err != nil || energy <= 0 || energy > 200 {
+		return fmt.Errorf("energy must be between 0 and 200 kWh")
+	}
+	by, err := time.Parse("15:04", r.FormValue("by"))
+	if err != nil {
+		return fmt.Errorf("time must be given as HH:MM")
+	}
+
+	deadline := hours.NextTimeOfDay(by.Hour(), by.Minute(), time.Now())
+	if _, err := db.SaveEvChargeRequest(r.Context(), energy, deadline); err != nil {
+		return err
+	}
+	return nil
+}
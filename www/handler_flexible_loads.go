@@ -0,0 +1,130 @@
+package www
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/events"
+	"github.com/icodeforyou/solarplant-go/flexload"
+	"github.com/icodeforyou/solarplant-go/hours"
+	"github.com/icodeforyou/solarplant-go/task"
+)
+
+type flexibleLoadsTemplData struct {
+	Enabled bool
+	Loads   []flexibleLoadTemplRow
+	Error   string
+}
+
+type flexibleLoadTemplRow struct {
+	Name         string
+	PathName     string // Escaped for use in urls
+	Power        float64
+	DailyRunTime float64
+	Windows      string
+	State        task.FlexibleLoadState
+	RanToday     float64 // Hours
+	PlannedToday float64 // Hours planned for the rest of the day
+	Override     string  // Empty when following the plan
+}
+
+// Shows the flexible loads and lets them be forced on or off for the rest of the day.
+// Controller is nil when no loads are configured.
+func NewFlexibleLoadsHandler(logger *slog.Logger, db *database.Database, controller *task.FlexibleLoadController, bus *events.Bus, tm *TemplateManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		data := flexibleLoadsTemplData{Enabled: controller != nil}
+
+		if r.Method == http.MethodPost && controller != nil {
+			name := r.PathValue("name")
+			if !slices.ContainsFunc(controller.Loads(), func(l flexload.Load) bool { return l.Name == name }) {
+				http.NotFound(w, r)
+				return
+			}
+
+			var err error
+			switch r.PathValue("mode") {
+			case "auto":
+				err = db.DeleteFlexibleLoadOverride(r.Context(), name)
+			case "on":
+				err = db.SaveFlexibleLoadOverride(r.Context(), name, true, flexload.EndOfDay(time.Now()))
+			case "off":
+				err = db.SaveFlexibleLoadOverride(r.Context(), name, false, flexload.EndOfDay(time.Now()))
+			default:
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				logger.Warn("handling flexible load override", slog.Any("error", err))
+				data.Error = err.Error()
+			} else {
+				bus.Publish(events.LoadOverridden)
+			}
+		}
+
+		if controller != nil {
+			now := time.Now()
+			thisHour := hours.FromTime(now)
+			dayStart := hours.FromTime(flexload.StartOfDay(now))
+			dayEnd := hours.FromTime(flexload.EndOfDay(now))
+
+			rows, err := db.GetFlexibleLoadsFrom(r.Context(), dayStart)
+			if err != nil {
+				logger.Error("getting flexible loads", slog.Any("error", err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			overrides, err := db.GetActiveFlexibleLoadOverrides(r.Context(), now)
+			if err != nil {
+				logger.Error("getting flexible load overrides", slog.Any("error", err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			for _, load := range controller.Loads() {
+				row := flexibleLoadTemplRow{
+					Name:         load.Name,
+					PathName:     url.PathEscape(load.Name),
+					Power:        load.Power,
+					DailyRunTime: load.DailyRunTime,
+					Windows:      "all day",
+					State:        controller.State(load.Name),
+				}
+				if len(load.Windows) > 0 {
+					windows := make([]string, len(load.Windows))
+					for i, w := range load.Windows {
+						windows[i] = w.String()
+					}
+					row.Windows = strings.Join(windows, ", ")
+				}
+				for _, r := range rows {
+					if r.Name != load.Name || r.When.Compare(dayEnd) >= 0 {
+						continue
+					}
+					row.RanToday += r.Actual
+					if r.When.Compare(thisHour) > 0 {
+						row.PlannedToday += r.Planned.Float64
+					}
+				}
+				if o, ok := overrides[load.Name]; ok {
+					mode := "off"
+					if o.On {
+						mode = "on"
+					}
+					row.Override = mode + " until " + hours.FormatTimeInGuiTimezone(o.Until)
+				}
+				data.Loads = append(data.Loads, row)
+			}
+		}
+
+		if err := tm.ExecuteToWriter("flexible_loads.html", data, &w); err != nil {
+			logger.Error("handling flexible loads request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package www
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	_ "embed"
+
+	"github.com/icodeforyou/solarplant-go/database"
+	"github.com/icodeforyou/solarplant-go/types/maybe"
+)
+
+type forecastAccuracyTemplRow struct {
+	Month   string
+	Horizon int
+	Samples int
+	MAE     maybe.Maybe[float64]
+	Bias    maybe.Maybe[float64]
+	MAPE    maybe.Maybe[float64]
+}
+
+type forecastAccuracyTemplData struct {
+	Quantity   database.ForecastQuantity
+	Quantities []database.ForecastQuantity
+	Unit       string
+	Note       string
+	Rows       []forecastAccuracyTemplRow
+}
+
+var forecastUnits = map[database.ForecastQuantity]string{
+	database.ForecastProduction:  "kWh",
+	database.ForecastConsumption: "kWh",
+	database.ForecastTemperature: "°C",
+	database.ForecastCloudCover:  "octas",
+}
+
+// Weather isn't observed, the actual value is the last forecast for the hour
+const weatherAccuracyNote = "There are no weather observations, the forecast is compared with the last forecast for the hour."
+
+var forecastNotes = map[database.ForecastQuantity]string{
+	database.ForecastEnergyPrice: "Estimated prices are compared with the published price.",
+	database.ForecastTemperature: weatherAccuracyNote,
+	database.ForecastCloudCover:  weatherAccuracyNote,
+}
+
+func NewForecastAccuracyHandler(logger *slog.Logger, db *database.Database, tm *TemplateManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+
+		quantity, ok := database.ParseForecastQuantity(r.URL.Query().Get("quantity"))
+		if !ok {
+			quantity = database.ForecastProduction
+		}
+
+		fromDate := time.Now().UTC().AddDate(-1, 0, 0).Format("2006-01-02")
+		rows, err := db.GetForecastAccuracy(r.Context(), quantity, fromDate)
+		if err != nil {
+			logger.Error("handling forecast accuracy request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		unit := forecastUnits[quantity]
+		if quantity == database.ForecastEnergyPrice {
+			unit = tm.Currency() + "/kWh"
+		}
+
+		data := forecastAccuracyTemplData{
+			Quantity:   quantity,
+			Quantities: database.ForecastQuantities,
+			Unit:       unit,
+			Note:       forecastNotes[quantity],
+			Rows:       make([]forecastAccuracyTemplRow, len(rows)),
+		}
+		for i, row := range rows {
+			data.Rows[i] = forecastAccuracyTemplRow{
+				Month:   row.Month,
+				Horizon: row.Horizon,
+				Samples: row.Samples,
+				MAE:     maybe.Some(row.MAE),
+				Bias:    maybe.Some(row.Bias),
+				MAPE:    maybe.SqlNull(row.MAPE.Float64, row.MAPE.Valid),
+			}
+		}
+
+		if err := tm.ExecuteToWriter("forecast_accuracy.html", data, &w); err != nil {
+			logger.Error("handling forecast accuracy request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
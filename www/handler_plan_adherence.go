@@ -0,0 +1,54 @@
+package www
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/icodeforyou/solarplant-go/database"
+)
+
+func NewPlanAdherenceHandler(logger *slog.Logger, db *database.Database, tm *TemplateManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+
+		diverged := r.URL.Query().Get("diverged") == "true"
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil || page < 1 {
+			if err := tm.ExecuteToWriter("plan_adherence.html", struct{ Diverged bool }{diverged}, &w); err != nil {
+				logger.Error("handling plan adherence request", slog.Any("error", err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		pageSize := 24
+		if ps, err := strconv.Atoi(r.URL.Query().Get("pageSize")); err == nil && ps > 0 {
+			pageSize = ps
+		}
+
+		rows, err := db.GetPlanAdherence(r.Context(), page, pageSize, diverged)
+		if err != nil {
+			logger.Error("handling plan adherence request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := struct {
+			Page     int
+			PageSize int
+			Diverged bool
+			Rows     []database.PlanAdherenceRow
+		}{
+			Page:     page + 1,
+			PageSize: pageSize,
+			Diverged: diverged,
+			Rows:     rows,
+		}
+
+		if err := tm.ExecuteToWriter("plan_adherence_rows.html", data, &w); err != nil {
+			logger.Error("handling plan adherence request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
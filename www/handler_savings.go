@@ -0,0 +1,98 @@
+package www
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/database"
+)
+
+// Number of days, months or years shown
+const savingsPeriods = 31
+
+type savingsTemplData struct {
+	Period  database.SavingsPeriod
+	Periods []database.SavingsPeriod
+	Rows    []database.SavingsSummary
+}
+
+type savingsJson struct {
+	Period           string  `json:"period"`
+	Actual           float64 `json:"actual"`
+	NoBattery        float64 `json:"noBattery"`
+	SelfConsumption  float64 `json:"selfConsumption"`
+	BatterySavings   float64 `json:"batterySavings"`
+	OptimizerSavings float64 `json:"optimizerSavings"`
+	Hours            int     `json:"hours"`
+}
+
+func NewSavingsHandler(logger *slog.Logger, db *database.Database, tm *TemplateManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+
+		period, ok := database.ParseSavingsPeriod(r.URL.Query().Get("period"))
+		if !ok {
+			period = database.SavingsByDay
+		}
+
+		rows, err := db.GetSavingsSummary(r.Context(), period, savingsPeriods)
+		if err != nil {
+			logger.Error("handling savings request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data := savingsTemplData{
+			Period:  period,
+			Periods: database.SavingsPeriods,
+			Rows:    rows,
+		}
+		if err := tm.ExecuteToWriter("savings.html", data, &w); err != nil {
+			logger.Error("handling savings request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func NewSavingsApiHandler(logger *slog.Logger, db *database.Database) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		period, ok := database.SavingsByMonth, true
+		if p := r.URL.Query().Get("period"); p != "" {
+			period, ok = database.ParseSavingsPeriod(p)
+		}
+		if !ok {
+			http.Error(w, "period must be day, month or year", http.StatusBadRequest)
+			return
+		}
+
+		rows, err := db.GetSavingsSummary(r.Context(), period, savingsPeriods)
+		if err != nil {
+			logger.Error("handling savings api request", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		res := make([]savingsJson, len(rows))
+		for i, row := range rows {
+			res[i] = savingsJson{
+				Period:           row.Period,
+				Actual:           calc.RoundFloat64(row.Actual, 2),
+				NoBattery:        calc.RoundFloat64(row.NoBattery, 2),
+				SelfConsumption:  calc.RoundFloat64(row.SelfConsumption, 2),
+				BatterySavings:   calc.RoundFloat64(row.BatterySavings(), 2),
+				OptimizerSavings: calc.RoundFloat64(row.OptimizerSavings(), 2),
+				Hours:            row.Hours,
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			logger.Error("handling savings api request", slog.Any("error", err))
+			http.Error(w, "unable to encode savings", http.StatusInternalServerError)
+			return
+		}
+	}
+}
@@ -10,15 +10,32 @@ import (
 	"time"
 
 	_ "embed"
+
+	"github.com/icodeforyou/solarplant-go/calc"
+	"github.com/icodeforyou/solarplant-go/config"
+	"github.com/icodeforyou/solarplant-go/database"
 )
 
 type sysInfo struct {
-	CurrentVersion string
-	RuntimeVersion string
-	LatestVersion  string
+	CurrentVersion    string
+	RuntimeVersion    string
+	LatestVersion     string
+	CloudCoverImpacts []cloudCoverImpactInfo
+}
+
+type cloudCoverImpactInfo struct {
+	Season  string
+	Impact  float64
+	Samples int
+	Learned bool // False if the configured value is used due to too few samples
 }
 
-func NewSysInfoHandler(logger *slog.Logger, tm *TemplateManager, currentVersion string) http.HandlerFunc {
+func NewSysInfoHandler(
+	logger *slog.Logger,
+	db *database.Database,
+	cnfg config.AppConfigEnergyForecast,
+	tm *TemplateManager,
+	currentVersion string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
 
@@ -28,10 +45,16 @@ func NewSysInfoHandler(logger *slog.Logger, tm *TemplateManager, currentVersion
 			logger.Error("getting current release tag", slog.Any("error", err))
 		}
 
+		impacts, err := db.GetCloudCoverImpacts(r.Context())
+		if err != nil {
+			logger.Error("getting cloud cover impacts", slog.Any("error", err))
+		}
+
 		sysInfo := sysInfo{
-			CurrentVersion: currentVersion,
-			RuntimeVersion: runtime.Version(),
-			LatestVersion:  latestVersion,
+			CurrentVersion:    currentVersion,
+			RuntimeVersion:    runtime.Version(),
+			LatestVersion:     latestVersion,
+			CloudCoverImpacts: cloudCoverImpactInfos(impacts, cnfg),
 		}
 
 		if err := tm.ExecuteToWriter("sys_info.html", sysInfo, &w); err != nil {
@@ -70,3 +93,20 @@ func getLatestVersion(ctx context.Context) (string, error) {
 
 	return tags[0].Name, nil
 }
+
+func cloudCoverImpactInfos(impacts []database.CloudCoverImpactRow, cnfg config.AppConfigEnergyForecast) []cloudCoverImpactInfo {
+	infos := make([]cloudCoverImpactInfo, len(calc.Seasons))
+	for i, season := range calc.Seasons {
+		infos[i] = cloudCoverImpactInfo{Season: season, Impact: cnfg.CloudCoverImpact}
+		for _, impact := range impacts {
+			if impact.Season == season {
+				infos[i].Samples = impact.Samples
+				if impact.Samples >= cnfg.GetCalibrationMinSamples() {
+					infos[i].Impact = impact.Impact
+					infos[i].Learned = true
+				}
+			}
+		}
+	}
+	return infos
+}
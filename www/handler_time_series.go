@@ -1,9 +1,12 @@
 package www
 
 import (
+	"fmt"
 	"log/slog"
+	"math"
 	"net/http"
 	"slices"
+	"strings"
 
 	_ "embed"
 
@@ -18,6 +21,7 @@ type timeSeriesTemplRow struct {
 	Temperature          maybe.Maybe[float64]
 	Precipitation        maybe.Maybe[float64]
 	EnergyPrice          maybe.Maybe[float64]
+	EnergyPriceEstimated bool
 	Production           maybe.Maybe[float64]
 	ProductionEstimated  maybe.Maybe[float64]
 	Consumption          maybe.Maybe[float64]
@@ -28,6 +32,11 @@ type timeSeriesTemplRow struct {
 	GridImport           maybe.Maybe[float64]
 	CashFlow             maybe.Maybe[float64]
 	Strategy             maybe.Maybe[string]
+	EvCharge             maybe.Maybe[float64]
+	Reserve              maybe.Maybe[float64]
+	FlexibleLoads        maybe.Maybe[string]
+	PlanFollowed         maybe.Maybe[float64]
+	ControlCommands      int
 	ComparedToThisHour   int
 }
 
@@ -65,6 +74,9 @@ func NewTimeSeriesHandler(logger *slog.Logger, db *database.Database, tm *Templa
 				BatteryNetLoad:       maybe.Some(recentHour.Ts.BatteryNetLoad),
 				CashFlow:             maybe.Some(recentHour.Ts.CashFlow),
 				Strategy:             maybe.Some(recentHour.Ts.Strategy),
+				EvCharge:             maybe.None[float64](),
+				PlanFollowed:         maybe.Some(recentHour.Ts.PlanFollowed),
+				ControlCommands:      recentHour.Ts.ControlCommands,
 				ComparedToThisHour:   recentHour.When.Compare(thisHour),
 			})
 		}
@@ -87,6 +99,7 @@ func NewTimeSeriesHandler(logger *slog.Logger, db *database.Database, tm *Templa
 					Temperature:          maybe.SqlNull(f.Temperature.Float64, f.Temperature.Valid),
 					Precipitation:        maybe.SqlNull(f.Precipitation.Float64, f.Precipitation.Valid),
 					EnergyPrice:          maybe.SqlNull(f.EnergyPrice.Float64, f.EnergyPrice.Valid),
+					EnergyPriceEstimated: f.EnergyPriceEstimated.Bool,
 					Production:           maybe.None[float64](),
 					ProductionEstimated:  maybe.SqlNull(f.ProductionEstimated.Float64, f.ProductionEstimated.Valid),
 					Consumption:          maybe.None[float64](),
@@ -97,6 +110,8 @@ func NewTimeSeriesHandler(logger *slog.Logger, db *database.Database, tm *Templa
 					BatteryNetLoad:       maybe.None[float64](),
 					CashFlow:             maybe.None[float64](),
 					Strategy:             maybe.Some(f.Strategy),
+					EvCharge:             maybe.SqlNull(f.EvCharge.Float64, f.EvCharge.Valid),
+					Reserve:              maybe.SqlNull(f.Reserve.Float64, f.Reserve.Valid),
 					ComparedToThisHour:   f.When.Compare(thisHour),
 				}
 
@@ -104,6 +119,16 @@ func NewTimeSeriesHandler(logger *slog.Logger, db *database.Database, tm *Templa
 			}
 		}
 
+		if len(rows) > 0 {
+			loads, err := db.GetFlexibleLoadsFrom(r.Context(), rows[0].When)
+			if err != nil {
+				logger.Error("fetching flexible loads", slog.Any("error", err))
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			addFlexibleLoads(rows, loads)
+		}
+
 		slices.SortFunc(rows, func(i, j timeSeriesTemplRow) int {
 			return j.When.Compare(i.When)
 		})
@@ -115,3 +140,23 @@ func NewTimeSeriesHandler(logger *slog.Logger, db *database.Database, tm *Templa
 		}
 	}
 }
+
+// Sets the minutes each load has run for past hours, and is planned to run for upcoming hours
+func addFlexibleLoads(rows []timeSeriesTemplRow, loads []database.FlexibleLoadRow) {
+	byHour := make(map[hours.DateHour][]string)
+	for _, l := range loads {
+		runTime := l.Planned.Float64
+		if l.When.Compare(hours.FromNow()) <= 0 {
+			runTime = l.Actual
+		}
+		if minutes := math.Round(runTime * 60); minutes >= 1 {
+			byHour[l.When] = append(byHour[l.When], fmt.Sprintf("%s %.0fm", l.Name, minutes))
+		}
+	}
+
+	for i := range rows {
+		if loads, ok := byHour[rows[i].When]; ok {
+			rows[i].FlexibleLoads = maybe.Some(strings.Join(loads, ", "))
+		}
+	}
+}
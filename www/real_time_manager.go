@@ -2,9 +2,10 @@ package www
 
 import (
 	"context"
+	"database/sql"
 	"log/slog"
+	"time"
 
-	"github.com/icodeforyou/solarplant-go/calc"
 	"github.com/icodeforyou/solarplant-go/config"
 	"github.com/icodeforyou/solarplant-go/database"
 	"github.com/icodeforyou/solarplant-go/ferroamp"
@@ -21,6 +22,7 @@ type RealTimeData struct {
 	GridImportThisHour maybe.Maybe[float64]
 	GridExportThisHour maybe.Maybe[float64]
 	CashFlowThisHour   maybe.Maybe[float64]
+	BatteryReserve     maybe.Maybe[float64]
 }
 
 type RealTimeManager struct {
@@ -30,6 +32,8 @@ type RealTimeManager struct {
 	recentHours  *database.RecentHours
 	config       config.AppConfigEnergyPrice
 	energyPrices map[hours.DateHour]float64
+	reserve      maybe.Maybe[float64]
+	reserveAt    time.Time // When the reserve was fetched, it changes when replanned
 }
 
 func NewRealTimeManager(
@@ -76,9 +80,19 @@ func (m *RealTimeManager) Get(ctx context.Context) (RealTimeData, error) {
 		exp := m.faInMem.ExportedSince(recentHour.Fa.Data)
 		rtd.GridImportThisHour = maybe.Some(imp)
 		rtd.GridExportThisHour = maybe.Some(exp)
-		rtd.CashFlowThisHour = maybe.Some(calc.CashFlow(imp, exp, ep, m.config.Tax, m.config.TaxReduction, m.config.GridBenefit))
+		rtd.CashFlowThisHour = maybe.Some(m.config.GetTariff().CashFlow(imp, exp, ep))
 	}
 
+	if time.Since(m.reserveAt) > time.Minute || hours.FromTime(m.reserveAt) != thisHour {
+		planning, err := m.db.GetPlanning(ctx, thisHour)
+		if err != nil && err != sql.ErrNoRows {
+			m.logger.Error("error getting planning", slog.Any("error", err))
+		}
+		m.reserve = maybe.SqlNull(planning.Reserve.Float64, planning.Reserve.Valid)
+		m.reserveAt = time.Now()
+	}
+	rtd.BatteryReserve = m.reserve
+
 	rtd.GridPower = maybe.Some(m.faInMem.GridPower())
 	rtd.SolarPower = maybe.Some(m.faInMem.SolarPower())
 	rtd.BatteryPower = maybe.Some(m.faInMem.BatteryPower())
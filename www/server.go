@@ -15,6 +15,7 @@ import (
 	"github.com/icodeforyou/solarplant-go/database"
 	"github.com/icodeforyou/solarplant-go/ferroamp"
 	"github.com/icodeforyou/solarplant-go/task"
+	"github.com/icodeforyou/solarplant-go/types"
 )
 
 type Server struct {
@@ -36,10 +37,12 @@ func StartServer(
 	faInMem *ferroamp.FaInMemData,
 	recentHours *database.RecentHours,
 	cnfg *config.AppConfig,
+	evCharger types.EvCharger,
+	loadController *task.FlexibleLoadController,
 	currentVersion string) *Server {
 
 	logger := slog.Default().With("module", "www")
-	tm, err := NewTemplateManager(logger, cnfg.Api.WwwDir)
+	tm, err := NewTemplateManager(logger, cnfg.Api.WwwDir, cnfg.EnergyPrice.GetCurrency())
 	if err != nil {
 		logger.Error("template manager initialization error", slog.Any("error", err))
 	}
@@ -60,6 +63,8 @@ func StartServer(
 
 	http.Handle("GET /sysinfo", NewSysInfoHandler(
 		logger.With(slog.String("handler", "timeseries")),
+		s.db,
+		s.config.EnergyForecast,
 		s.tm,
 		currentVersion))
 
@@ -76,15 +81,73 @@ func StartServer(
 		s.tm,
 	))
 
+	http.Handle("GET /savings", NewSavingsHandler(
+		logger.With(slog.String("handler", "savings")),
+		s.db,
+		s.tm,
+	))
+
+	http.Handle("GET /api/savings", NewSavingsApiHandler(
+		logger.With(slog.String("handler", "savings")),
+		s.db,
+	))
+
+	http.Handle("GET /accuracy", NewForecastAccuracyHandler(
+		logger.With(slog.String("handler", "accuracy")),
+		s.db,
+		s.tm,
+	))
+
+	evChargerHandler := NewEvChargerHandler(
+		logger.With(slog.String("handler", "evcharger")),
+		s.db,
+		evCharger,
+		tasks.Events,
+		s.tm)
+	http.Handle("GET /evcharger", evChargerHandler)
+	http.Handle("POST /evcharger/{action}", evChargerHandler)
+
+	flexibleLoadsHandler := NewFlexibleLoadsHandler(
+		logger.With(slog.String("handler", "loads")),
+		s.db,
+		loadController,
+		tasks.Events,
+		s.tm)
+	http.Handle("GET /loads", flexibleLoadsHandler)
+	http.Handle("POST /loads/{name}/{mode}", flexibleLoadsHandler)
+
+	http.Handle("GET /battery", NewBatteryHandler(
+		logger.With(slog.String("handler", "battery")),
+		s.db,
+		s.config.BatterySpec,
+		s.tm,
+	))
+
+	http.Handle("GET /battery/chart", NewBatteryChartHandler(
+		logger.With(slog.String("handler", "battery")),
+		s.db,
+	))
+
 	http.Handle("GET /log", NewLogHandler(logger.With(
 		slog.String("handler", "log")),
 		s.config.Api,
 		s.db,
 		s.tm))
 
+	http.Handle("GET /control", NewControlLogHandler(
+		logger.With(slog.String("handler", "control")),
+		s.db,
+		s.tm))
+
+	http.Handle("GET /adherence", NewPlanAdherenceHandler(
+		logger.With(slog.String("handler", "adherence")),
+		s.db,
+		s.tm))
+
 	http.Handle("GET /chart", NewChartHandler(
 		logger.With(slog.String("handler", "chart")),
-		s.db))
+		s.db,
+		s.config.EnergyPrice.GetCurrency()))
 
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		name := r.Header.Get("User-Agent")
@@ -21,6 +21,7 @@ type TemplateManager struct {
 	templates *template.Template
 	mutex     sync.RWMutex
 	logger    *slog.Logger
+	currency  string
 }
 
 var funcMap = template.FuncMap{
@@ -45,9 +46,10 @@ var funcMap = template.FuncMap{
 	},
 }
 
-func NewTemplateManager(logger *slog.Logger, extDir *string) (*TemplateManager, error) {
+func NewTemplateManager(logger *slog.Logger, extDir *string, currency string) (*TemplateManager, error) {
 	tm := &TemplateManager{
-		logger: logger,
+		logger:   logger,
+		currency: currency,
 	}
 
 	if extDir != nil {
@@ -61,9 +63,21 @@ func NewTemplateManager(logger *slog.Logger, extDir *string) (*TemplateManager,
 	return tm, nil
 }
 
+// The currency prices are shown in
+func (tm *TemplateManager) Currency() string {
+	return tm.currency
+}
+
+// Template functions that depend on the configuration
+func (tm *TemplateManager) configFuncs() template.FuncMap {
+	return template.FuncMap{
+		"Currency": tm.Currency,
+	}
+}
+
 func (tm *TemplateManager) loadInternalTemplates() error {
 	tm.logger.Debug("loading embedded templates...")
-	tmpl, err := template.New("").Funcs(funcMap).ParseFS(templatesDirEmbed, "templates/*.html")
+	tmpl, err := template.New("").Funcs(funcMap).Funcs(tm.configFuncs()).ParseFS(templatesDirEmbed, "templates/*.html")
 	if err != nil {
 		return fmt.Errorf("failed to parse templates: %w", err)
 	}
@@ -76,7 +90,7 @@ func (tm *TemplateManager) loadExternalTemplates(extDir string) error {
 	reload := func() error {
 		tm.logger.Debug("loading external templates...")
 		pattern := filepath.Join(templatesDir, "*.html")
-		tmpl, err := template.New("").Funcs(funcMap).ParseGlob(pattern)
+		tmpl, err := template.New("").Funcs(funcMap).Funcs(tm.configFuncs()).ParseGlob(pattern)
 		if err != nil {
 			return fmt.Errorf("failed to parse templates: %w", err)
 		}